@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"watchtower/internal/config"
+	"watchtower/internal/database"
+)
+
+// runImport implements "watchtower import <file>": it loads a dataset
+// exported from GET /api/v1/export into the configured database
+func runImport(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: watchtower import <file>")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var data database.Dataset
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		return fmt.Errorf("invalid dataset %s: %w", args[0], err)
+	}
+
+	db, err := database.Init(cfg.DatabasePath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	stats, err := db.ImportDataset(&data)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %d programs, %d domains, %d domain info rows and %d status changes into %s (%d existing rows skipped)",
+		stats.Programs, stats.Domains, stats.DomainInfo, stats.StatusChanges, cfg.DatabasePath, stats.Skipped)
+	return nil
+}
+
+// importManualDomains loads the "program,domain" entries of IMPORT_FILE.
+// Entries imported before are skipped, so the file can stay configured.
+func importManualDomains(db *database.DB, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := database.ParseManualDomains(file)
+	if err != nil {
+		return err
+	}
+	stats, err := db.AddManualDomains(entries)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %d manual domains and %d programs from %s (%d already imported)",
+		stats.Domains, stats.Programs, path, stats.Skipped)
+	return nil
+}
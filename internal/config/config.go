@@ -1,31 +1,263 @@
 package config
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Scan modes select how deep each scan goes
+const (
+	ScanModeFull     = "full"     // programs, scope, discovery and health checks
+	ScanModeDiscover = "discover" // programs, scope and discovery without health checks
+	ScanModePrograms = "programs" // programs and scope domains only
+)
+
+// MinDiscoveryTimeout is the shortest accepted DISCOVERY_TIMEOUT; the tools
+// rarely return anything in less time
+const MinDiscoveryTimeout = 5 * time.Second
+
+// MinScanInterval is the shortest accepted SCAN_INTERVAL; shorter intervals
+// would start scans back to back
+const MinScanInterval = time.Minute
+
 type Config struct {
-	HackerOneToken      string
-	DatabasePath        string
-	WebPort             string
-	HealthCheckTimeout  time.Duration
-	HealthCheckWorkers  int
-	ScanInterval        time.Duration
-	SubfinderConfigPath string
+	HackerOneToken          string
+	DatabasePath            string
+	ImportFile              string
+	WebPort                 string
+	WebAccessLog            string
+	WebAuthToken            string
+	WebUser                 string
+	WebPass                 string
+	BasePath                string
+	HealthCheckTimeout      time.Duration
+	HealthCheckWorkers      int
+	HealthCheckInsecure     bool
+	HealthCheckRedirects    bool
+	HealthCheckUserAgent    string
+	HealthCheckHeaders      map[string]string
+	HealthCheckPorts        []int
+	HealthCheckRetries      int
+	ScanInterval            time.Duration
+	ScanConcurrency         int
+	SkipFreshWithin         time.Duration
+	ScanRampDuration        time.Duration
+	ScanRetryBudget         int
+	SubfinderConfigPath     string
+	HealthCheckProbes       map[string]string
+	HealthCheckTimeouts     map[string]string
+	ResolveConcurrency      int
+	ResolveTimeout          time.Duration
+	SkipPrivateIPs          bool
+	ScanMode                string
+	DiscoveryTools          []string
+	DiscoveryTimeout        time.Duration
+	DiscoveryOverallTimeout time.Duration
+	DiscoveryConcurrency    int
+	DiscoveryBatch          bool
+	DiscoveryCT             bool
+	EnableBruteforce        bool
+	BruteforceWordlist      string
+	S3Endpoint              string
+	S3Bucket                string
+	S3AccessKey             string
+	S3SecretKey             string
+	S3Region                string
+	S3Prefix                string
+	S3UseSSL                bool
+	InitialScanSilent       bool
+	AlertOnTech             []string
+	WatchInterval           time.Duration
+	WatchMinInterval        time.Duration
+	CheckHistoryRetention   time.Duration
+	DomainEventRetention    time.Duration
+	RetentionDays           int
+	StatusChangesKeep       int
+	SurgeFactor             float64
+	SurgeMinDomains         int
+	ProgramCursorTTL        time.Duration
+	ScopeCacheTTL           time.Duration
+	ScopeIncludeIneligible  bool
+	IncludePaused           bool
+	ProgramMetadata         bool
+	NormalizeProgramURLs    bool
+	OutputWebhooks          []string
+	NotifyWebhookURL        string
+	SlackWebhookURL         string
+	DiscordWebhookURL       string
+	TelegramBotToken        string
+	TelegramChatID          string
+	SMTPHost                string
+	SMTPPort                int
+	SMTPUser                string
+	SMTPPass                string
+	EmailFrom               string
+	EmailTo                 []string
+	ShutdownGracePeriod     time.Duration
+	EnableEnrichment        bool
+	EnrichmentConcurrency   int
+	EnableNuclei            bool
+	NucleiTemplates         string
+	EnableScreenshots       bool
+	ScreenshotDir           string
+	ScreenshotConcurrency   int
+	WatchMaxPrograms        int
 }
 
 func Load() (*Config, error) {
+	// Settings missing from the environment are read from the config file
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		path = DefaultConfigFile
+	}
+	fs, err := loadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if fs == nil && os.Getenv("CONFIG_FILE") != "" {
+		log.Printf("Warning: CONFIG_FILE %s does not exist, using environment variables only", path)
+	}
+	settings = fs
+	defer func() { settings = nil }()
+
 	cfg := &Config{
-		HackerOneToken:      getEnv("HACKERONE_TOKEN", ""),
-		DatabasePath:        getEnv("DATABASE_PATH", "./watchtower.db"),
-		WebPort:             getEnv("WEB_PORT", "8080"),
-		HealthCheckTimeout:  getDurationEnv("HEALTH_CHECK_TIMEOUT", 10*time.Second),
-		HealthCheckWorkers:  getIntEnv("HEALTH_CHECK_WORKERS", 50),
-		ScanInterval:        getDurationEnv("SCAN_INTERVAL", 24*time.Hour),
-		SubfinderConfigPath: getEnv("SUBFINDER_CONFIG", ""),
+		HackerOneToken:          getEnv("HACKERONE_TOKEN", ""),
+		DatabasePath:            getEnv("DATABASE_PATH", "./watchtower.db"),
+		ImportFile:              getEnv("IMPORT_FILE", ""),
+		WebPort:                 getEnv("WEB_PORT", "8080"),
+		WebAccessLog:            getEnv("WEB_ACCESS_LOG", "stdout"),
+		WebAuthToken:            getEnv("WEB_AUTH_TOKEN", ""),
+		WebUser:                 getEnv("WEB_USER", ""),
+		WebPass:                 getEnv("WEB_PASS", ""),
+		BasePath:                normalizeBasePath(getEnv("BASE_PATH", "")),
+		HealthCheckTimeout:      getDurationEnv("HEALTH_CHECK_TIMEOUT", 10*time.Second),
+		HealthCheckWorkers:      getIntEnv("HEALTH_CHECK_WORKERS", 50),
+		HealthCheckInsecure:     getBoolEnv("HEALTH_CHECK_INSECURE", false),
+		HealthCheckRedirects:    getBoolEnv("HEALTH_CHECK_FOLLOW_REDIRECTS", true),
+		HealthCheckUserAgent:    getEnv("HEALTHCHECK_USER_AGENT", "Watchtower/1.0"),
+		HealthCheckHeaders:      getHeaderEnv("HEALTHCHECK_HEADERS"),
+		HealthCheckPorts:        getPortsEnv("HEALTHCHECK_PORTS", []int{80, 443}),
+		HealthCheckRetries:      getIntEnv("HEALTHCHECK_RETRIES", 2),
+		ScanInterval:            getDurationEnv("SCAN_INTERVAL", 24*time.Hour),
+		ScanConcurrency:         getIntEnv("SCAN_CONCURRENCY", 5),
+		SkipFreshWithin:         getDurationEnv("SKIP_FRESH_WITHIN", 0),
+		ScanRampDuration:        getDurationEnv("SCAN_RAMP_DURATION", 0),
+		ScanRetryBudget:         getIntEnv("SCAN_RETRY_BUDGET", 0),
+		SubfinderConfigPath:     getEnv("SUBFINDER_CONFIG", ""),
+		HealthCheckProbes:       getMapEnv("HEALTHCHECK_PROBES"),
+		HealthCheckTimeouts:     getMapEnv("HEALTHCHECK_TIMEOUTS"),
+		ResolveConcurrency:      getIntEnv("RESOLVE_CONCURRENCY", 100),
+		ResolveTimeout:          getDurationEnv("RESOLVE_TIMEOUT", 5*time.Second),
+		SkipPrivateIPs:          getBoolEnv("SKIP_PRIVATE_IPS", true),
+		ScanMode:                strings.ToLower(getEnv("SCAN_MODE", ScanModeFull)),
+		DiscoveryTools:          getListEnv("DISCOVERY_TOOLS"),
+		DiscoveryTimeout:        getDurationEnv("DISCOVERY_TIMEOUT", 30*time.Second),
+		DiscoveryOverallTimeout: getDurationEnv("DISCOVERY_OVERALL_TIMEOUT", 5*time.Minute),
+		DiscoveryConcurrency:    getIntEnv("DISCOVERY_CONCURRENCY", 3),
+		DiscoveryBatch:          getBoolEnv("DISCOVERY_BATCH", false),
+		DiscoveryCT:             getBoolEnv("DISCOVERY_CT", false),
+		EnableBruteforce:        getBoolEnv("ENABLE_BRUTEFORCE", false),
+		BruteforceWordlist:      getEnv("BRUTEFORCE_WORDLIST", ""),
+		S3Endpoint:              getEnv("S3_ENDPOINT", ""),
+		S3Bucket:                getEnv("S3_BUCKET", ""),
+		S3AccessKey:             getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:             getEnv("S3_SECRET_KEY", ""),
+		S3Region:                getEnv("S3_REGION", ""),
+		S3Prefix:                getEnv("S3_PREFIX", "watchtower"),
+		S3UseSSL:                getBoolEnv("S3_USE_SSL", true),
+		InitialScanSilent:       getBoolEnv("INITIAL_SCAN_SILENT", true),
+		AlertOnTech:             getListEnv("ALERT_ON_TECH"),
+		WatchInterval:           getDurationEnv("WATCH_INTERVAL", 5*time.Minute),
+		WatchMinInterval:        getDurationEnv("WATCH_MIN_INTERVAL", time.Minute),
+		CheckHistoryRetention:   getDurationEnv("CHECK_HISTORY_RETENTION", 30*24*time.Hour),
+		DomainEventRetention:    getDurationEnv("DOMAIN_EVENT_RETENTION", 365*24*time.Hour),
+		RetentionDays:           getIntEnv("RETENTION_DAYS", 0),
+		StatusChangesKeep:       getIntEnv("STATUS_CHANGES_KEEP", 0),
+		SurgeFactor:             getFloatEnv("SURGE_FACTOR", 5),
+		SurgeMinDomains:         getIntEnv("SURGE_MIN_DOMAINS", 100),
+		ProgramCursorTTL:        getDurationEnv("PROGRAM_CURSOR_TTL", time.Hour),
+		ScopeCacheTTL:           getDurationEnv("SCOPE_CACHE_TTL", 6*time.Hour),
+		ScopeIncludeIneligible:  getBoolEnv("SCOPE_INCLUDE_INELIGIBLE", false),
+		IncludePaused:           getBoolEnv("INCLUDE_PAUSED", false),
+		ProgramMetadata:         getBoolEnv("PROGRAM_METADATA", true),
+		NormalizeProgramURLs:    getBoolEnv("NORMALIZE_PROGRAM_URLS", true),
+		OutputWebhooks:          getListEnv("OUTPUT_WEBHOOK_URLS"),
+		NotifyWebhookURL:        getEnv("NOTIFY_WEBHOOK_URL", ""),
+		SlackWebhookURL:         getEnv("SLACK_WEBHOOK_URL", ""),
+		DiscordWebhookURL:       getEnv("DISCORD_WEBHOOK_URL", ""),
+		TelegramBotToken:        getEnv("TELEGRAM_BOT_TOKEN", ""),
+		TelegramChatID:          getEnv("TELEGRAM_CHAT_ID", ""),
+		SMTPHost:                getEnv("SMTP_HOST", ""),
+		SMTPPort:                getIntEnv("SMTP_PORT", 587),
+		SMTPUser:                getEnv("SMTP_USER", ""),
+		SMTPPass:                getEnv("SMTP_PASS", ""),
+		EmailFrom:               getEnv("EMAIL_FROM", ""),
+		EmailTo:                 getListEnv("EMAIL_TO"),
+		ShutdownGracePeriod:     getDurationEnv("SHUTDOWN_GRACE_PERIOD", 30*time.Second),
+		EnableEnrichment:        getBoolEnv("ENABLE_ENRICHMENT", false),
+		EnrichmentConcurrency:   getIntEnv("ENRICHMENT_CONCURRENCY", 10),
+		EnableNuclei:            getBoolEnv("ENABLE_NUCLEI", false),
+		NucleiTemplates:         getEnv("NUCLEI_TEMPLATES", ""),
+		EnableScreenshots:       getBoolEnv("ENABLE_SCREENSHOTS", false),
+		ScreenshotDir:           getEnv("SCREENSHOT_DIR", "./screenshots"),
+		ScreenshotConcurrency:   getIntEnv("SCREENSHOT_CONCURRENCY", 2),
+		WatchMaxPrograms:        getIntEnv("WATCH_MAX_PROGRAMS", 3),
+	}
+
+	switch cfg.ScanMode {
+	case ScanModeFull, ScanModeDiscover, ScanModePrograms:
+	default:
+		log.Printf("Unknown SCAN_MODE %q, using %q", cfg.ScanMode, ScanModeFull)
+		cfg.ScanMode = ScanModeFull
+	}
+
+	if cfg.ScanConcurrency < 1 {
+		return nil, fmt.Errorf("SCAN_CONCURRENCY must be at least 1, got %d", cfg.ScanConcurrency)
+	}
+
+	if cfg.DiscoveryTimeout < MinDiscoveryTimeout {
+		return nil, fmt.Errorf("DISCOVERY_TIMEOUT %s is below the minimum of %s", cfg.DiscoveryTimeout, MinDiscoveryTimeout)
+	}
+	if cfg.DiscoveryOverallTimeout < cfg.DiscoveryTimeout {
+		return nil, fmt.Errorf("DISCOVERY_OVERALL_TIMEOUT %s is shorter than DISCOVERY_TIMEOUT %s", cfg.DiscoveryOverallTimeout, cfg.DiscoveryTimeout)
+	}
+	if cfg.DiscoveryConcurrency < 1 {
+		return nil, fmt.Errorf("DISCOVERY_CONCURRENCY must be at least 1, got %d", cfg.DiscoveryConcurrency)
+	}
+	if cfg.EnableBruteforce && cfg.BruteforceWordlist == "" {
+		return nil, fmt.Errorf("ENABLE_BRUTEFORCE requires BRUTEFORCE_WORDLIST")
+	}
+	if cfg.EnableNuclei && cfg.NucleiTemplates == "" {
+		return nil, fmt.Errorf("ENABLE_NUCLEI requires NUCLEI_TEMPLATES")
+	}
+
+	if (cfg.WebUser == "") != (cfg.WebPass == "") {
+		return nil, fmt.Errorf("WEB_USER and WEB_PASS must be set together")
+	}
+
+	if cfg.HealthCheckRetries < 0 {
+		log.Printf("HEALTHCHECK_RETRIES %d is negative, using 0", cfg.HealthCheckRetries)
+		cfg.HealthCheckRetries = 0
+	}
+
+	if cfg.SubfinderConfigPath != "" {
+		if _, err := os.Stat(cfg.SubfinderConfigPath); err != nil {
+			log.Printf("Warning: SUBFINDER_CONFIG %s is not readable, running subfinder without it: %v", cfg.SubfinderConfigPath, err)
+			cfg.SubfinderConfigPath = ""
+		}
+	}
+
+	if len(cfg.DiscoveryTools) == 0 {
+		cfg.DiscoveryTools = []string{"subfinder"}
+	}
+
+	if cfg.ScanInterval < MinScanInterval {
+		log.Printf("SCAN_INTERVAL %s is below the minimum of %s, using %s", cfg.ScanInterval, MinScanInterval, MinScanInterval)
+		cfg.ScanInterval = MinScanInterval
 	}
 
 	if cfg.HackerOneToken == "" {
@@ -38,30 +270,129 @@ func Load() (*Config, error) {
 	// Trim whitespace from token
 	cfg.HackerOneToken = strings.TrimSpace(cfg.HackerOneToken)
 
+	if err := fs.check(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookup(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
 func getIntEnv(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+	if value := lookup(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
+		invalidSetting(key, value)
+	}
+	return defaultValue
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := lookup(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+		invalidSetting(key, value)
+	}
+	return defaultValue
+}
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := lookup(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+		invalidSetting(key, value)
 	}
 	return defaultValue
 }
 
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
+	if value := lookup(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
 			return duration
 		}
+		invalidSetting(key, value)
 	}
 	return defaultValue
 }
+
+// normalizeBasePath turns "watchtower/" or "/watchtower" into "/watchtower";
+// the root path becomes the empty string
+func normalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// getListEnv parses a comma-separated list, skipping empty entries
+func getListEnv(key string) []string {
+	var result []string
+	for _, item := range strings.Split(lookup(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getPortsEnv parses a comma-separated list of TCP ports. Invalid ports are
+// logged and skipped; an empty list yields the default.
+func getPortsEnv(key string, defaultValue []int) []int {
+	var ports []int
+	for _, item := range getListEnv(key) {
+		port, err := strconv.Atoi(item)
+		if err != nil || port < 1 || port > 65535 {
+			log.Printf("Ignoring invalid port %q in %s", item, key)
+			continue
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) == 0 {
+		return defaultValue
+	}
+	return ports
+}
+
+// getHeaderEnv parses "Key: Value" headers separated by semicolons, e.g.
+// "Authorization: Bearer abc;X-Env: staging". Malformed headers are skipped.
+func getHeaderEnv(key string) map[string]string {
+	result := make(map[string]string)
+	for _, header := range strings.Split(lookup(key), ";") {
+		k, v, ok := strings.Cut(header, ":")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" || strings.ContainsAny(k, " \t") {
+			continue
+		}
+		result[k] = strings.TrimSpace(v)
+	}
+	return result
+}
+
+// getMapEnv parses "key=value" pairs separated by semicolons, e.g.
+// "acme=/health;other=POST /api/ping". Malformed pairs are skipped.
+func getMapEnv(key string) map[string]string {
+	result := make(map[string]string)
+	value := lookup(key)
+	if value == "" {
+		return result
+	}
+
+	for _, pair := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			continue
+		}
+		result[k] = strings.TrimSpace(v)
+	}
+	return result
+}
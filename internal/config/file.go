@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is read when CONFIG_FILE is not set
+const DefaultConfigFile = "./watchtower.yaml"
+
+// fileSettings holds the settings of the config file, keyed by the
+// environment variable they stand for, e.g. "scan_interval: 12h" is stored
+// as SCAN_INTERVAL. Environment variables take precedence over the file.
+type fileSettings struct {
+	path   string
+	values map[string]string
+	used   map[string]bool
+	errs   []error
+}
+
+// settings is the config file of the running Load; nil when there is none
+var settings *fileSettings
+
+// headerSettings are written as "Key: Value" pairs instead of "key=value"
+// when a map is flattened
+var headerSettings = map[string]bool{"HEALTHCHECK_HEADERS": true}
+
+// loadConfigFile reads the YAML config file at path. A missing file yields
+// no settings.
+func loadConfigFile(path string) (*fileSettings, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	fs := &fileSettings{path: path, values: make(map[string]string), used: make(map[string]bool)}
+	for key, value := range raw {
+		if value == nil {
+			continue
+		}
+		name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		flat, err := flattenSetting(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+		fs.values[name] = flat
+	}
+	return fs, nil
+}
+
+// flattenSetting turns a YAML value into the string the environment variable
+// would hold: lists are comma-separated and maps are "key=value" pairs
+// separated by semicolons
+func flattenSetting(name string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalarSetting(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]string, 0, len(v))
+		for _, k := range keys {
+			s, err := scalarSetting(v[k])
+			if err != nil {
+				return "", err
+			}
+			if headerSettings[name] {
+				pairs = append(pairs, k+": "+s)
+			} else {
+				pairs = append(pairs, k+"="+s)
+			}
+		}
+		return strings.Join(pairs, ";"), nil
+	default:
+		return scalarSetting(value)
+	}
+}
+
+func scalarSetting(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// lookup returns the environment variable key, falling back to the config
+// file
+func lookup(key string) string {
+	if settings != nil {
+		settings.used[key] = true
+	}
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if settings == nil {
+		return ""
+	}
+	return settings.values[key]
+}
+
+// invalidSetting records a config file value that can't be parsed. Invalid
+// environment variables keep falling back to the default.
+func invalidSetting(key, value string) {
+	if settings == nil || os.Getenv(key) != "" {
+		return
+	}
+	settings.errs = append(settings.errs, fmt.Errorf("invalid %s %q in config file %s", key, value, settings.path))
+}
+
+// check reports the invalid values of the config file and logs the settings
+// no option reads
+func (fs *fileSettings) check() error {
+	if fs == nil {
+		return nil
+	}
+	var unknown []string
+	for key := range fs.values {
+		if !fs.used[key] {
+			unknown = append(unknown, strings.ToLower(key))
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		log.Printf("Warning: Ignoring unknown settings in config file %s: %s", fs.path, strings.Join(unknown, ", "))
+	}
+	return errors.Join(fs.errs...)
+}
@@ -4,9 +4,12 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
+	"watchtower/internal/domainutil"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -15,24 +18,147 @@ type DB struct {
 }
 
 type Domain struct {
-	ID           int64
-	Domain       string
-	Program      string
-	Status       string // "up", "down", "unknown"
-	DiscoveredAt time.Time
-	LastChecked  time.Time
-	IsNew        bool
+	ID             int64
+	Domain         string
+	Program        string
+	Status         string // "up", "down", "unknown"
+	StatusReason   string // why a domain is down, e.g. "dns", "timeout", "tls", "refused", "5xx"
+	StatusCode     int    // HTTP status of the last check, 0 if none
+	FinalURL       string // URL the last check ended at after redirects
+	OpenPorts      []int  // web ports that answered the last check
+	DiscoveredAt   time.Time
+	LastChecked    time.Time
+	IsNew          bool
+	BountyEligible bool   // inherited from the scope entry the domain falls under
+	AssetType      string // HackerOne asset type of that scope entry: "URL", "DOMAIN", "WILDCARD"
+	Source         string // how the domain was found: "scope", "subfinder", "ct"; the platform is Program.Source
+	CertValid      *bool  // nil until an HTTPS certificate was seen
+	CertError      string
+}
+
+// DomainFilter selects domains for ListDomains. Zero values don't filter.
+type DomainFilter struct {
+	Program        string
+	OnlyNew        bool
+	BountyEligible bool
+	AssetType      string
+	Source         string
+	Platform       string // Program.Source of the domain's program
+	CertValid      *bool
+	Status         string
+	Sort           string // a key of domainSortColumns; empty sorts newest first
+	Order          string // "asc" or "desc" (the default)
+	Limit          int
+	Offset         int
+}
+
+// domainSortColumns maps the sort keys accepted by ListDomains to columns.
+// Only these names ever reach the ORDER BY clause.
+var domainSortColumns = map[string]string{
+	"domain":        "domain",
+	"status":        "status",
+	"last_checked":  "last_checked",
+	"discovered_at": "discovered_at",
+}
+
+// ValidateDomainSort checks the sort key and order of a DomainFilter
+func ValidateDomainSort(sort, order string) error {
+	if _, ok := domainSortColumns[sort]; sort != "" && !ok {
+		return fmt.Errorf("sort must be one of domain, status, last_checked, discovered_at")
+	}
+	if order != "" && order != "asc" && order != "desc" {
+		return fmt.Errorf("order must be asc or desc")
+	}
+	return nil
+}
+
+// orderBy builds the ORDER BY clause of the filter. Rows without a value
+// sort last in either order, and the id keeps pages stable.
+func (f DomainFilter) orderBy() (string, error) {
+	if err := ValidateDomainSort(f.Sort, f.Order); err != nil {
+		return "", err
+	}
+	column := "discovered_at"
+	if f.Sort != "" {
+		column = domainSortColumns[f.Sort]
+	}
+	direction := "DESC"
+	if f.Order == "asc" {
+		direction = "ASC"
+	}
+	return fmt.Sprintf(" ORDER BY %s IS NULL, %s %s, id %s", column, column, direction, direction), nil
+}
+
+// where builds the WHERE clause of the filter, empty if nothing is filtered
+func (f DomainFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if f.Program != "" {
+		conditions = append(conditions, "program = ?")
+		args = append(args, f.Program)
+	}
+	if f.OnlyNew {
+		conditions = append(conditions, "is_new = 1")
+	}
+	if f.BountyEligible {
+		conditions = append(conditions, "bounty_eligible = 1")
+	}
+	if f.AssetType != "" {
+		conditions = append(conditions, "asset_type = ?")
+		args = append(args, f.AssetType)
+	}
+	if f.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, f.Source)
+	}
+	if f.Platform != "" {
+		// Domains have no platform of their own; it is the source of the
+		// program they belong to
+		conditions = append(conditions, "program IN (SELECT handle FROM programs WHERE COALESCE(source, 'hackerone') = ?)")
+		args = append(args, f.Platform)
+	}
+	if f.CertValid != nil {
+		conditions = append(conditions, "cert_valid = ?")
+		args = append(args, *f.CertValid)
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, f.Status)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
 }
 
+// StatusUnreachableInternal marks domains that resolve only to private or
+// reserved addresses and were therefore not health checked
+const StatusUnreachableInternal = "unreachable_internal"
+
+// ProgramSourceHackerOne is the source of programs fetched from HackerOne
+const ProgramSourceHackerOne = "hackerone"
+
+// ProgramSourceManual is the source of programs and domains imported from a
+// file with AddManualDomains
+const ProgramSourceManual = "manual"
+
 type Program struct {
-	ID             int64
-	Name           string
-	Handle         string
-	URL            string
-	Domain         string
-	OffersBounties bool
-	ProgramType    string // "RDP", "VDP", "BOTH", "UNKNOWN"
-	LastScanned    time.Time
+	ID              int64
+	Name            string
+	Handle          string
+	URL             string
+	APIURL          string // URL as reported by HackerOne, before normalization
+	Domain          string
+	OffersBounties  bool
+	ProgramType     string // "RDP", "VDP", "BOTH", "UNKNOWN"
+	Source          string // platform the program comes from, e.g. "hackerone"
+	SubmissionState string // "open", "paused", ... as reported by HackerOne
+	// Directory metadata; nil when it was never fetched
+	BountyMin       *float64
+	BountyMax       *float64
+	BountyCurrency  string
+	ResolvedReports *int
+	LastScanned     time.Time
 }
 
 type StatusChange struct {
@@ -45,22 +171,83 @@ type StatusChange struct {
 	Notified    bool
 }
 
+// Alert types stored in the alerts table
+const (
+	AlertTypeTech       = "tech_alert"
+	AlertTypeSurge      = "program_surge"
+	AlertTypeTechChange = "tech_change"
+)
+
+// Alert is a notable event about a domain or program other than a status change
+type Alert struct {
+	ID        int64
+	Type      string
+	Domain    string
+	Program   string
+	Detail    string
+	CreatedAt time.Time
+	Notified  bool
+}
+
+// DomainCheck is one health check result kept in the check history
+type DomainCheck struct {
+	ID           int64
+	Domain       string
+	Program      string
+	Status       string
+	StatusReason string
+	StatusCode   int // 0 when no HTTP response was received
+	CheckedAt    time.Time
+}
+
+// DomainEvent is a point in a domain's status timeline: the status it was
+// first observed with, and every later change. Events have their own
+// retention, so flapping stays visible after the check history is pruned.
+type DomainEvent struct {
+	ID           int64     `json:"id"`
+	Domain       string    `json:"domain"`
+	Program      string    `json:"program"`
+	Status       string    `json:"status"`
+	StatusReason string    `json:"status_reason"`
+	ObservedAt   time.Time `json:"observed_at"`
+}
+
+// DomainTimeline tells when a domain first appeared and how often and when
+// its status last changed, across all programs
+type DomainTimeline struct {
+	Domain        string     `json:"domain"`
+	FirstSeen     time.Time  `json:"first_seen"`
+	LastChanged   *time.Time `json:"last_changed"`
+	StatusChanges int        `json:"status_changes"`
+}
+
 type DomainInfo struct {
 	Domain      string
 	Program     string
 	Status      string
 	Title       string
 	StatusCode  int
+	Server      string
 	Technologies []string
+	FaviconHash *int32 // Shodan-style mmh3 hash of /favicon.ico, nil if there is none
 	LastChecked time.Time
 }
 
 func Init(dbPath string) (*DB, error) {
-	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_foreign_keys=1")
+	// Writers wait up to 5s for a lock instead of failing right away
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_foreign_keys=1&_busy_timeout=5000")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// SQLite allows a single writer per file. With several pooled connections
+	// the health check workers, the API and the scheduler write concurrently
+	// and lose saves to "database is locked" errors, so all access goes
+	// through one connection and is serialized by database/sql instead.
+	// Nothing may hold that connection for long: open rows block every other
+	// query, so streaming reads like EachDomain fetch a page at a time.
+	db.SetMaxOpenConns(1)
+
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
@@ -80,6 +267,14 @@ func Init(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	if err := applyDataMigrations(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate data: %w", err)
+	}
+
+	if err := migrateTechnologies(db); err != nil {
+		log.Printf("Warning: Failed to convert technologies to JSON: %v", err)
+	}
+
 	return &DB{db}, nil
 }
 
@@ -102,6 +297,25 @@ func migrateTables(db *sql.DB) error {
 		{"programs", "domain", "TEXT"},
 		{"programs", "offers_bounties", "BOOLEAN DEFAULT 0"},
 		{"programs", "program_type", "TEXT DEFAULT 'UNKNOWN'"},
+		{"programs", "submission_state", "TEXT DEFAULT ''"},
+		{"programs", "bounty_min", "REAL"},
+		{"programs", "bounty_max", "REAL"},
+		{"programs", "bounty_currency", "TEXT DEFAULT ''"},
+		{"programs", "resolved_reports", "INTEGER"},
+		{"programs", "api_url", "TEXT DEFAULT ''"},
+		{"programs", "source", "TEXT DEFAULT 'hackerone'"},
+		{"domains", "bounty_eligible", "BOOLEAN DEFAULT 0"},
+		{"domains", "source", "TEXT DEFAULT ''"},
+		{"domains", "cert_valid", "BOOLEAN"},
+		{"domains", "cert_error", "TEXT DEFAULT ''"},
+		{"domains", "status_reason", "TEXT DEFAULT ''"},
+		{"domains", "status_code", "INTEGER DEFAULT 0"},
+		{"domains", "final_url", "TEXT DEFAULT ''"},
+		{"domains", "open_ports", "TEXT DEFAULT ''"},
+		{"domains", "asset_type", "TEXT DEFAULT ''"},
+		{"domain_info", "server", "TEXT DEFAULT ''"},
+		{"domain_info", "favicon_hash", "INTEGER"},
+		{"domain_checks", "status_reason", "TEXT DEFAULT ''"},
 	}
 
 	for _, mig := range migrations {
@@ -128,6 +342,49 @@ func migrateTables(db *sql.DB) error {
 	return nil
 }
 
+// dataMigrations change existing databases and must run only once. Each runs
+// in order after the tables exist and is recorded in schema_migrations.
+var dataMigrations = []struct {
+	name  string
+	query string
+}{
+	// Only tech alerts were delivered before every alert type was; don't
+	// send the backlog of the other types after upgrading
+	{"alerts_backlog_notified", `UPDATE alerts SET notified = 1 WHERE notified = 0`},
+	// UNIQUE(domain, program) already indexes lookups by domain
+	{"drop_idx_domains_domain", `DROP INDEX IF EXISTS idx_domains_domain`},
+}
+
+func applyDataMigrations(db *sql.DB) error {
+	for _, mig := range dataMigrations {
+		var applied int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE name = ?`, mig.name).Scan(&applied); err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(mig.query); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", mig.name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (name) VALUES (?)`, mig.name); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Migrated: Applied %s", mig.name)
+	}
+	return nil
+}
+
 func createTables(db *sql.DB) error {
 	queries := []string{
 		`CREATE TABLE IF NOT EXISTS programs (
@@ -138,6 +395,13 @@ func createTables(db *sql.DB) error {
 			domain TEXT,
 			offers_bounties BOOLEAN DEFAULT 0,
 			program_type TEXT DEFAULT 'UNKNOWN',
+			submission_state TEXT DEFAULT '',
+			bounty_min REAL,
+			bounty_max REAL,
+			bounty_currency TEXT DEFAULT '',
+			resolved_reports INTEGER,
+			api_url TEXT DEFAULT '',
+			source TEXT DEFAULT 'hackerone',
 			last_scanned DATETIME,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -158,28 +422,154 @@ func createTables(db *sql.DB) error {
 			status TEXT DEFAULT 'unknown',
 			title TEXT,
 			status_code INTEGER,
+			server TEXT DEFAULT '',
 			technologies TEXT,
+			favicon_hash INTEGER,
 			last_checked DATETIME,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`CREATE TABLE IF NOT EXISTS domain_checks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain TEXT NOT NULL,
+			program TEXT NOT NULL,
+			status TEXT NOT NULL,
+			status_reason TEXT DEFAULT '',
+			status_code INTEGER DEFAULT 0,
+			checked_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS domain_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain TEXT NOT NULL,
+			program TEXT NOT NULL,
+			status TEXT NOT NULL,
+			status_reason TEXT DEFAULT '',
+			observed_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS program_domain_counts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			program TEXT NOT NULL,
+			domain_count INTEGER NOT NULL,
+			scanned_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS fetch_cursors (
+			key TEXT PRIMARY KEY,
+			next_url TEXT NOT NULL,
+			state BLOB,
+			saved_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS scope_cache (
+			handle TEXT PRIMARY KEY,
+			scope BLOB NOT NULL,
+			fetched_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS scope_assets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			program TEXT NOT NULL,
+			identifier TEXT NOT NULL,
+			asset_type TEXT NOT NULL DEFAULT '',
+			eligible_for_bounty BOOLEAN NOT NULL DEFAULT 0,
+			eligible_for_submission BOOLEAN NOT NULL DEFAULT 0,
+			instruction TEXT NOT NULL DEFAULT '',
+			max_severity TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(program, identifier, asset_type)
+		)`,
+		`CREATE TABLE IF NOT EXISTS findings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain TEXT NOT NULL,
+			program TEXT NOT NULL DEFAULT '',
+			template_id TEXT NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			severity TEXT NOT NULL DEFAULT '',
+			matched_at TEXT NOT NULL DEFAULT '',
+			first_seen DATETIME NOT NULL,
+			last_seen DATETIME NOT NULL,
+			UNIQUE(domain, template_id, matched_at)
+		)`,
+		`CREATE TABLE IF NOT EXISTS screenshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain TEXT UNIQUE NOT NULL,
+			program TEXT NOT NULL DEFAULT '',
+			path TEXT NOT NULL,
+			captured_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS manual_domains (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			program TEXT NOT NULL,
+			domain TEXT NOT NULL,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(program, domain)
+		)`,
+		`CREATE TABLE IF NOT EXISTS scans (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			started_at DATETIME NOT NULL,
+			finished_at DATETIME,
+			status TEXT NOT NULL DEFAULT 'running',
+			programs_processed INTEGER NOT NULL DEFAULT 0,
+			domains_found INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			domain TEXT NOT NULL DEFAULT '',
+			program TEXT NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			notified BOOLEAN DEFAULT 0,
+			UNIQUE(type, domain, program, detail)
+		)`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			name TEXT PRIMARY KEY,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS notification_deliveries (
+			kind TEXT NOT NULL,
+			item_id INTEGER NOT NULL,
+			notifier TEXT NOT NULL,
+			delivered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (kind, item_id, notifier)
+		)`,
 		`CREATE TABLE IF NOT EXISTS domains (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			domain TEXT NOT NULL,
 			program TEXT NOT NULL,
 			status TEXT DEFAULT 'unknown',
+			status_reason TEXT DEFAULT '',
+			status_code INTEGER DEFAULT 0,
+			final_url TEXT DEFAULT '',
+			open_ports TEXT DEFAULT '',
 			discovered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			last_checked DATETIME,
 			is_new BOOLEAN DEFAULT 1,
+			bounty_eligible BOOLEAN DEFAULT 0,
+			asset_type TEXT DEFAULT '',
+			source TEXT DEFAULT '',
+			cert_valid BOOLEAN,
+			cert_error TEXT DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			UNIQUE(domain, program)
 		)`,
+		// Indexes use IF NOT EXISTS and run on every start, so existing
+		// databases pick up new ones without a separate migration
 		`CREATE INDEX IF NOT EXISTS idx_domains_program ON domains(program)`,
 		`CREATE INDEX IF NOT EXISTS idx_domains_status ON domains(status)`,
 		`CREATE INDEX IF NOT EXISTS idx_domains_is_new ON domains(is_new)`,
 		`CREATE INDEX IF NOT EXISTS idx_domains_discovered_at ON domains(discovered_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_domains_last_checked ON domains(last_checked)`,
+		`CREATE INDEX IF NOT EXISTS idx_domains_bounty_eligible ON domains(bounty_eligible)`,
 		`CREATE INDEX IF NOT EXISTS idx_status_changes_domain ON status_changes(domain)`,
 		`CREATE INDEX IF NOT EXISTS idx_status_changes_notified ON status_changes(notified)`,
+		`CREATE INDEX IF NOT EXISTS idx_domain_checks_domain ON domain_checks(domain, checked_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_domain_checks_checked_at ON domain_checks(checked_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_domain_checks_program ON domain_checks(program, domain)`,
+		`CREATE INDEX IF NOT EXISTS idx_domain_events_domain ON domain_events(domain, observed_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_domain_events_observed_at ON domain_events(observed_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_program_domain_counts_program ON program_domain_counts(program, scanned_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_type ON alerts(type, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_findings_severity ON findings(severity, last_seen)`,
+		`CREATE INDEX IF NOT EXISTS idx_scans_started_at ON scans(started_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_programs_type ON programs(program_type)`,
 		`CREATE INDEX IF NOT EXISTS idx_programs_bounties ON programs(offers_bounties)`,
 	}
@@ -195,10 +585,22 @@ func createTables(db *sql.DB) error {
 
 func (db *DB) SaveProgram(program *Program) error {
 	// Try new schema first
-	query := `INSERT OR REPLACE INTO programs (handle, name, url, domain, offers_bounties, program_type, last_scanned) 
-	          VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err := db.Exec(query, program.Handle, program.Name, program.URL, program.Domain, 
-		program.OffersBounties, program.ProgramType, time.Now())
+	// Metadata that wasn't fetched this time keeps its previous value
+	query := `INSERT INTO programs (handle, name, url, api_url, domain, offers_bounties, program_type, source, submission_state,
+	                                bounty_min, bounty_max, bounty_currency, resolved_reports, last_scanned)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	          ON CONFLICT(handle) DO UPDATE SET
+	              name = excluded.name, url = excluded.url, api_url = excluded.api_url, domain = excluded.domain,
+	              source = excluded.source,
+	              offers_bounties = excluded.offers_bounties, program_type = excluded.program_type,
+	              submission_state = excluded.submission_state,
+	              bounty_min = COALESCE(excluded.bounty_min, bounty_min),
+	              bounty_max = COALESCE(excluded.bounty_max, bounty_max),
+	              bounty_currency = COALESCE(NULLIF(excluded.bounty_currency, ''), bounty_currency),
+	              resolved_reports = COALESCE(excluded.resolved_reports, resolved_reports)`
+	_, err := db.Exec(query, program.Handle, program.Name, program.URL, program.APIURL, program.Domain, 
+		program.OffersBounties, program.ProgramType, programSource(program.Source), program.SubmissionState,
+		program.BountyMin, program.BountyMax, program.BountyCurrency, program.ResolvedReports, time.Now())
 	
 	// If that fails due to missing columns, try old schema
 	if err != nil && strings.Contains(err.Error(), "no such column") {
@@ -210,19 +612,39 @@ func (db *DB) SaveProgram(program *Program) error {
 	return err
 }
 
+// MarkProgramScanned sets the time a program was last scanned completely.
+// SaveProgram only sets it for new programs.
+func (db *DB) MarkProgramScanned(handle string, at time.Time) error {
+	_, err := db.Exec(`UPDATE programs SET last_scanned = ? WHERE handle = ?`, at, handle)
+	return err
+}
+
+// GetProgramLastScanned returns when a program was last scanned completely;
+// ok is false for unknown programs
+func (db *DB) GetProgramLastScanned(handle string) (lastScanned time.Time, ok bool, err error) {
+	var value sql.NullTime
+	err = db.QueryRow(`SELECT last_scanned FROM programs WHERE handle = ?`, handle).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return value.Time, value.Valid, nil
+}
+
 func (db *DB) GetPrograms() ([]Program, error) {
 	// Check if new columns exist, if not use old schema
-	var hasNewColumns bool
-	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('programs') WHERE name IN ('domain', 'offers_bounties', 'program_type')`).Scan(&hasNewColumns)
-	if err == nil {
-		var count int
-		db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('programs') WHERE name IN ('domain', 'offers_bounties', 'program_type')`).Scan(&count)
-		hasNewColumns = count == 3
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('programs') WHERE name IN ('domain', 'offers_bounties', 'program_type')`).Scan(&count)
+	if err != nil {
+		return nil, err
 	}
+	hasNewColumns := count == 3
 
 	var rows *sql.Rows
 	if hasNewColumns {
-		rows, err = db.Query(`SELECT id, name, handle, url, domain, offers_bounties, program_type, last_scanned FROM programs`)
+		rows, err = db.Query(`SELECT ` + programColumns + ` FROM programs`)
 	} else {
 		// Fallback to old schema
 		rows, err = db.Query(`SELECT id, name, handle, url, last_scanned FROM programs`)
@@ -232,177 +654,550 @@ func (db *DB) GetPrograms() ([]Program, error) {
 	}
 	defer rows.Close()
 
+	if hasNewColumns {
+		return scanPrograms(rows)
+	}
+
 	var programs []Program
 	for rows.Next() {
 		var p Program
-		if hasNewColumns {
-			if err := rows.Scan(&p.ID, &p.Name, &p.Handle, &p.URL, &p.Domain, &p.OffersBounties, &p.ProgramType, &p.LastScanned); err != nil {
-				return nil, err
-			}
-		} else {
-			if err := rows.Scan(&p.ID, &p.Name, &p.Handle, &p.URL, &p.LastScanned); err != nil {
-				return nil, err
-			}
-			// Set defaults for old schema
-			p.Domain = ""
-			p.OffersBounties = false
-			p.ProgramType = "UNKNOWN"
+		if err := rows.Scan(&p.ID, &p.Name, &p.Handle, &p.URL, &p.LastScanned); err != nil {
+			return nil, err
 		}
+		// Set defaults for old schema
+		p.ProgramType = "UNKNOWN"
 		programs = append(programs, p)
 	}
 	return programs, nil
 }
 
-func (db *DB) GetProgramsByType(programType string) ([]Program, error) {
-	// Use COALESCE to handle missing columns gracefully
-	rows, err := db.Query(`SELECT id, name, handle, url, 
-		COALESCE(domain, '') as domain,
-		COALESCE(offers_bounties, 0) as offers_bounties,
-		COALESCE(program_type, 'UNKNOWN') as program_type,
-		last_scanned 
-		FROM programs WHERE COALESCE(program_type, 'UNKNOWN') = ?`, programType)
+// programColumns is the column list read by scanPrograms. COALESCE covers
+// columns that were added by migrations.
+const programColumns = `id, name, handle, url, COALESCE(api_url, ''), COALESCE(domain, ''), COALESCE(offers_bounties, 0),
+	COALESCE(program_type, 'UNKNOWN'), COALESCE(source, 'hackerone'), COALESCE(submission_state, ''),
+	bounty_min, bounty_max, COALESCE(bounty_currency, ''), resolved_reports, last_scanned`
+
+// scanPrograms reads rows selected with programColumns. No rows give an
+// empty slice, so API responses encode it as [] instead of null.
+func scanPrograms(rows *sql.Rows) ([]Program, error) {
+	programs := []Program{}
+	for rows.Next() {
+		var p Program
+		var bountyMin, bountyMax sql.NullFloat64
+		var resolved sql.NullInt64
+		if err := rows.Scan(&p.ID, &p.Name, &p.Handle, &p.URL, &p.APIURL, &p.Domain, &p.OffersBounties, &p.ProgramType,
+			&p.Source, &p.SubmissionState, &bountyMin, &bountyMax, &p.BountyCurrency, &resolved, &p.LastScanned); err != nil {
+			return nil, err
+		}
+		if bountyMin.Valid {
+			p.BountyMin = &bountyMin.Float64
+		}
+		if bountyMax.Valid {
+			p.BountyMax = &bountyMax.Float64
+		}
+		if resolved.Valid {
+			n := int(resolved.Int64)
+			p.ResolvedReports = &n
+		}
+		programs = append(programs, p)
+	}
+	return programs, rows.Err()
+}
+
+// programSource defaults an empty program source to HackerOne
+func programSource(source string) string {
+	if source == "" {
+		return ProgramSourceHackerOne
+	}
+	return source
+}
+
+// GetProgramsBySource returns the programs of one platform
+func (db *DB) GetProgramsBySource(source string) ([]Program, error) {
+	rows, err := db.Query(`SELECT `+programColumns+`
+		FROM programs WHERE COALESCE(source, 'hackerone') = ?`, source)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var programs []Program
+	return scanPrograms(rows)
+}
+
+// GetProgramSources returns the distinct platforms programs come from
+func (db *DB) GetProgramSources() ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT COALESCE(source, 'hackerone') FROM programs ORDER BY 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []string
 	for rows.Next() {
-		var p Program
-		if err := rows.Scan(&p.ID, &p.Name, &p.Handle, &p.URL, &p.Domain, &p.OffersBounties, &p.ProgramType, &p.LastScanned); err != nil {
+		var source string
+		if err := rows.Scan(&source); err != nil {
 			return nil, err
 		}
-		programs = append(programs, p)
+		sources = append(sources, source)
 	}
-	return programs, nil
+	return sources, rows.Err()
+}
+
+func (db *DB) GetProgramsByType(programType string) ([]Program, error) {
+	// Use COALESCE to handle missing columns gracefully
+	rows, err := db.Query(`SELECT `+programColumns+`
+		FROM programs WHERE COALESCE(program_type, 'UNKNOWN') = ?`, programType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPrograms(rows)
 }
 
 func (db *DB) GetProgramsWithBounties() ([]Program, error) {
 	// Use COALESCE to handle missing columns gracefully
-	rows, err := db.Query(`SELECT id, name, handle, url, 
-		COALESCE(domain, '') as domain,
-		COALESCE(offers_bounties, 0) as offers_bounties,
-		COALESCE(program_type, 'UNKNOWN') as program_type,
-		last_scanned 
+	rows, err := db.Query(`SELECT `+programColumns+`
 		FROM programs WHERE COALESCE(offers_bounties, 0) = 1`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var programs []Program
-	for rows.Next() {
-		var p Program
-		if err := rows.Scan(&p.ID, &p.Name, &p.Handle, &p.URL, &p.Domain, &p.OffersBounties, &p.ProgramType, &p.LastScanned); err != nil {
-			return nil, err
+	return scanPrograms(rows)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// SaveDomain inserts or updates a domain and sets IsNew when it was inserted.
+// When the status of an existing domain changed, the recorded status change
+// is returned.
+func (db *DB) SaveDomain(domain *Domain) (*StatusChange, error) {
+	return saveDomain(db, domain)
+}
+
+// SaveDomains saves a batch of domains in a single transaction. A domain
+// that fails to save is rolled back on its own and reported in skipped by its
+// index; the others are still stored. The recorded status changes are
+// returned in the order of the domains.
+func (db *DB) SaveDomains(domains []Domain) (changes []StatusChange, skipped map[int]error, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	for i := range domains {
+		if _, err := tx.Exec(`SAVEPOINT save_domain`); err != nil {
+			return nil, nil, err
+		}
+		change, saveErr := saveDomain(tx, &domains[i])
+		if saveErr != nil {
+			if _, err := tx.Exec(`ROLLBACK TO save_domain`); err != nil {
+				return nil, nil, err
+			}
+			if skipped == nil {
+				skipped = make(map[int]error)
+			}
+			skipped[i] = fmt.Errorf("save %s: %w", domains[i].Domain, saveErr)
+		} else if change != nil {
+			changes = append(changes, *change)
+		}
+		if _, err := tx.Exec(`RELEASE save_domain`); err != nil {
+			return nil, nil, err
 		}
-		programs = append(programs, p)
 	}
-	return programs, nil
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return changes, skipped, nil
 }
 
-func (db *DB) SaveDomain(domain *Domain) error {
+func saveDomain(ex execer, domain *Domain) (*StatusChange, error) {
+	// Store the canonical form so the same host never lands in two rows
+	domain.Domain = domainutil.Normalize(domain.Domain)
+	if domain.Domain == "" {
+		return nil, fmt.Errorf("empty domain")
+	}
+
 	// Check if domain already exists and get old status
 	var existingID int64
 	var existingIsNew bool
 	var oldStatus string
-	err := db.QueryRow(`SELECT id, is_new, status FROM domains WHERE domain = ? AND program = ?`,
+	err := ex.QueryRow(`SELECT id, is_new, status FROM domains WHERE domain = ? AND program = ?`,
 		domain.Domain, domain.Program).Scan(&existingID, &existingIsNew, &oldStatus)
 
 	if err == sql.ErrNoRows {
 		// New domain
-		query := `INSERT INTO domains (domain, program, status, discovered_at, last_checked, is_new)
-		          VALUES (?, ?, ?, ?, ?, 1)`
-		_, err = db.Exec(query, domain.Domain, domain.Program, domain.Status,
-			domain.DiscoveredAt, domain.LastChecked)
-		return err
+		query := `INSERT INTO domains (domain, program, status, status_reason, status_code, final_url, open_ports, discovered_at,
+		          last_checked, is_new, bounty_eligible, asset_type, source, cert_valid, cert_error)
+		          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?)`
+		_, err = ex.Exec(query, domain.Domain, domain.Program, domain.Status, domain.StatusReason, domain.StatusCode, domain.FinalURL,
+			joinPorts(domain.OpenPorts), domain.DiscoveredAt, domain.LastChecked, domain.BountyEligible, domain.AssetType, domain.Source,
+			domain.CertValid, domain.CertError)
+		if err != nil {
+			return nil, err
+		}
+		domain.IsNew = true
+		return nil, saveDomainEvent(ex, domain)
 	} else if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if status changed (especially down to up)
+	var change *StatusChange
 	if oldStatus != domain.Status {
 		// Record status change (ignore errors if table doesn't exist yet)
+		changedAt := time.Now()
 		changeQuery := `INSERT INTO status_changes (domain, program, old_status, new_status, changed_at, notified)
 		                VALUES (?, ?, ?, ?, ?, 0)`
-		if _, err := db.Exec(changeQuery, domain.Domain, domain.Program, oldStatus, domain.Status, time.Now()); err != nil {
-			// Table might not exist yet, that's okay
-			_ = err
+		if result, err := ex.Exec(changeQuery, domain.Domain, domain.Program, oldStatus, domain.Status, changedAt); err == nil {
+			change = &StatusChange{
+				Domain:    domain.Domain,
+				Program:   domain.Program,
+				OldStatus: oldStatus,
+				NewStatus: domain.Status,
+				ChangedAt: changedAt,
+			}
+			change.ID, _ = result.LastInsertId()
 		}
-		
+
 		// If status changed from down to up, mark as important
 		if oldStatus == "down" && domain.Status == "up" {
-			log.Printf("🚨 STATUS CHANGE: %s changed from DOWN to UP in program %s", domain.Domain, domain.Program)
+			log.Printf("[STATUS CHANGE] %s changed from DOWN to UP in program %s", domain.Domain, domain.Program)
+		}
+
+		if err := saveDomainEvent(ex, domain); err != nil {
+			return nil, err
 		}
 	}
 
 	// Update existing domain
-	query := `UPDATE domains SET status = ?, last_checked = ?, is_new = ? WHERE id = ?`
-	_, err = db.Exec(query, domain.Status, domain.LastChecked, false, existingID)
+	domain.IsNew = false
+	query := `UPDATE domains SET status = ?, status_reason = ?, status_code = ?, final_url = ?, open_ports = ?, last_checked = ?,
+	          is_new = ?, bounty_eligible = ?, asset_type = ?, cert_valid = ?, cert_error = ? WHERE id = ?`
+	_, err = ex.Exec(query, domain.Status, domain.StatusReason, domain.StatusCode, domain.FinalURL,
+		joinPorts(domain.OpenPorts), domain.LastChecked, false, domain.BountyEligible, domain.AssetType,
+		domain.CertValid, domain.CertError, existingID)
+	return change, err
+}
+
+// saveDomainEvent adds the current status of a domain to its timeline
+func saveDomainEvent(ex execer, domain *Domain) error {
+	observedAt := domain.LastChecked
+	if observedAt.IsZero() {
+		observedAt = time.Now()
+	}
+	_, err := ex.Exec(`INSERT INTO domain_events (domain, program, status, status_reason, observed_at) VALUES (?, ?, ?, ?, ?)`,
+		domain.Domain, domain.Program, domain.Status, domain.StatusReason, observedAt)
 	return err
 }
 
-func (db *DB) GetNewDomains(limit int) ([]Domain, error) {
-	rows, err := db.Query(`SELECT id, domain, program, status, discovered_at, last_checked, is_new
-	                       FROM domains WHERE is_new = 1 ORDER BY discovered_at DESC LIMIT ?`, limit)
+// EnsureDomain records a domain without a health result. New domains are
+// inserted with their given status and IsNew set; existing rows are left
+// untouched so a lightweight scan never overwrites the status of a full one.
+func (db *DB) EnsureDomain(domain *Domain) error {
+	domain.Domain = domainutil.Normalize(domain.Domain)
+	if domain.Domain == "" {
+		return fmt.Errorf("empty domain")
+	}
+
+	query := `INSERT OR IGNORE INTO domains (domain, program, status, discovered_at, is_new, bounty_eligible, asset_type, source)
+	          VALUES (?, ?, ?, ?, 1, ?, ?, ?)`
+	result, err := db.Exec(query, domain.Domain, domain.Program, domain.Status, domain.DiscoveredAt,
+		domain.BountyEligible, domain.AssetType, domain.Source)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	inserted, err := result.RowsAffected()
+	domain.IsNew = inserted > 0
+	return err
+}
 
-	var domains []Domain
-	for rows.Next() {
-		var d Domain
-		if err := rows.Scan(&d.ID, &d.Domain, &d.Program, &d.Status, &d.DiscoveredAt, &d.LastChecked, &d.IsNew); err != nil {
-			return nil, err
-		}
-		domains = append(domains, d)
+// joinPorts stores a port list as "80,443"
+func joinPorts(ports []int) string {
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = strconv.Itoa(port)
 	}
-	return domains, nil
+	return strings.Join(parts, ",")
 }
 
-func (db *DB) GetDomainsByProgram(program string, limit int) ([]Domain, error) {
-	rows, err := db.Query(`SELECT id, domain, program, status, discovered_at, last_checked, is_new
-	                       FROM domains WHERE program = ? ORDER BY discovered_at DESC LIMIT ?`, program, limit)
-	if err != nil {
-		return nil, err
+// splitPorts reads a port list written by joinPorts
+func splitPorts(value string) []int {
+	var ports []int
+	for _, part := range strings.Split(value, ",") {
+		if port, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			ports = append(ports, port)
+		}
 	}
-	defer rows.Close()
+	return ports
+}
+
+// domainColumns is the column list read by scanDomains
+const domainColumns = `id, domain, program, status, COALESCE(status_reason, ''), COALESCE(status_code, 0),
+	COALESCE(final_url, ''), COALESCE(open_ports, ''), discovered_at, last_checked, is_new,
+	COALESCE(bounty_eligible, 0), COALESCE(asset_type, ''), COALESCE(source, ''), cert_valid, COALESCE(cert_error, '')`
 
-	var domains []Domain
+// scanDomains reads rows selected with domainColumns. last_checked may be
+// NULL for domains that were recorded but never health checked. No rows give
+// an empty slice, like scanPrograms.
+func scanDomains(rows *sql.Rows) ([]Domain, error) {
+	domains := []Domain{}
 	for rows.Next() {
-		var d Domain
-		if err := rows.Scan(&d.ID, &d.Domain, &d.Program, &d.Status, &d.DiscoveredAt, &d.LastChecked, &d.IsNew); err != nil {
+		d, err := scanDomain(rows)
+		if err != nil {
 			return nil, err
 		}
 		domains = append(domains, d)
 	}
-	return domains, nil
+	return domains, rows.Err()
 }
 
-func (db *DB) GetStats() (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
-
-	// Total domains
-	var totalDomains int
-	if err := db.QueryRow(`SELECT COUNT(*) FROM domains`).Scan(&totalDomains); err != nil {
-		return nil, err
+// scanDomain reads the current row of a domainColumns query
+func scanDomain(rows *sql.Rows) (Domain, error) {
+	var d Domain
+	var lastChecked sql.NullTime
+	var certValid sql.NullBool
+	var openPorts string
+	if err := rows.Scan(&d.ID, &d.Domain, &d.Program, &d.Status, &d.StatusReason, &d.StatusCode, &d.FinalURL, &openPorts, &d.DiscoveredAt, &lastChecked, &d.IsNew,
+		&d.BountyEligible, &d.AssetType, &d.Source, &certValid, &d.CertError); err != nil {
+		return d, err
 	}
-	stats["total_domains"] = totalDomains
+	d.LastChecked = lastChecked.Time
+	d.OpenPorts = splitPorts(openPorts)
+	if certValid.Valid {
+		d.CertValid = &certValid.Bool
+	}
+	return d, nil
+}
 
-	// New domains
-	var newDomains int
-	if err := db.QueryRow(`SELECT COUNT(*) FROM domains WHERE is_new = 1`).Scan(&newDomains); err != nil {
-		return nil, err
+// eachDomainPage is how many domains EachDomain reads per query
+const eachDomainPage = 500
+
+// EachDomain calls fn for every domain of program, or of all programs when
+// program is empty, ordered by ID. Domains are read a page at a time so large
+// exports don't load the table into memory, and the connection is released
+// between pages so a slow consumer doesn't block other queries. It stops at
+// the first error fn returns.
+func (db *DB) EachDomain(program string, fn func(Domain) error) error {
+	var lastID int64
+	for {
+		rows, err := db.Query(`SELECT `+domainColumns+`
+		                       FROM domains WHERE id > ? AND (? = '' OR program = ?)
+		                       ORDER BY id LIMIT ?`, lastID, program, program, eachDomainPage)
+		if err != nil {
+			return err
+		}
+		page, err := scanDomains(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, d := range page {
+			if err := fn(d); err != nil {
+				return err
+			}
+		}
+		if len(page) < eachDomainPage {
+			return nil
+		}
+		lastID = page[len(page)-1].ID
 	}
-	stats["new_domains"] = newDomains
+}
 
-	// Up domains
-	var upDomains int
-	if err := db.QueryRow(`SELECT COUNT(*) FROM domains WHERE status = 'up'`).Scan(&upDomains); err != nil {
+func (db *DB) GetNewDomains(limit int) ([]Domain, error) {
+	rows, err := db.Query(`SELECT `+domainColumns+`
+	                       FROM domains WHERE is_new = 1 ORDER BY discovered_at DESC LIMIT ?`, limit)
+	if err != nil {
 		return nil, err
 	}
-	stats["up_domains"] = upDomains
+	defer rows.Close()
+
+	return scanDomains(rows)
+}
+
+func (db *DB) GetDomainsByProgram(program string, limit int) ([]Domain, error) {
+	rows, err := db.Query(`SELECT `+domainColumns+`
+	                       FROM domains WHERE program = ? ORDER BY discovered_at DESC LIMIT ?`, program, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDomains(rows)
+}
+
+// GetBountyEligibleDomains returns the domains that fall under a bounty
+// eligible scope entry, newest first
+func (db *DB) GetBountyEligibleDomains(limit int) ([]Domain, error) {
+	return db.ListDomains(DomainFilter{BountyEligible: true, Limit: limit})
+}
+
+// ListDomains returns a page of the domains matching the filter, newest
+// first unless the filter sorts otherwise
+func (db *DB) ListDomains(filter DomainFilter) ([]Domain, error) {
+	where, args := filter.where()
+	orderBy, err := filter.orderBy()
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + domainColumns + ` FROM domains` + where + orderBy + " LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDomains(rows)
+}
+
+// CountDomainsMatching returns how many domains match the filter, ignoring
+// its limit and offset
+func (db *DB) CountDomainsMatching(filter DomainFilter) (int, error) {
+	where, args := filter.where()
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM domains`+where, args...).Scan(&count)
+	return count, err
+}
+
+// ListDomainsPaged returns a page of the domains matching the filter and the
+// total number of matches
+func (db *DB) ListDomainsPaged(filter DomainFilter) ([]Domain, int, error) {
+	total, err := db.CountDomainsMatching(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	domains, err := db.ListDomains(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return domains, total, nil
+}
+
+// GetNewDomainsPaged returns a page of the new domains and their total count
+func (db *DB) GetNewDomainsPaged(limit, offset int) ([]Domain, int, error) {
+	return db.ListDomainsPaged(DomainFilter{OnlyNew: true, Limit: limit, Offset: offset})
+}
+
+// GetDomainsByProgramPaged returns a page of a program's domains and their
+// total count
+func (db *DB) GetDomainsByProgramPaged(program string, limit, offset int) ([]Domain, int, error) {
+	return db.ListDomainsPaged(DomainFilter{Program: program, Limit: limit, Offset: offset})
+}
+
+// GetLiveDomains returns the names of the domains that are up, of one
+// program or of all programs when program is empty, in alphabetical order.
+// A domain listed under several programs appears once.
+func (db *DB) GetLiveDomains(program string) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT domain FROM domains
+	                       WHERE status = 'up' AND (? = '' OR program = ?) ORDER BY domain`, program, program)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
+}
+
+// likeEscaper escapes the LIKE wildcards in user input; queries using it
+// declare ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchDomains returns domains of any program containing pattern, case
+// insensitively, ordered by name. A substring match can't use the domain
+// index, so the limit is what bounds the work.
+func (db *DB) SearchDomains(pattern string, limit int) ([]Domain, error) {
+	rows, err := db.Query(`SELECT `+domainColumns+`
+	                       FROM domains WHERE domain LIKE ? ESCAPE '\'
+	                       ORDER BY domain, program LIMIT ?`, "%"+likeEscaper.Replace(pattern)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDomains(rows)
+}
+
+// GetDomainsDiscoveredSince returns the domains first discovered at or after
+// the given time, newest first
+func (db *DB) GetDomainsDiscoveredSince(since time.Time) ([]Domain, error) {
+	rows, err := db.Query(`SELECT `+domainColumns+`
+	                       FROM domains WHERE discovered_at >= ? ORDER BY discovered_at DESC`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDomains(rows)
+}
+
+// GetStaleDomains returns domains whose last check is older than the given
+// duration, oldest first
+func (db *DB) GetStaleDomains(olderThan time.Duration, limit int) ([]Domain, error) {
+	cutoff := time.Now().Add(-olderThan)
+	rows, err := db.Query(`SELECT `+domainColumns+`
+	                       FROM domains WHERE last_checked < ? ORDER BY last_checked ASC LIMIT ?`, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDomains(rows)
+}
+
+// GetDomainsWithoutInfo returns live domains that have no domain_info row,
+// i.e. enrichment never ran or failed for them
+func (db *DB) GetDomainsWithoutInfo(limit int) ([]Domain, error) {
+	rows, err := db.Query(`SELECT `+domainColumns+`
+	                       FROM domains WHERE status = 'up' AND domain NOT IN (SELECT domain FROM domain_info)
+	                       ORDER BY last_checked DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDomains(rows)
+}
+
+func (db *DB) GetStats() (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+
+	// Total domains
+	var totalDomains int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM domains`).Scan(&totalDomains); err != nil {
+		return nil, err
+	}
+	stats["total_domains"] = totalDomains
+
+	// New domains
+	var newDomains int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM domains WHERE is_new = 1`).Scan(&newDomains); err != nil {
+		return nil, err
+	}
+	stats["new_domains"] = newDomains
+
+	// Up domains
+	var upDomains int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM domains WHERE status = 'up'`).Scan(&upDomains); err != nil {
+		return nil, err
+	}
+	stats["up_domains"] = upDomains
 
 	// Down domains
 	var downDomains int
@@ -411,6 +1206,13 @@ func (db *DB) GetStats() (map[string]interface{}, error) {
 	}
 	stats["down_domains"] = downDomains
 
+	// Domains resolving to private addresses
+	var internalDomains int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM domains WHERE status = ?`, StatusUnreachableInternal).Scan(&internalDomains); err != nil {
+		return nil, err
+	}
+	stats["internal_domains"] = internalDomains
+
 	// Total programs
 	var totalPrograms int
 	if err := db.QueryRow(`SELECT COUNT(*) FROM programs`).Scan(&totalPrograms); err != nil {
@@ -421,6 +1223,13 @@ func (db *DB) GetStats() (map[string]interface{}, error) {
 	return stats, nil
 }
 
+// CountDomains returns the number of stored domains
+func (db *DB) CountDomains() (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM domains`).Scan(&count)
+	return count, err
+}
+
 func (db *DB) MarkDomainsAsOld() error {
 	_, err := db.Exec(`UPDATE domains SET is_new = 0 WHERE is_new = 1`)
 	return err
@@ -461,32 +1270,510 @@ func (db *DB) GetStatusChanges(limit int, onlyUnnotified bool) ([]StatusChange,
 	return changes, nil
 }
 
+// GetUnnotifiedStatusChanges returns up to limit status changes that were not
+// notified yet, oldest first
+func (db *DB) GetUnnotifiedStatusChanges(limit int) ([]StatusChange, error) {
+	rows, err := db.Query(`SELECT id, domain, program, old_status, new_status, changed_at, notified
+	                       FROM status_changes WHERE notified = 0 ORDER BY changed_at, id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []StatusChange
+	for rows.Next() {
+		var sc StatusChange
+		if err := rows.Scan(&sc.ID, &sc.Domain, &sc.Program, &sc.OldStatus, &sc.NewStatus, &sc.ChangedAt, &sc.Notified); err != nil {
+			return nil, err
+		}
+		changes = append(changes, sc)
+	}
+	return changes, rows.Err()
+}
+
+// GetStatusChangesSince returns the status changes recorded at or after the
+// given time, newest first
+func (db *DB) GetStatusChangesSince(since time.Time) ([]StatusChange, error) {
+	rows, err := db.Query(`SELECT id, domain, program, old_status, new_status, changed_at, notified
+	                       FROM status_changes WHERE changed_at >= ? ORDER BY changed_at DESC`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []StatusChange
+	for rows.Next() {
+		var sc StatusChange
+		if err := rows.Scan(&sc.ID, &sc.Domain, &sc.Program, &sc.OldStatus, &sc.NewStatus, &sc.ChangedAt, &sc.Notified); err != nil {
+			return nil, err
+		}
+		changes = append(changes, sc)
+	}
+	return changes, rows.Err()
+}
+
+// MarkStatusChangeNotified marks a single status change as notified. It
+// returns sql.ErrNoRows if no change has the given id.
 func (db *DB) MarkStatusChangeNotified(id int64) error {
-	_, err := db.Exec(`UPDATE status_changes SET notified = 1 WHERE id = ?`, id)
+	result, err := db.Exec(`UPDATE status_changes SET notified = 1 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkAllStatusChangesNotified marks every unnotified status change as
+// notified and returns how many were cleared
+func (db *DB) MarkAllStatusChangesNotified() (int64, error) {
+	result, err := db.Exec(`UPDATE status_changes SET notified = 1 WHERE notified = 0`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SaveAlert records an alert. An identical alert (same type, domain, program
+// and detail) is only stored once; created reports whether it was new.
+func (db *DB) SaveAlert(alert *Alert) (created bool, err error) {
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+	result, err := db.Exec(`INSERT OR IGNORE INTO alerts (type, domain, program, detail, created_at, notified)
+	                        VALUES (?, ?, ?, ?, ?, 0)`,
+		alert.Type, alert.Domain, alert.Program, alert.Detail, alert.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected > 0 {
+		alert.ID, _ = result.LastInsertId()
+	}
+	return affected > 0, nil
+}
+
+// GetAlerts returns the most recent alerts of a type, or of every type when
+// alertType is empty
+func (db *DB) GetAlerts(alertType string, limit int) ([]Alert, error) {
+	rows, err := db.Query(`SELECT id, type, domain, program, detail, created_at, notified
+	                       FROM alerts WHERE ? = '' OR type = ? ORDER BY created_at DESC LIMIT ?`,
+		alertType, alertType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		var a Alert
+		if err := rows.Scan(&a.ID, &a.Type, &a.Domain, &a.Program, &a.Detail, &a.CreatedAt, &a.Notified); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// GetUnnotifiedAlerts returns up to limit alerts of any type that were not
+// delivered to the notifiers yet, oldest first
+func (db *DB) GetUnnotifiedAlerts(limit int) ([]Alert, error) {
+	rows, err := db.Query(`SELECT id, type, domain, program, detail, created_at, notified
+	                       FROM alerts WHERE notified = 0 ORDER BY created_at, id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []Alert
+	for rows.Next() {
+		var a Alert
+		if err := rows.Scan(&a.ID, &a.Type, &a.Domain, &a.Program, &a.Detail, &a.CreatedAt, &a.Notified); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// MarkAlertNotified marks an alert as delivered
+func (db *DB) MarkAlertNotified(id int64) error {
+	_, err := db.Exec(`UPDATE alerts SET notified = 1 WHERE id = ?`, id)
+	return err
+}
+
+// RecordProgramDomainCount logs how many domains a scan found for a program
+func (db *DB) RecordProgramDomainCount(program string, count int) error {
+	_, err := db.Exec(`INSERT INTO program_domain_counts (program, domain_count, scanned_at) VALUES (?, ?, ?)`,
+		program, count, time.Now())
+	return err
+}
+
+// GetLastProgramDomainCount returns the domain count recorded by the previous
+// scan of a program. ok is false if the program was never counted.
+func (db *DB) GetLastProgramDomainCount(program string) (count int, ok bool, err error) {
+	err = db.QueryRow(`SELECT domain_count FROM program_domain_counts WHERE program = ?
+	                   ORDER BY scanned_at DESC, id DESC LIMIT 1`, program).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return count, true, nil
+}
+
+// LoadCursor returns a stored pagination cursor; next is empty if none is
+// stored under key
+func (db *DB) LoadCursor(key string) (next string, state []byte, savedAt time.Time, err error) {
+	err = db.QueryRow(`SELECT next_url, state, saved_at FROM fetch_cursors WHERE key = ?`, key).
+		Scan(&next, &state, &savedAt)
+	if err == sql.ErrNoRows {
+		return "", nil, time.Time{}, nil
+	}
+	return next, state, savedAt, err
+}
+
+// SaveCursor stores a pagination cursor, replacing any previous one
+func (db *DB) SaveCursor(key, next string, state []byte) error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO fetch_cursors (key, next_url, state, saved_at) VALUES (?, ?, ?, ?)`,
+		key, next, state, time.Now())
+	return err
+}
+
+// DeleteCursor removes a pagination cursor
+func (db *DB) DeleteCursor(key string) error {
+	_, err := db.Exec(`DELETE FROM fetch_cursors WHERE key = ?`, key)
+	return err
+}
+
+// GetCachedScope returns the scope cached for a program if it was fetched
+// less than maxAge ago. The scope is stored as the caller encoded it: the
+// scheduler needs every entry's asset type and eligibility, which a list of
+// domain names would lose, and the TTL comes from its configuration.
+func (db *DB) GetCachedScope(handle string, maxAge time.Duration) ([]byte, bool) {
+	var scope []byte
+	var fetchedAt time.Time
+	err := db.QueryRow(`SELECT scope, fetched_at FROM scope_cache WHERE handle = ?`, handle).
+		Scan(&scope, &fetchedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error reading cached scope for %s: %v", handle, err)
+		}
+		return nil, false
+	}
+	if time.Since(fetchedAt) > maxAge {
+		return nil, false
+	}
+	return scope, true
+}
+
+// SaveCachedScope stores the scope of a program with the current time
+func (db *DB) SaveCachedScope(handle string, scope []byte) error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO scope_cache (handle, scope, fetched_at) VALUES (?, ?, ?)`,
+		handle, scope, time.Now())
 	return err
 }
 
+// SaveDomainCheck appends a health check result to the check history
+func (db *DB) SaveDomainCheck(check *DomainCheck) error {
+	return saveDomainCheck(db, check)
+}
+
+// SaveDomainChecks appends the results of a scan to the check history in a
+// single transaction
+func (db *DB) SaveDomainChecks(checks []DomainCheck) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range checks {
+		if err := saveDomainCheck(tx, &checks[i]); err != nil {
+			return fmt.Errorf("save check history %s: %w", checks[i].Domain, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func saveDomainCheck(ex execer, check *DomainCheck) error {
+	check.Domain = domainutil.Normalize(check.Domain)
+	if check.CheckedAt.IsZero() {
+		check.CheckedAt = time.Now()
+	}
+
+	_, err := ex.Exec(`INSERT INTO domain_checks (domain, program, status, status_reason, status_code, checked_at)
+	                   VALUES (?, ?, ?, ?, ?, ?)`,
+		check.Domain, check.Program, check.Status, check.StatusReason, check.StatusCode, check.CheckedAt)
+	return err
+}
+
+// GetDomainChecks returns the most recent checks of a domain across all
+// programs, newest first. It returns sql.ErrNoRows for unknown domains.
+func (db *DB) GetDomainChecks(domain string, limit int) ([]DomainCheck, error) {
+	domain = domainutil.Normalize(domain)
+	if err := db.domainExists(domain); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT id, domain, program, status, COALESCE(status_reason, ''), status_code, checked_at
+	                       FROM domain_checks WHERE domain = ? ORDER BY checked_at DESC LIMIT ?`,
+		domain, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := []DomainCheck{}
+	for rows.Next() {
+		var c DomainCheck
+		if err := rows.Scan(&c.ID, &c.Domain, &c.Program, &c.Status, &c.StatusReason, &c.StatusCode, &c.CheckedAt); err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, rows.Err()
+}
+
+// GetDomainHistory returns the status timeline of a domain across all
+// programs, oldest first. It returns sql.ErrNoRows for unknown domains.
+func (db *DB) GetDomainHistory(domain string) ([]DomainEvent, error) {
+	domain = domainutil.Normalize(domain)
+	if err := db.domainExists(domain); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT id, domain, program, status, COALESCE(status_reason, ''), observed_at
+	                       FROM domain_events WHERE domain = ? ORDER BY observed_at, id`, domain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []DomainEvent{}
+	for rows.Next() {
+		var e DomainEvent
+		if err := rows.Scan(&e.ID, &e.Domain, &e.Program, &e.Status, &e.StatusReason, &e.ObservedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// domainExists returns sql.ErrNoRows unless some program has the domain
+func (db *DB) domainExists(domain string) error {
+	var id int64
+	return db.QueryRow(`SELECT id FROM domains WHERE domain = ? LIMIT 1`, domain).Scan(&id)
+}
+
+// GetDomainTimeline returns when a domain was first discovered and when its
+// status last changed. It returns sql.ErrNoRows for unknown domains.
+func (db *DB) GetDomainTimeline(domain string) (*DomainTimeline, error) {
+	timeline := &DomainTimeline{Domain: domainutil.Normalize(domain)}
+	err := db.QueryRow(`SELECT discovered_at FROM domains WHERE domain = ? ORDER BY discovered_at LIMIT 1`,
+		timeline.Domain).Scan(&timeline.FirstSeen)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.QueryRow(`SELECT COUNT(*) FROM status_changes WHERE domain = ?`,
+		timeline.Domain).Scan(&timeline.StatusChanges); err != nil {
+		return nil, err
+	}
+	if timeline.StatusChanges > 0 {
+		var lastChanged time.Time
+		err := db.QueryRow(`SELECT changed_at FROM status_changes WHERE domain = ? ORDER BY changed_at DESC LIMIT 1`,
+			timeline.Domain).Scan(&lastChanged)
+		if err != nil {
+			return nil, err
+		}
+		timeline.LastChanged = &lastChanged
+	}
+	return timeline, nil
+}
+
+// GetStatusCodeBreakdown counts a program's domains by the HTTP status code of
+// their last check; code 0 means no HTTP response was received. It reads the
+// domains table because domain_checks is pruned to CHECK_HISTORY_RETENTION.
+func (db *DB) GetStatusCodeBreakdown(program string) (map[int]int, error) {
+	rows, err := db.Query(`SELECT COALESCE(status_code, 0), COUNT(*) FROM domains
+	                       WHERE program = ? GROUP BY COALESCE(status_code, 0)`, program)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := make(map[int]int)
+	for rows.Next() {
+		var code, count int
+		if err := rows.Scan(&code, &count); err != nil {
+			return nil, err
+		}
+		breakdown[code] = count
+	}
+	return breakdown, rows.Err()
+}
+
+// SourceStats counts the domains a discovery source contributed
+type SourceStats struct {
+	Source  string `json:"source"`
+	Domains int    `json:"domains"`
+	Up      int    `json:"up"`
+}
+
+// GetSourceStats groups domains by the source that found them. Domains
+// recorded before sources were tracked are counted as "unknown".
+func (db *DB) GetSourceStats() ([]SourceStats, error) {
+	rows, err := db.Query(`SELECT COALESCE(NULLIF(source, ''), 'unknown') AS src, COUNT(*),
+	                              SUM(CASE WHEN status = 'up' THEN 1 ELSE 0 END)
+	                       FROM domains GROUP BY src ORDER BY COUNT(*) DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []SourceStats{}
+	for rows.Next() {
+		var st SourceStats
+		if err := rows.Scan(&st.Source, &st.Domains, &st.Up); err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// PruneDomainChecks deletes check history older than the retention window
+func (db *DB) PruneDomainChecks(retention time.Duration) (int64, error) {
+	result, err := db.Exec(`DELETE FROM domain_checks WHERE checked_at < ?`, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PruneDomainEvents deletes status timeline events older than the retention
+// window
+func (db *DB) PruneDomainEvents(retention time.Duration) (int64, error) {
+	result, err := db.Exec(`DELETE FROM domain_events WHERE observed_at < ?`, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PruneStaleDomains deletes domains that were not checked within olderThan,
+// falling back to their discovery time for domains never checked, together
+// with their enrichment data, timeline, findings and screenshot records. It
+// returns the number of deleted domains.
+func (db *DB) PruneStaleDomains(olderThan time.Duration) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM domains WHERE COALESCE(last_checked, discovered_at) < ?`,
+		time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM domain_info WHERE domain NOT IN (SELECT domain FROM domains)`); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM domain_events WHERE domain NOT IN (SELECT domain FROM domains)`); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM findings WHERE domain NOT IN (SELECT domain FROM domains)`); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM screenshots WHERE domain NOT IN (SELECT domain FROM domains)`); err != nil {
+		return 0, err
+	}
+	return int(pruned), tx.Commit()
+}
+
+// PruneStatusChanges keeps the newest keep status changes and deletes the
+// rest, returning the number of deleted rows
+func (db *DB) PruneStatusChanges(keep int) (int, error) {
+	result, err := db.Exec(`DELETE FROM status_changes WHERE id NOT IN
+	                        (SELECT id FROM status_changes ORDER BY changed_at DESC, id DESC LIMIT ?)`, keep)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := db.Exec(`DELETE FROM notification_deliveries WHERE kind = ?
+	                      AND item_id NOT IN (SELECT id FROM status_changes)`, DeliveryStatusChange); err != nil {
+		return 0, err
+	}
+	return int(pruned), nil
+}
+
 func (db *DB) SaveDomainInfo(info *DomainInfo) error {
-	techsStr := strings.Join(info.Technologies, ",")
-	query := `INSERT OR REPLACE INTO domain_info (domain, program, status, title, status_code, technologies, last_checked, updated_at)
-	          VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := db.Exec(query, info.Domain, info.Program, info.Status, info.Title, 
-		info.StatusCode, techsStr, info.LastChecked, time.Now())
+	techsStr := encodeTechnologies(info.Technologies)
+	query := `INSERT OR REPLACE INTO domain_info (domain, program, status, title, status_code, server, technologies, favicon_hash,
+	                                              last_checked, updated_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, domainutil.Normalize(info.Domain), info.Program, info.Status, info.Title, 
+		info.StatusCode, info.Server, techsStr, info.FaviconHash, info.LastChecked, time.Now())
 	return err
 }
 
+// GetDomainInfo returns the enrichment details of a domain, or sql.ErrNoRows
+// if it was never enriched
 func (db *DB) GetDomainInfo(domain string) (*DomainInfo, error) {
 	var info DomainInfo
 	var techsStr string
-	err := db.QueryRow(`SELECT domain, program, status, title, status_code, technologies, last_checked
-	                    FROM domain_info WHERE domain = ?`, domain).
+	var lastChecked sql.NullTime
+	err := db.QueryRow(`SELECT domain, program, COALESCE(status, ''), COALESCE(title, ''), COALESCE(status_code, 0),
+	                           COALESCE(server, ''), COALESCE(technologies, ''), favicon_hash, last_checked
+	                    FROM domain_info WHERE domain = ?`, domainutil.Normalize(domain)).
 		Scan(&info.Domain, &info.Program, &info.Status, &info.Title, 
-			&info.StatusCode, &techsStr, &info.LastChecked)
+			&info.StatusCode, &info.Server, &techsStr, &info.FaviconHash, &lastChecked)
 	if err != nil {
 		return nil, err
 	}
-	if techsStr != "" {
-		info.Technologies = strings.Split(techsStr, ",")
-	}
+	info.Technologies = decodeTechnologies(techsStr)
+	info.LastChecked = lastChecked.Time
 	return &info, nil
 }
+
+// GetDomainsByFaviconHash returns the enriched domains whose favicon has the
+// given hash, which often points to related infrastructure
+func (db *DB) GetDomainsByFaviconHash(hash int32) ([]DomainInfo, error) {
+	rows, err := db.Query(`SELECT domain, program, COALESCE(status, ''), COALESCE(title, ''), COALESCE(status_code, 0),
+	                              COALESCE(server, ''), COALESCE(technologies, ''), favicon_hash, last_checked
+	                       FROM domain_info WHERE favicon_hash = ? ORDER BY program, domain`, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := []DomainInfo{}
+	for rows.Next() {
+		var info DomainInfo
+		var techs string
+		var lastChecked sql.NullTime
+		if err := rows.Scan(&info.Domain, &info.Program, &info.Status, &info.Title,
+			&info.StatusCode, &info.Server, &techs, &info.FaviconHash, &lastChecked); err != nil {
+			return nil, err
+		}
+		info.Technologies = decodeTechnologies(techs)
+		info.LastChecked = lastChecked.Time
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
@@ -0,0 +1,496 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestEachDomain(t *testing.T) {
+	db := newTestDB(t)
+
+	var domains []Domain
+	for i := 0; i < 2*eachDomainPage+3; i++ {
+		program := "alpha"
+		if i%3 == 0 {
+			program = "beta"
+		}
+		domains = append(domains, Domain{
+			Domain:       fmt.Sprintf("host%d.example.com", i),
+			Program:      program,
+			Status:       "up",
+			DiscoveredAt: time.Now(),
+		})
+	}
+	if _, _, err := db.SaveDomains(domains); err != nil {
+		t.Fatalf("SaveDomains: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		program string
+		want    int
+	}{
+		{name: "all programs", program: "", want: 2*eachDomainPage + 3},
+		{name: "one program", program: "beta", want: (2*eachDomainPage + 3 + 2) / 3},
+		{name: "unknown program", program: "gamma", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[string]bool)
+			var lastID int64
+			err := db.EachDomain(tt.program, func(d Domain) error {
+				if seen[d.Domain] {
+					t.Errorf("domain %s visited twice", d.Domain)
+				}
+				seen[d.Domain] = true
+				if d.ID <= lastID {
+					t.Errorf("domain %s has ID %d after %d", d.Domain, d.ID, lastID)
+				}
+				lastID = d.ID
+				if tt.program != "" && d.Program != tt.program {
+					t.Errorf("domain %s of program %s, want %s", d.Domain, d.Program, tt.program)
+				}
+				// Other queries must not wait for the export to finish
+				if _, err := db.CountDomains(); err != nil {
+					return err
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("EachDomain: %v", err)
+			}
+			if len(seen) != tt.want {
+				t.Errorf("visited %d domains, want %d", len(seen), tt.want)
+			}
+		})
+	}
+}
+
+func TestGetUnnotifiedAlerts(t *testing.T) {
+	db := newTestDB(t)
+
+	start := time.Now().Add(-time.Hour)
+	alerts := []Alert{
+		{Type: AlertTypeSurge, Program: "p", Detail: "10 -> 100 domains", CreatedAt: start},
+		{Type: AlertTypeTech, Domain: "a.example.com", Program: "p", Detail: "Jenkins", CreatedAt: start.Add(time.Minute)},
+		{Type: AlertTypeTechChange, Domain: "b.example.com", Program: "p", Detail: "nginx", CreatedAt: start.Add(2 * time.Minute)},
+	}
+	for i := range alerts {
+		if _, err := db.SaveAlert(&alerts[i]); err != nil {
+			t.Fatalf("SaveAlert: %v", err)
+		}
+	}
+	if err := db.MarkAlertNotified(alerts[1].ID); err != nil {
+		t.Fatalf("MarkAlertNotified: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{name: "every type, oldest first", limit: 10, want: []string{AlertTypeSurge, AlertTypeTechChange}},
+		{name: "limited", limit: 1, want: []string{AlertTypeSurge}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetUnnotifiedAlerts(tt.limit)
+			if err != nil {
+				t.Fatalf("GetUnnotifiedAlerts: %v", err)
+			}
+			var types []string
+			for _, alert := range got {
+				types = append(types, alert.Type)
+			}
+			if fmt.Sprint(types) != fmt.Sprint(tt.want) {
+				t.Errorf("types = %v, want %v", types, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainsPaged(t *testing.T) {
+	db := newTestDB(t)
+
+	var domains []Domain
+	for i := 0; i < 5; i++ {
+		program := "alpha"
+		if i%2 == 1 {
+			program = "beta"
+		}
+		domains = append(domains, Domain{
+			Domain:       fmt.Sprintf("host%d.example.com", i),
+			Program:      program,
+			Status:       "up",
+			DiscoveredAt: time.Now().Add(time.Duration(i) * time.Minute),
+		})
+	}
+	if _, _, err := db.SaveDomains(domains); err != nil {
+		t.Fatalf("SaveDomains: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		list      func() ([]Domain, int, error)
+		wantPage  []string
+		wantTotal int
+	}{
+		{
+			name:      "program, first page",
+			list:      func() ([]Domain, int, error) { return db.GetDomainsByProgramPaged("alpha", 2, 0) },
+			wantPage:  []string{"host4.example.com", "host2.example.com"},
+			wantTotal: 3,
+		},
+		{
+			name:      "program, last page",
+			list:      func() ([]Domain, int, error) { return db.GetDomainsByProgramPaged("alpha", 2, 2) },
+			wantPage:  []string{"host0.example.com"},
+			wantTotal: 3,
+		},
+		{
+			name:      "new domains",
+			list:      func() ([]Domain, int, error) { return db.GetNewDomainsPaged(3, 1) },
+			wantPage:  []string{"host3.example.com", "host2.example.com", "host1.example.com"},
+			wantTotal: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total, err := tt.list()
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			var names []string
+			for _, d := range page {
+				names = append(names, d.Domain)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.wantPage) || total != tt.wantTotal {
+				t.Errorf("got %v of %d, want %v of %d", names, total, tt.wantPage, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestSaveDomainsSkipsFailingRows(t *testing.T) {
+	db := newTestDB(t)
+	// Reject one domain the way a constraint or a full disk would
+	if _, err := db.Exec(`CREATE TRIGGER reject_bad BEFORE INSERT ON domains
+	                      WHEN NEW.domain = 'bad.example.com' BEGIN SELECT RAISE(ABORT, 'rejected'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		domains     []string
+		wantSkipped []int
+	}{
+		{name: "all saved", domains: []string{"a.example.com", "b.example.com"}},
+		{name: "bad row in the middle", domains: []string{"c.example.com", "bad.example.com", "d.example.com"}, wantSkipped: []int{1}},
+		{name: "only a bad row", domains: []string{"bad.example.com"}, wantSkipped: []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var domains []Domain
+			for _, name := range tt.domains {
+				domains = append(domains, Domain{Domain: name, Program: "p", Status: "up", DiscoveredAt: time.Now()})
+			}
+			_, skipped, err := db.SaveDomains(domains)
+			if err != nil {
+				t.Fatalf("SaveDomains: %v", err)
+			}
+			if len(skipped) != len(tt.wantSkipped) {
+				t.Errorf("skipped %v, want indexes %v", skipped, tt.wantSkipped)
+			}
+			for _, i := range tt.wantSkipped {
+				if skipped[i] == nil {
+					t.Errorf("domain %d not skipped", i)
+				}
+			}
+
+			for i, name := range tt.domains {
+				var count int
+				if err := db.QueryRow(`SELECT COUNT(*) FROM domains WHERE domain = ?`, name).Scan(&count); err != nil {
+					t.Fatalf("count %s: %v", name, err)
+				}
+				want := 1
+				if skipped[i] != nil {
+					want = 0
+				}
+				if count != want {
+					t.Errorf("%s stored %d times, want %d", name, count, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedScope(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.SaveCachedScope("fresh", []byte(`[{"identifier":"example.com"}]`)); err != nil {
+		t.Fatalf("SaveCachedScope: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO scope_cache (handle, scope, fetched_at) VALUES (?, ?, ?)`,
+		"stale", []byte(`[]`), time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatalf("insert stale scope: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		handle string
+		maxAge time.Duration
+		want   string
+		wantOK bool
+	}{
+		{name: "fresh", handle: "fresh", maxAge: time.Hour, want: `[{"identifier":"example.com"}]`, wantOK: true},
+		{name: "expired", handle: "stale", maxAge: time.Hour},
+		{name: "within a longer TTL", handle: "stale", maxAge: 3 * time.Hour, want: `[]`, wantOK: true},
+		{name: "missing", handle: "unknown", maxAge: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := db.GetCachedScope(tt.handle, tt.maxAge)
+			if ok != tt.wantOK || string(got) != tt.want {
+				t.Errorf("GetCachedScope(%q, %v) = %q, %v, want %q, %v", tt.handle, tt.maxAge, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestListDomainsByPlatform(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, p := range []Program{
+		{Name: "H1", Handle: "h1", Source: ProgramSourceHackerOne},
+		{Name: "Imported", Handle: "imported", Source: ProgramSourceManual},
+	} {
+		if err := db.SaveProgram(&p); err != nil {
+			t.Fatalf("SaveProgram: %v", err)
+		}
+	}
+	domains := []Domain{
+		{Domain: "a.example.com", Program: "h1", Source: "subfinder", DiscoveredAt: time.Now()},
+		{Domain: "b.example.com", Program: "imported", Source: ProgramSourceManual, DiscoveredAt: time.Now()},
+		{Domain: "c.example.com", Program: "imported", Source: "scope", DiscoveredAt: time.Now()},
+	}
+	if _, _, err := db.SaveDomains(domains); err != nil {
+		t.Fatalf("SaveDomains: %v", err)
+	}
+
+	tests := []struct {
+		platform string
+		want     int
+	}{
+		{ProgramSourceHackerOne, 1},
+		{ProgramSourceManual, 2},
+		{"bugcrowd", 0},
+		{"", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got, err := db.ListDomains(DomainFilter{Platform: tt.platform, Limit: 10})
+			if err != nil {
+				t.Fatalf("ListDomains: %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("platform %q: %d domains, want %d", tt.platform, len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyListsEncodeAsArrays(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name string
+		list func() (interface{}, error)
+	}{
+		{"alerts", func() (interface{}, error) { return db.GetAlerts("", 10) }},
+		{"scan runs", func() (interface{}, error) { return db.GetScanRuns(10) }},
+		{"stale domains", func() (interface{}, error) { return db.GetStaleDomains(time.Hour, 10) }},
+		{"programs by source", func() (interface{}, error) { return db.GetProgramsBySource("bugcrowd") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := tt.list()
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			data, err := json.Marshal(list)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(data) != "[]" {
+				t.Errorf("encoded as %s, want []", data)
+			}
+		})
+	}
+}
+
+func TestGetStatusCodeBreakdown(t *testing.T) {
+	db := newTestDB(t)
+
+	domains := []Domain{
+		{Domain: "a.example.com", Program: "p", Status: "up", StatusCode: 200},
+		{Domain: "b.example.com", Program: "p", Status: "up", StatusCode: 200},
+		{Domain: "c.example.com", Program: "p", Status: "up", StatusCode: 404},
+		{Domain: "d.example.com", Program: "p", Status: "down"},
+		{Domain: "e.example.com", Program: "q", Status: "up", StatusCode: 500},
+	}
+	for i := range domains {
+		domains[i].DiscoveredAt = time.Now()
+	}
+	if _, _, err := db.SaveDomains(domains); err != nil {
+		t.Fatalf("SaveDomains: %v", err)
+	}
+	// Domains whose check history was pruned are still counted
+	if _, err := db.Exec(`DELETE FROM domain_checks`); err != nil {
+		t.Fatalf("prune checks: %v", err)
+	}
+
+	tests := []struct {
+		program string
+		want    map[int]int
+	}{
+		{"p", map[int]int{200: 2, 404: 1, 0: 1}},
+		{"q", map[int]int{500: 1}},
+		{"unknown", map[int]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.program, func(t *testing.T) {
+			got, err := db.GetStatusCodeBreakdown(tt.program)
+			if err != nil {
+				t.Fatalf("GetStatusCodeBreakdown: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("breakdown = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainLookupsUseIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Init(path)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	// Simulate a database from before drop_idx_domains_domain
+	if _, err := db.Exec(`CREATE INDEX idx_domains_domain ON domains(domain)`); err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM schema_migrations WHERE name = 'drop_idx_domains_domain'`); err != nil {
+		t.Fatalf("reset migration: %v", err)
+	}
+	db.Close()
+	if db, err = Init(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"by domain", `SELECT id FROM domains WHERE domain = 'a.example.com'`},
+		{"by domain and program", `SELECT id FROM domains WHERE domain = 'a.example.com' AND program = 'p'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := db.Query(`EXPLAIN QUERY PLAN ` + tt.query)
+			if err != nil {
+				t.Fatalf("EXPLAIN: %v", err)
+			}
+			defer rows.Close()
+			var plan []string
+			for rows.Next() {
+				var id, parent, unused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+					t.Fatalf("Scan: %v", err)
+				}
+				plan = append(plan, detail)
+			}
+			if len(plan) == 0 || !strings.Contains(plan[0], "INDEX sqlite_autoindex_domains") {
+				t.Errorf("plan = %v, want a search on the UNIQUE(domain, program) index", plan)
+			}
+		})
+	}
+}
+
+func TestDataMigrationsRunOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Init(path)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	// Simulate a database from before alerts_backlog_notified
+	backlog := &Alert{Type: AlertTypeSurge, Program: "p", Detail: "10 -> 100 domains"}
+	if _, err := db.SaveAlert(backlog); err != nil {
+		t.Fatalf("SaveAlert: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM schema_migrations`); err != nil {
+		t.Fatalf("reset migrations: %v", err)
+	}
+	db.Close()
+
+	tests := []struct {
+		name string
+		// alert is saved before reopening the database
+		alert *Alert
+		want  []string
+	}{
+		{name: "backlog marked notified on upgrade", want: nil},
+		{
+			name:  "later alerts untouched on restart",
+			alert: &Alert{Type: AlertTypeTech, Domain: "a.example.com", Program: "p", Detail: "Jenkins"},
+			want:  []string{AlertTypeTech},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.alert != nil {
+				db, err := Init(path)
+				if err != nil {
+					t.Fatalf("Init: %v", err)
+				}
+				if _, err := db.SaveAlert(tt.alert); err != nil {
+					t.Fatalf("SaveAlert: %v", err)
+				}
+				db.Close()
+			}
+
+			db, err := Init(path)
+			if err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			defer db.Close()
+			alerts, err := db.GetUnnotifiedAlerts(10)
+			if err != nil {
+				t.Fatalf("GetUnnotifiedAlerts: %v", err)
+			}
+			var types []string
+			for _, alert := range alerts {
+				types = append(types, alert.Type)
+			}
+			if fmt.Sprint(types) != fmt.Sprint(tt.want) {
+				t.Errorf("unnotified alerts = %v, want %v", types, tt.want)
+			}
+		})
+	}
+}
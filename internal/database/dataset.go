@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DatasetVersion is the format version written by ExportDataset. Imports of
+// other versions are rejected.
+const DatasetVersion = 1
+
+// ErrUnsupportedDataset is returned for datasets of another format version
+var ErrUnsupportedDataset = errors.New("unsupported dataset version")
+
+// Dataset is a full copy of the scan data used to move an installation to
+// another machine
+type Dataset struct {
+	Version       int            `json:"version"`
+	ExportedAt    time.Time      `json:"exported_at"`
+	Programs      []Program      `json:"programs"`
+	Domains       []Domain       `json:"domains"`
+	DomainInfo    []DomainInfo   `json:"domain_info"`
+	StatusChanges []StatusChange `json:"status_changes"`
+}
+
+// ImportStats counts the rows an import inserted. Rows that already existed
+// are left untouched and counted as skipped.
+type ImportStats struct {
+	Programs      int `json:"programs"`
+	Domains       int `json:"domains"`
+	DomainInfo    int `json:"domain_info"`
+	StatusChanges int `json:"status_changes"`
+	Skipped       int `json:"skipped"`
+}
+
+// ExportDataset reads programs, domains, domain info and status changes
+func (db *DB) ExportDataset() (*Dataset, error) {
+	programs, err := db.GetPrograms()
+	if err != nil {
+		return nil, fmt.Errorf("failed to export programs: %w", err)
+	}
+	domains, err := db.GetDomainsDiscoveredSince(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export domains: %w", err)
+	}
+	info, err := db.getAllDomainInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to export domain info: %w", err)
+	}
+	changes, err := db.GetStatusChangesSince(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export status changes: %w", err)
+	}
+
+	return &Dataset{
+		Version:       DatasetVersion,
+		ExportedAt:    time.Now(),
+		Programs:      programs,
+		Domains:       domains,
+		DomainInfo:    info,
+		StatusChanges: changes,
+	}, nil
+}
+
+func (db *DB) getAllDomainInfo() ([]DomainInfo, error) {
+	rows, err := db.Query(`SELECT domain, program, COALESCE(status, ''), COALESCE(title, ''),
+	                              COALESCE(status_code, 0), COALESCE(server, ''), COALESCE(technologies, ''), favicon_hash, last_checked
+	                       FROM domain_info ORDER BY domain`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var infos []DomainInfo
+	for rows.Next() {
+		var info DomainInfo
+		var techs string
+		var lastChecked sql.NullTime
+		if err := rows.Scan(&info.Domain, &info.Program, &info.Status, &info.Title,
+			&info.StatusCode, &info.Server, &techs, &info.FaviconHash, &lastChecked); err != nil {
+			return nil, err
+		}
+		info.Technologies = decodeTechnologies(techs)
+		info.LastChecked = lastChecked.Time
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+// ImportDataset inserts an exported dataset in a single transaction. Existing
+// programs, domains and domain info win over imported ones, and status
+// changes already present are skipped. Imported status changes are marked
+// notified so they don't trigger alerts again.
+func (db *DB) ImportDataset(data *Dataset) (*ImportStats, error) {
+	if data.Version != DatasetVersion {
+		return nil, fmt.Errorf("%w %d (expected %d)", ErrUnsupportedDataset, data.Version, DatasetVersion)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stats := &ImportStats{}
+	count := func(result sql.Result, inserted *int) {
+		if n, _ := result.RowsAffected(); n > 0 {
+			*inserted++
+		} else {
+			stats.Skipped++
+		}
+	}
+
+	for _, p := range data.Programs {
+		result, err := tx.Exec(`INSERT INTO programs (handle, name, url, api_url, domain, offers_bounties, program_type, source,
+		                            submission_state, bounty_min, bounty_max, bounty_currency, resolved_reports, last_scanned)
+		                        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(handle) DO NOTHING`,
+			p.Handle, p.Name, p.URL, p.APIURL, p.Domain, p.OffersBounties, p.ProgramType, programSource(p.Source), p.SubmissionState,
+			p.BountyMin, p.BountyMax, p.BountyCurrency, p.ResolvedReports, p.LastScanned)
+		if err != nil {
+			return nil, fmt.Errorf("import program %s: %w", p.Handle, err)
+		}
+		count(result, &stats.Programs)
+	}
+
+	for _, d := range data.Domains {
+		result, err := tx.Exec(`INSERT INTO domains (domain, program, status, status_reason, status_code, final_url, open_ports,
+		                            discovered_at, last_checked, is_new, bounty_eligible, asset_type, source, cert_valid, cert_error)
+		                        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(domain, program) DO NOTHING`,
+			d.Domain, d.Program, d.Status, d.StatusReason, d.StatusCode, d.FinalURL, joinPorts(d.OpenPorts), d.DiscoveredAt, nullTime(d.LastChecked), d.IsNew,
+			d.BountyEligible, d.AssetType, d.Source, d.CertValid, d.CertError)
+		if err != nil {
+			return nil, fmt.Errorf("import domain %s: %w", d.Domain, err)
+		}
+		count(result, &stats.Domains)
+	}
+
+	for _, info := range data.DomainInfo {
+		result, err := tx.Exec(`INSERT INTO domain_info (domain, program, status, title, status_code, server, technologies, favicon_hash, last_checked)
+		                        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(domain) DO NOTHING`,
+			info.Domain, info.Program, info.Status, info.Title, info.StatusCode, info.Server,
+			encodeTechnologies(info.Technologies), info.FaviconHash, nullTime(info.LastChecked))
+		if err != nil {
+			return nil, fmt.Errorf("import domain info %s: %w", info.Domain, err)
+		}
+		count(result, &stats.DomainInfo)
+	}
+
+	for _, sc := range data.StatusChanges {
+		result, err := tx.Exec(`INSERT INTO status_changes (domain, program, old_status, new_status, changed_at, notified)
+		                        SELECT ?, ?, ?, ?, ?, 1
+		                        WHERE NOT EXISTS (SELECT 1 FROM status_changes
+		                                          WHERE domain = ? AND program = ? AND old_status = ? AND new_status = ? AND changed_at = ?)`,
+			sc.Domain, sc.Program, sc.OldStatus, sc.NewStatus, sc.ChangedAt,
+			sc.Domain, sc.Program, sc.OldStatus, sc.NewStatus, sc.ChangedAt)
+		if err != nil {
+			return nil, fmt.Errorf("import status change for %s: %w", sc.Domain, err)
+		}
+		count(result, &stats.StatusChanges)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,62 @@
+package database
+
+// Kinds of items whose delivery is tracked per notifier
+const (
+	DeliveryStatusChange = "status_change"
+	DeliveryAlert        = "alert"
+)
+
+// DeliveredTo returns the IDs of the items of a kind that were delivered to
+// a notifier but are not marked notified yet
+func (db *DB) DeliveredTo(kind, notifier string) (map[int64]bool, error) {
+	rows, err := db.Query(`SELECT item_id FROM notification_deliveries WHERE kind = ? AND notifier = ?`,
+		kind, notifier)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delivered := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		delivered[id] = true
+	}
+	return delivered, rows.Err()
+}
+
+// MarkDelivered records that a notifier received the items with the given IDs
+func (db *DB) MarkDelivered(kind, notifier string, ids []int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO notification_deliveries (kind, item_id, notifier)
+		                      VALUES (?, ?, ?)`, kind, id, notifier); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClearDeliveries forgets the per-notifier deliveries of items that are
+// marked notified
+func (db *DB) ClearDeliveries(kind string, ids []int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM notification_deliveries WHERE kind = ? AND item_id = ?`, kind, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"watchtower/internal/domainutil"
+)
+
+// Finding is a nuclei template match on a domain. Repeated matches update
+// last_seen; first_seen keeps when it was first reported.
+type Finding struct {
+	ID         int64     `json:"id"`
+	Domain     string    `json:"domain"`
+	Program    string    `json:"program"`
+	TemplateID string    `json:"template_id"`
+	Name       string    `json:"name"`
+	Severity   string    `json:"severity"`
+	MatchedAt  string    `json:"matched_at"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// FindingFilter narrows GetFindings; empty fields match everything
+type FindingFilter struct {
+	Domain   string
+	Program  string
+	Severity string
+	Limit    int
+}
+
+// SaveFindings stores the findings of a nuclei run and returns how many were
+// new
+func (db *DB) SaveFindings(findings []Finding) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	created := 0
+	for _, f := range findings {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO findings (domain, program, template_id, name, severity, matched_at, first_seen, last_seen)
+		                        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.Domain, f.Program, f.TemplateID, f.Name, strings.ToLower(f.Severity), f.MatchedAt, now, now)
+		if err != nil {
+			return 0, err
+		}
+		if inserted, _ := result.RowsAffected(); inserted > 0 {
+			created++
+			continue
+		}
+		_, err = tx.Exec(`UPDATE findings SET program = ?, name = ?, severity = ?, last_seen = ?
+		                  WHERE domain = ? AND template_id = ? AND matched_at = ?`,
+			f.Program, f.Name, strings.ToLower(f.Severity), now, f.Domain, f.TemplateID, f.MatchedAt)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return created, tx.Commit()
+}
+
+// GetFindings returns findings ordered by the time they were last seen,
+// newest first
+func (db *DB) GetFindings(filter FindingFilter) ([]Finding, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Domain != "" {
+		conditions = append(conditions, "domain = ?")
+		args = append(args, domainutil.Normalize(filter.Domain))
+	}
+	if filter.Program != "" {
+		conditions = append(conditions, "program = ?")
+		args = append(args, filter.Program)
+	}
+	if filter.Severity != "" {
+		conditions = append(conditions, "severity = ?")
+		args = append(args, strings.ToLower(filter.Severity))
+	}
+
+	query := `SELECT id, domain, program, template_id, name, severity, matched_at, first_seen, last_seen FROM findings`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY last_seen DESC, id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []Finding{}
+	for rows.Next() {
+		var f Finding
+		if err := rows.Scan(&f.ID, &f.Domain, &f.Program, &f.TemplateID, &f.Name, &f.Severity, &f.MatchedAt,
+			&f.FirstSeen, &f.LastSeen); err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"watchtower/internal/domainutil"
+)
+
+// ManualDomain is a program domain imported from a file rather than fetched
+// from HackerOne. Domain may be a wildcard such as "*.example.com".
+type ManualDomain struct {
+	Program string `json:"program"`
+	Domain  string `json:"domain"`
+}
+
+// ManualImportStats counts what AddManualDomains added. Entries that were
+// already imported are counted as skipped.
+type ManualImportStats struct {
+	Programs int `json:"programs"`
+	Domains  int `json:"domains"`
+	Skipped  int `json:"skipped"`
+}
+
+// ParseManualDomains reads one "program,domain" entry per line. Blank lines,
+// lines starting with "#" and a "program,domain" header are ignored.
+func ParseManualDomains(r io.Reader) ([]ManualDomain, error) {
+	var entries []ManualDomain
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected program,domain", line)
+		}
+		program := strings.TrimSpace(fields[0])
+		domain := domainutil.Normalize(fields[1])
+		if strings.EqualFold(program, "program") && domain == "domain" {
+			continue
+		}
+		if program == "" {
+			return nil, fmt.Errorf("line %d: missing program", line)
+		}
+		if !domainutil.IsValidHost(domainutil.StripWildcards(domain)) {
+			return nil, fmt.Errorf("line %d: invalid domain %q", line, strings.TrimSpace(fields[1]))
+		}
+		entries = append(entries, ManualDomain{Program: program, Domain: domain})
+	}
+	return entries, scanner.Err()
+}
+
+// AddManualDomains stores imported entries. Programs that don't exist yet are
+// created with source "manual", and hosts are added to the domains table so
+// they show up before the next scan checks them. Programs that gained domains
+// are scanned by the next scan even if SKIP_FRESH_WITHIN would skip them.
+func (db *DB) AddManualDomains(entries []ManualDomain) (ManualImportStats, error) {
+	var stats ManualImportStats
+
+	tx, err := db.Begin()
+	if err != nil {
+		return stats, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, entry := range entries {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO programs (handle, name, source, program_type)
+		                        VALUES (?, ?, ?, 'UNKNOWN')`,
+			entry.Program, entry.Program, ProgramSourceManual)
+		if err != nil {
+			return stats, err
+		}
+		if inserted, _ := result.RowsAffected(); inserted > 0 {
+			stats.Programs++
+		}
+
+		result, err = tx.Exec(`INSERT OR IGNORE INTO manual_domains (program, domain, added_at) VALUES (?, ?, ?)`,
+			entry.Program, entry.Domain, now)
+		if err != nil {
+			return stats, err
+		}
+		if inserted, _ := result.RowsAffected(); inserted == 0 {
+			stats.Skipped++
+			continue
+		}
+		stats.Domains++
+
+		// A program scanned before the import isn't fresh anymore
+		if _, err := tx.Exec(`UPDATE programs SET last_scanned = NULL WHERE handle = ?`, entry.Program); err != nil {
+			return stats, err
+		}
+
+		// Wildcards are only expanded by discovery
+		if strings.Contains(entry.Domain, "*") {
+			continue
+		}
+		_, err = tx.Exec(`INSERT OR IGNORE INTO domains (domain, program, status, discovered_at, is_new, source)
+		                  VALUES (?, ?, 'unknown', ?, 1, ?)`,
+			entry.Domain, entry.Program, now, ProgramSourceManual)
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, tx.Commit()
+}
+
+// GetManualDomains returns the imported domains of a program
+func (db *DB) GetManualDomains(program string) ([]string, error) {
+	rows, err := db.Query(`SELECT domain FROM manual_domains WHERE program = ? ORDER BY domain`, program)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
+}
+
+// GetManualPrograms returns the programs that have imported domains
+func (db *DB) GetManualPrograms() ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT program FROM manual_domains ORDER BY program`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var programs []string
+	for rows.Next() {
+		var program string
+		if err := rows.Scan(&program); err != nil {
+			return nil, err
+		}
+		programs = append(programs, program)
+	}
+	return programs, rows.Err()
+}
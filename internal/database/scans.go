@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Scan run statuses
+const (
+	ScanStatusRunning     = "running"
+	ScanStatusCompleted   = "completed"
+	ScanStatusFailed      = "failed"
+	ScanStatusCancelled   = "cancelled"
+	ScanStatusInterrupted = "interrupted"
+)
+
+// ScanRun is the record of one full scan
+type ScanRun struct {
+	ID                int64      `json:"id"`
+	StartedAt         time.Time  `json:"started_at"`
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`
+	Status            string     `json:"status"`
+	ProgramsProcessed int        `json:"programs_processed"`
+	DomainsFound      int        `json:"domains_found"`
+	Error             string     `json:"error,omitempty"`
+	DurationSeconds   float64    `json:"duration_seconds,omitempty"`
+}
+
+// Duration is how long a finished run took, rounded to the second
+func (r ScanRun) Duration() time.Duration {
+	if r.FinishedAt == nil {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt).Round(time.Second)
+}
+
+// ScanStats are the counts recorded when a scan run finishes
+type ScanStats struct {
+	ProgramsProcessed int
+	DomainsFound      int
+}
+
+// StartScanRun records a scan as running and returns its ID
+func (db *DB) StartScanRun() (int64, error) {
+	result, err := db.Exec(`INSERT INTO scans (started_at, status) VALUES (?, ?)`, time.Now(), ScanStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// FinishScanRun closes a scan run. A nil err marks it completed, a context
+// cancellation cancelled and any other error failed.
+func (db *DB) FinishScanRun(id int64, stats ScanStats, err error) error {
+	status := ScanStatusCompleted
+	var message string
+	if err != nil {
+		status = ScanStatusFailed
+		if errors.Is(err, context.Canceled) {
+			status = ScanStatusCancelled
+		}
+		message = err.Error()
+	}
+
+	_, execErr := db.Exec(`UPDATE scans SET finished_at = ?, status = ?, programs_processed = ?, domains_found = ?, error = ?
+	                       WHERE id = ?`,
+		time.Now(), status, stats.ProgramsProcessed, stats.DomainsFound, message, id)
+	return execErr
+}
+
+// InterruptScanRuns marks runs that were still running when the process
+// stopped; call it on startup before any scan begins
+func (db *DB) InterruptScanRuns() (int64, error) {
+	result, err := db.Exec(`UPDATE scans SET status = ? WHERE status = ?`, ScanStatusInterrupted, ScanStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetScanRuns returns the most recent scan runs, newest first
+func (db *DB) GetScanRuns(limit int) ([]ScanRun, error) {
+	rows, err := db.Query(`SELECT id, started_at, finished_at, status, programs_processed, domains_found, error
+	                       FROM scans ORDER BY started_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []ScanRun{}
+	for rows.Next() {
+		var r ScanRun
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.StartedAt, &finishedAt, &r.Status, &r.ProgramsProcessed,
+			&r.DomainsFound, &r.Error); err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			r.FinishedAt = &finishedAt.Time
+			r.DurationSeconds = r.Duration().Seconds()
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// CountDomainsDiscoveredSince returns how many domains were first seen at or
+// after since
+func (db *DB) CountDomainsDiscoveredSince(since time.Time) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM domains WHERE discovered_at >= ?`, since).Scan(&count)
+	return count, err
+}
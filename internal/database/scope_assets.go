@@ -0,0 +1,76 @@
+package database
+
+import (
+	"time"
+)
+
+// ScopeAsset is one scope entry of a program as last fetched from HackerOne,
+// including the asset types that are not probed such as CIDR ranges, mobile
+// apps and source code repositories
+type ScopeAsset struct {
+	Program               string    `json:"program"`
+	Identifier            string    `json:"identifier"`
+	AssetType             string    `json:"asset_type"`
+	EligibleForBounty     bool      `json:"eligible_for_bounty"`
+	EligibleForSubmission bool      `json:"eligible_for_submission"`
+	Instruction           string    `json:"instruction,omitempty"`
+	MaxSeverity           string    `json:"max_severity,omitempty"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// SaveScopeAssets replaces the stored scope of a program
+func (db *DB) SaveScopeAssets(program string, assets []ScopeAsset) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM scope_assets WHERE program = ?`, program); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, asset := range assets {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO scope_assets (program, identifier, asset_type, eligible_for_bounty,
+		                   eligible_for_submission, instruction, max_severity, updated_at)
+		                   VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			program, asset.Identifier, asset.AssetType, asset.EligibleForBounty,
+			asset.EligibleForSubmission, asset.Instruction, asset.MaxSeverity, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetScopeAssets returns the stored scope of a program ordered by asset type
+// and identifier. A non-empty assetType only returns assets of that type.
+func (db *DB) GetScopeAssets(program, assetType string) ([]ScopeAsset, error) {
+	query := `SELECT program, identifier, asset_type, eligible_for_bounty, eligible_for_submission,
+	                 instruction, max_severity, updated_at
+	          FROM scope_assets WHERE program = ?`
+	args := []interface{}{program}
+	if assetType != "" {
+		query += ` AND asset_type = ?`
+		args = append(args, assetType)
+	}
+	query += ` ORDER BY asset_type, identifier`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []ScopeAsset{}
+	for rows.Next() {
+		var a ScopeAsset
+		if err := rows.Scan(&a.Program, &a.Identifier, &a.AssetType, &a.EligibleForBounty, &a.EligibleForSubmission,
+			&a.Instruction, &a.MaxSeverity, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		assets = append(assets, a)
+	}
+	return assets, rows.Err()
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"time"
+
+	"watchtower/internal/domainutil"
+)
+
+// Screenshot is the latest screenshot taken of a domain
+type Screenshot struct {
+	Domain     string    `json:"domain"`
+	Program    string    `json:"program"`
+	Path       string    `json:"path"`
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+// SaveScreenshot records the screenshot of a domain, replacing the previous
+// one
+func (db *DB) SaveScreenshot(shot *Screenshot) error {
+	_, err := db.Exec(`INSERT INTO screenshots (domain, program, path, captured_at) VALUES (?, ?, ?, ?)
+	                   ON CONFLICT(domain) DO UPDATE SET
+	                       program = excluded.program, path = excluded.path, captured_at = excluded.captured_at`,
+		domainutil.Normalize(shot.Domain), shot.Program, shot.Path, shot.CapturedAt)
+	return err
+}
+
+// GetScreenshot returns the screenshot of a domain, or sql.ErrNoRows if none
+// was taken
+func (db *DB) GetScreenshot(domain string) (*Screenshot, error) {
+	var shot Screenshot
+	err := db.QueryRow(`SELECT domain, program, path, captured_at FROM screenshots WHERE domain = ?`,
+		domainutil.Normalize(domain)).Scan(&shot.Domain, &shot.Program, &shot.Path, &shot.CapturedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &shot, nil
+}
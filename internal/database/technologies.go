@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+// encodeTechnologies stores a technology list as a JSON array; an empty list
+// is stored as the empty string
+func encodeTechnologies(techs []string) string {
+	if len(techs) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(techs)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeTechnologies reads a stored technology list. Values written before
+// the switch to JSON are comma-joined and are split as before.
+func decodeTechnologies(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if strings.HasPrefix(value, "[") {
+		var techs []string
+		if err := json.Unmarshal([]byte(value), &techs); err == nil {
+			if len(techs) == 0 {
+				return nil
+			}
+			return techs
+		}
+	}
+
+	var techs []string
+	for _, tech := range strings.Split(value, ",") {
+		if tech = strings.TrimSpace(tech); tech != "" {
+			techs = append(techs, tech)
+		}
+	}
+	return techs
+}
+
+// GetDomainsByTechnology returns the enriched domains running a technology.
+// The name is compared case-insensitively with each detected technology,
+// with or without its version, so "wordpress" matches "WordPress:6.4" but
+// not "WordPress Plugin".
+func (db *DB) GetDomainsByTechnology(tech string) ([]DomainInfo, error) {
+	tech = strings.ToLower(strings.TrimSpace(tech))
+	if tech == "" {
+		return []DomainInfo{}, nil
+	}
+
+	// Matching happens on the decoded list, since LIKE would also match
+	// substrings and legacy comma-joined values
+	rows, err := db.Query(`SELECT domain, program, COALESCE(status, ''), COALESCE(title, ''), COALESCE(status_code, 0),
+	                              COALESCE(server, ''), COALESCE(technologies, ''), favicon_hash, last_checked
+	                       FROM domain_info WHERE technologies IS NOT NULL AND technologies != ''
+	                       ORDER BY program, domain`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := []DomainInfo{}
+	for rows.Next() {
+		var info DomainInfo
+		var techs string
+		var lastChecked sql.NullTime
+		if err := rows.Scan(&info.Domain, &info.Program, &info.Status, &info.Title,
+			&info.StatusCode, &info.Server, &techs, &info.FaviconHash, &lastChecked); err != nil {
+			return nil, err
+		}
+		info.Technologies = decodeTechnologies(techs)
+		info.LastChecked = lastChecked.Time
+		if hasTechnology(info.Technologies, tech) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, rows.Err()
+}
+
+// hasTechnology reports whether techs contains the lowercase name, ignoring
+// a ":version" suffix on the stored entries
+func hasTechnology(techs []string, name string) bool {
+	for _, tech := range techs {
+		tech = strings.ToLower(strings.TrimSpace(tech))
+		if tech == name {
+			return true
+		}
+		if base, _, ok := strings.Cut(tech, ":"); ok && strings.TrimSpace(base) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateTechnologies rewrites comma-joined technology lists as JSON arrays
+func migrateTechnologies(db *sql.DB) error {
+	rows, err := db.Query(`SELECT domain, technologies FROM domain_info
+	                       WHERE technologies IS NOT NULL AND technologies != '' AND technologies NOT LIKE '[%'`)
+	if err != nil {
+		return err
+	}
+
+	legacy := make(map[string]string)
+	for rows.Next() {
+		var domain, techs string
+		if err := rows.Scan(&domain, &techs); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy[domain] = encodeTechnologies(decodeTechnologies(techs))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for domain, techs := range legacy {
+		if _, err := tx.Exec(`UPDATE domain_info SET technologies = ? WHERE domain = ?`, techs, domain); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Migrated: Converted technologies of %d domains to JSON", len(legacy))
+	return nil
+}
@@ -0,0 +1,116 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"watchtower/internal/domainutil"
+	"watchtower/internal/resolver"
+)
+
+// BruteforceTool resolves every word of a wordlist as a subdomain of a base
+// domain. It is built in, so it needs no binary in PATH, and it only runs on
+// wildcard scope entries where unlisted subdomains are expected.
+type BruteforceTool struct {
+	words    []string
+	resolver *resolver.Service
+}
+
+// NewBruteforceTool loads a wordlist with one label per line. Lookups run
+// concurrency at a time, each bounded by timeout.
+func NewBruteforceTool(wordlist string, concurrency int, timeout time.Duration) (BruteforceTool, error) {
+	file, err := os.Open(wordlist)
+	if err != nil {
+		return BruteforceTool{}, err
+	}
+	defer file.Close()
+
+	var words []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.Trim(strings.TrimSpace(scanner.Text()), "."))
+		if word == "" || strings.HasPrefix(word, "#") || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return BruteforceTool{}, err
+	}
+	if len(words) == 0 {
+		return BruteforceTool{}, fmt.Errorf("wordlist %s is empty", wordlist)
+	}
+	return BruteforceTool{words: words, resolver: resolver.NewService(concurrency, timeout)}, nil
+}
+
+func (BruteforceTool) Name() string {
+	return SourceBruteforce
+}
+
+func (BruteforceTool) wildcardOnly() {}
+
+// Run returns the candidates that resolve. Domains with wildcard DNS answer
+// for any label, so candidates resolving only to the wildcard's addresses
+// are dropped. When ctx ends first the hosts found so far are returned.
+func (t BruteforceTool) Run(ctx context.Context, domain string) ([]string, error) {
+	domain = strings.TrimPrefix(domainutil.Normalize(domain), "*.")
+
+	candidates := make([]string, 0, len(t.words))
+	for _, word := range t.words {
+		candidates = append(candidates, word+"."+domain)
+	}
+
+	wildcard := t.wildcardAddresses(ctx, domain)
+	results := t.resolver.ResolveDomains(ctx, candidates)
+	if ctx.Err() != nil {
+		log.Printf("Brute force of %s stopped after %d of %d candidates: %v", domain, len(results), len(candidates), ctx.Err())
+	}
+
+	var hosts []string
+	for _, candidate := range candidates {
+		result, ok := results[candidate]
+		if !ok || result.Err != nil || len(result.IPs) == 0 {
+			continue
+		}
+		if len(wildcard) > 0 && allIn(result.IPs, wildcard) {
+			continue
+		}
+		hosts = append(hosts, candidate)
+	}
+	return hosts, nil
+}
+
+// wildcardAddresses returns what a random label under the domain resolves
+// to, which is nothing unless the domain has wildcard DNS
+func (t BruteforceTool) wildcardAddresses(ctx context.Context, domain string) map[string]bool {
+	label := make([]byte, 8)
+	if _, err := rand.Read(label); err != nil {
+		return nil
+	}
+	probe := hex.EncodeToString(label) + "." + domain
+	result := t.resolver.ResolveDomains(ctx, []string{probe})[probe]
+
+	addresses := make(map[string]bool, len(result.IPs))
+	for _, ip := range result.IPs {
+		addresses[ip] = true
+	}
+	return addresses
+}
+
+func allIn(ips []string, set map[string]bool) bool {
+	for _, ip := range ips {
+		if !set[ip] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"watchtower/internal/domainutil"
+)
+
+// CTProvider finds subdomains in certificate transparency logs via crt.sh
+type CTProvider struct {
+	client   *http.Client
+	baseURL  string
+	attempts int
+	backoff  time.Duration
+}
+
+// NewCTProvider creates a provider that queries crt.sh
+func NewCTProvider() *CTProvider {
+	return &CTProvider{
+		client:   &http.Client{Timeout: 60 * time.Second},
+		baseURL:  "https://crt.sh",
+		attempts: 4,
+		backoff:  2 * time.Second,
+	}
+}
+
+func (p *CTProvider) Name() string {
+	return SourceCT
+}
+
+// Discover returns the hostnames of certificates issued for the domain and
+// its subdomains
+func (p *CTProvider) Discover(ctx context.Context, domain string) ([]string, error) {
+	domain = strings.TrimPrefix(domainutil.Normalize(domain), "*.")
+	if !strings.Contains(domain, ".") {
+		return nil, nil
+	}
+
+	body, err := p.query(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []struct {
+		NameValue string `json:"name_value"`
+	}
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse crt.sh response: %w", err)
+	}
+
+	// Each certificate lists its SANs in name_value, one per line
+	unique := make(map[string]bool)
+	var hosts []string
+	for _, entry := range entries {
+		for _, name := range strings.Split(entry.NameValue, "\n") {
+			host := strings.TrimPrefix(domainutil.Normalize(name), "*.")
+			if host != domain && !strings.HasSuffix(host, "."+domain) {
+				continue
+			}
+			if !unique[host] {
+				unique[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	return hosts, nil
+}
+
+// query fetches the crt.sh JSON for a domain, retrying with exponential
+// backoff when crt.sh is rate limiting or overloaded
+func (p *CTProvider) query(ctx context.Context, domain string) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/?q=%s&output=json", p.baseURL, url.QueryEscape("%."+domain))
+	backoff := p.backoff
+
+	var lastErr error
+	for attempt := 1; attempt <= p.attempts; attempt++ {
+		body, retryAfter, err := p.fetch(ctx, endpoint)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if attempt == p.attempts {
+			break
+		}
+
+		wait := backoff
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+
+	return nil, fmt.Errorf("crt.sh query for %s failed after %d attempts: %w", domain, p.attempts, lastErr)
+}
+
+// fetch performs a single crt.sh request. It returns the Retry-After delay
+// requested by the server, if any.
+func (p *CTProvider) fetch(ctx context.Context, endpoint string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", "Watchtower/1.0")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, retryAfter, fmt.Errorf("crt.sh returned status %d", resp.StatusCode)
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, 0, fmt.Errorf("failed to read crt.sh response: %w", err)
+	}
+	return body, 0, nil
+}
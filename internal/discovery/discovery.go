@@ -3,87 +3,265 @@ package discovery
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 	"os/exec"
 	"strings"
 	"sync"
 	"time"
+
+	"watchtower/internal/subprocess"
+)
+
+// Sources recorded for discovered domains
+const (
+	SourceScope       = "scope"
+	SourceSubfinder   = "subfinder"
+	SourceAmass       = "amass"
+	SourceAssetfinder = "assetfinder"
+	SourceCT          = "ct"
+	SourceBruteforce  = "bruteforce"
 )
 
+// Subdomain is a discovered host and the source that found it
+type Subdomain struct {
+	Host   string
+	Source string
+}
+
+// DiscoveryResult holds the hosts found for a set of base domains and the
+// failures of the individual tools and providers. Failed sources don't stop
+// the others, so a result can have both.
+type DiscoveryResult struct {
+	Subdomains []Subdomain
+	Errors     []error
+}
+
+// Provider is an additional discovery source that runs next to the tools
+type Provider interface {
+	// Name is stored as the source of the domains the provider finds
+	Name() string
+	Discover(ctx context.Context, domain string) ([]string, error)
+}
+
+// Limits bound how long and how many base domains are discovered at once
+type Limits struct {
+	DomainTimeout  time.Duration // per base domain and tool
+	OverallTimeout time.Duration // per DiscoverDomains call
+	Concurrency    int           // base domains discovered in parallel per source
+}
+
 type Service struct {
-	mu sync.Mutex
+	batchMode     bool
+	limits        Limits
+	tools         []Tool
+	wildcardTools []Tool
+	providers     []Provider
 }
 
-func NewService() *Service {
-	return &Service{}
+// NewService creates a discovery service running the given tools. Tools
+// whose binary is not in PATH are logged and skipped. In batch mode all base
+// domains of a call are handed to a single subfinder process via -dL.
+// Results of the extra providers are merged with the tools'.
+func NewService(batchMode bool, limits Limits, tools []Tool, providers ...Provider) *Service {
+	var available, wildcard []Tool
+	for _, tool := range tools {
+		if _, ok := tool.(wildcardTool); ok {
+			wildcard = append(wildcard, tool)
+			continue
+		}
+		if _, err := exec.LookPath(tool.Name()); err != nil {
+			log.Printf("Discovery tool %s not found in PATH, skipping it", tool.Name())
+			continue
+		}
+		available = append(available, tool)
+	}
+	return &Service{batchMode: batchMode, limits: limits, tools: available, wildcardTools: wildcard, providers: providers}
 }
 
-// DiscoverSubdomains uses subfinder to discover subdomains for a given domain
+// DiscoverSubdomains runs every available tool for a domain and returns the
+// union of their results. An error is returned only if no tool found
+// anything and at least one failed.
 func (s *Service) DiscoverSubdomains(ctx context.Context, domain string) ([]string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	found, errs := s.runTools(ctx, domain, s.tools)
 
-	// Check if subfinder is available
-	if _, err := exec.LookPath("subfinder"); err != nil {
-		return []string{}, fmt.Errorf("subfinder not found in PATH: %w", err)
+	unique := make(map[string]bool)
+	var subdomains []string
+	for _, sub := range found {
+		if !unique[sub.Host] {
+			unique[sub.Host] = true
+			subdomains = append(subdomains, sub.Host)
+		}
 	}
 
-	// Use subfinder with timeout (30 seconds per domain)
-	cmdCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+	if len(subdomains) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return subdomains, nil
+}
+
+// runTools runs the tools for a domain in parallel, each with its own
+// timeout. Results are returned in tool order, tagged with the tool's name.
+// It holds no locks, so concurrent calls run their tools side by side.
+func (s *Service) runTools(ctx context.Context, domain string, tools []Tool) ([]Subdomain, []error) {
+	found := make([][]string, len(tools))
+	failures := make([]error, len(tools))
+	var wg sync.WaitGroup
 
-	// Use subfinder command-line tool with timeout
-	cmd := exec.CommandContext(cmdCtx, "subfinder", "-d", domain, "-silent", "-timeout", "20")
+	for i, tool := range tools {
+		wg.Add(1)
+		go func(i int, t Tool) {
+			defer wg.Done()
 
-	output, err := cmd.Output()
-	if err != nil {
-		// Check if it's a timeout
-		if cmdCtx.Err() == context.DeadlineExceeded {
-			return []string{}, fmt.Errorf("subfinder timeout for %s", domain)
+			toolCtx, cancel := context.WithTimeout(ctx, s.limits.DomainTimeout)
+			defer cancel()
+
+			found[i], failures[i] = t.Run(toolCtx, domain)
+		}(i, tool)
+	}
+	wg.Wait()
+
+	var result []Subdomain
+	var errs []error
+	for i, hosts := range found {
+		if failures[i] != nil {
+			errs = append(errs, failures[i])
+			continue
 		}
-		// subfinder might return non-zero exit code but still have results
-		// Try to parse output anyway
-		if len(output) == 0 {
-			return []string{}, fmt.Errorf("subfinder failed: %w", err)
+		for _, host := range hosts {
+			result = append(result, Subdomain{Host: host, Source: tools[i].Name()})
 		}
 	}
+	return result, errs
+}
 
-	// Parse output
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	var subdomains []string
+// DiscoverDomains discovers domains from a list of base domains using every
+// available tool and configured provider. Tools that only run on wildcard
+// scope entries get the base domains in wildcards. A host found by several
+// sources is reported once, tagged with the first source that found it.
+func (s *Service) DiscoverDomains(ctx context.Context, domains []string, wildcards map[string]bool) *DiscoveryResult {
+	// Create a timeout context for the entire discovery process
+	discoveryCtx, cancel := context.WithTimeout(ctx, s.limits.OverallTimeout)
+	defer cancel()
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			subdomains = append(subdomains, line)
+	var wildcardDomains []string
+	for _, domain := range domains {
+		if wildcards[domain] {
+			wildcardDomains = append(wildcardDomains, domain)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return []string{}, err
+	// Run the tools and every provider in parallel; results are merged in a
+	// fixed order so the recorded source doesn't depend on which finished first
+	found := make([][]Subdomain, 2+len(s.providers))
+	failures := make([][]error, len(found))
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		found[0], failures[0] = s.discoverTools(discoveryCtx, domains, s.tools)
+	}()
+	go func() {
+		defer wg.Done()
+		found[1], failures[1] = s.discoverTools(discoveryCtx, wildcardDomains, s.wildcardTools)
+	}()
+
+	for i, provider := range s.providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+			hosts, errs := runProvider(discoveryCtx, p, domains, s.limits.Concurrency)
+			for _, host := range hosts {
+				found[i] = append(found[i], Subdomain{Host: host, Source: p.Name()})
+			}
+			failures[i] = errs
+		}(i+2, provider)
 	}
+	wg.Wait()
 
-	return subdomains, nil
+	result := &DiscoveryResult{}
+	unique := make(map[string]bool)
+	for i, subdomains := range found {
+		for _, sub := range subdomains {
+			if !unique[sub.Host] {
+				unique[sub.Host] = true
+				result.Subdomains = append(result.Subdomains, sub)
+			}
+		}
+		result.Errors = append(result.Errors, failures[i]...)
+	}
+
+	return result
+}
+
+// runProvider queries a provider for each base domain. A failure for one
+// domain is recorded and skipped so one flaky source never blocks the others.
+func runProvider(ctx context.Context, provider Provider, domains []string, concurrency int) ([]string, []error) {
+	var hosts []string
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+
+	for _, domain := range domains {
+		wg.Add(1)
+		go func(d string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			found, err := provider.Discover(ctx, d)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("%s discovery failed for %s: %v", provider.Name(), d, err)
+				errs = append(errs, fmt.Errorf("%s (%s): %w", provider.Name(), d, err))
+				return
+			}
+			hosts = append(hosts, found...)
+		}(domain)
+	}
+	wg.Wait()
+
+	return hosts, errs
 }
 
-// DiscoverDomains discovers domains from a list of base domains
-func (s *Service) DiscoverDomains(ctx context.Context, domains []string) ([]string, error) {
-	var allSubdomains []string
+// discoverTools runs the given tools for the base domains. It returns
+// nothing when no tool is installed.
+func (s *Service) discoverTools(discoveryCtx context.Context, domains []string, tools []Tool) ([]Subdomain, []error) {
+	var allSubdomains []Subdomain
+	var errs []error
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 
-	// Check if subfinder is available first
-	if _, err := exec.LookPath("subfinder"); err != nil {
-		// If subfinder is not available, return empty (will use base domains only)
-		return []string{}, nil
+	if len(tools) == 0 || len(domains) == 0 {
+		// No tool available, the base domains are used as they are
+		return nil, nil
 	}
 
-	// Process domains in parallel with timeout
-	semaphore := make(chan struct{}, 3) // Limit concurrent subfinder processes to avoid overload
+	if subfinder, ok := findSubfinder(tools); s.batchMode && ok {
+		subdomains, err := s.discoverBatch(discoveryCtx, subfinder, domains)
+		if err == nil {
+			for _, host := range subdomains {
+				allSubdomains = append(allSubdomains, Subdomain{Host: host, Source: SourceSubfinder})
+			}
+			tools = withoutTool(tools, SourceSubfinder)
+		} else {
+			log.Printf("Batch subfinder run failed, falling back to per-domain discovery: %v", err)
+			errs = append(errs, err)
+		}
+		if len(tools) == 0 {
+			return allSubdomains, errs
+		}
+	}
 
-	// Create a timeout context for the entire discovery process (max 5 minutes)
-	discoveryCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
+	// Process domains in parallel with timeout
+	semaphore := make(chan struct{}, s.limits.Concurrency) // Limit concurrent tool runs to avoid overload
 
 	for _, domain := range domains {
 		// Check if context is cancelled
@@ -99,17 +277,13 @@ func (s *Service) DiscoverDomains(ctx context.Context, domains []string) ([]stri
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			subdomains, err := s.DiscoverSubdomains(discoveryCtx, d)
-			if err != nil {
-				// Log error but continue - don't block on failures
-				return
-			}
+			subdomains, failures := s.runTools(discoveryCtx, d, tools)
 
-			if len(subdomains) > 0 {
-				mu.Lock()
-				allSubdomains = append(allSubdomains, subdomains...)
-				mu.Unlock()
-			}
+			mu.Lock()
+			defer mu.Unlock()
+			// Record the errors but continue - don't block on failures
+			errs = append(errs, failures...)
+			allSubdomains = append(allSubdomains, subdomains...)
 		}(domain)
 	}
 
@@ -127,15 +301,85 @@ func (s *Service) DiscoverDomains(ctx context.Context, domains []string) ([]stri
 		// Timeout - return what we have so far
 	}
 
-	// Deduplicate
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Subdomain(nil), allSubdomains...), append([]error(nil), errs...)
+}
+
+func findSubfinder(tools []Tool) (SubfinderTool, bool) {
+	for _, tool := range tools {
+		if subfinder, ok := tool.(SubfinderTool); ok {
+			return subfinder, true
+		}
+	}
+	return SubfinderTool{}, false
+}
+
+func withoutTool(tools []Tool, name string) []Tool {
+	var rest []Tool
+	for _, tool := range tools {
+		if tool.Name() != name {
+			rest = append(rest, tool)
+		}
+	}
+	return rest
+}
+
+// discoverBatch runs subfinder once for all domains using a -dL input file
+func (s *Service) discoverBatch(ctx context.Context, subfinder SubfinderTool, domains []string) ([]string, error) {
+	input, err := os.CreateTemp("", "watchtower-subfinder-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subfinder input file: %w", err)
+	}
+	defer os.Remove(input.Name())
+
+	for _, domain := range domains {
+		if _, err := fmt.Fprintln(input, domain); err != nil {
+			input.Close()
+			return nil, fmt.Errorf("failed to write subfinder input file: %w", err)
+		}
+	}
+	if err := input.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write subfinder input file: %w", err)
+	}
+
+	// JSON output tags every host with the input domain it was found for
+	output, err := subprocess.Run(ctx, fmt.Sprintf("%d domains", len(domains)),
+		"subfinder", subfinder.args("-dL", input.Name(), "-silent", "-oJ", "-timeout", "20")...)
+	if err != nil && len(output) == 0 {
+		return nil, err
+	}
+
 	unique := make(map[string]bool)
+	perInput := make(map[string]int)
 	var result []string
-	for _, subdomain := range allSubdomains {
-		if !unique[subdomain] {
-			unique[subdomain] = true
-			result = append(result, subdomain)
+
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
 		}
+
+		var entry struct {
+			Host  string `json:"host"`
+			Input string `json:"input"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Host == "" {
+			// Older subfinder versions print plain hosts
+			entry.Host = line
+		}
+
+		perInput[entry.Input]++
+		if !unique[entry.Host] {
+			unique[entry.Host] = true
+			result = append(result, entry.Host)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
 	}
 
+	log.Printf("Batch subfinder found %d subdomains across %d inputs", len(result), len(perInput))
 	return result, nil
 }
@@ -0,0 +1,128 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"strings"
+
+	"watchtower/internal/domainutil"
+	"watchtower/internal/subprocess"
+)
+
+// Tool is a subdomain enumeration binary that is run once per base domain
+type Tool interface {
+	// Name is the binary looked up in PATH and the source stored for the
+	// domains the tool finds
+	Name() string
+	Run(ctx context.Context, domain string) ([]string, error)
+}
+
+// wildcardTool is a Tool that only runs on base domains from wildcard scope
+// entries and needs no binary in PATH
+type wildcardTool interface {
+	Tool
+	wildcardOnly()
+}
+
+// NewTools returns the tools named in DISCOVERY_TOOLS in the given order.
+// Unknown names are logged and skipped. A non-empty subfinderConfig is
+// passed to subfinder with -config.
+func NewTools(names []string, subfinderConfig string) []Tool {
+	var tools []Tool
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case SourceSubfinder:
+			tools = append(tools, SubfinderTool{ConfigPath: subfinderConfig})
+		case SourceAmass:
+			tools = append(tools, AmassTool{})
+		case SourceAssetfinder:
+			tools = append(tools, AssetfinderTool{})
+		default:
+			log.Printf("Unknown discovery tool %q, skipping", name)
+		}
+	}
+	return tools
+}
+
+// SubfinderTool runs projectdiscovery's subfinder. ConfigPath points to the
+// subfinder config holding the API keys of its passive sources.
+type SubfinderTool struct {
+	ConfigPath string
+}
+
+func (SubfinderTool) Name() string {
+	return SourceSubfinder
+}
+
+func (t SubfinderTool) Run(ctx context.Context, domain string) ([]string, error) {
+	return runTool(ctx, domain, SourceSubfinder, t.args("-d", domain, "-silent", "-timeout", "20")...)
+}
+
+// args appends -config to the given subfinder arguments when a config is set
+func (t SubfinderTool) args(args ...string) []string {
+	if t.ConfigPath != "" {
+		args = append(args, "-config", t.ConfigPath)
+	}
+	return args
+}
+
+// AmassTool runs OWASP amass in passive mode
+type AmassTool struct{}
+
+func (AmassTool) Name() string {
+	return SourceAmass
+}
+
+func (AmassTool) Run(ctx context.Context, domain string) ([]string, error) {
+	return runTool(ctx, domain, SourceAmass, "enum", "-passive", "-nocolor", "-d", domain)
+}
+
+// AssetfinderTool runs tomnomnom's assetfinder
+type AssetfinderTool struct{}
+
+func (AssetfinderTool) Name() string {
+	return SourceAssetfinder
+}
+
+func (AssetfinderTool) Run(ctx context.Context, domain string) ([]string, error) {
+	return runTool(ctx, domain, SourceAssetfinder, "--subs-only", domain)
+}
+
+// runTool runs a tool and parses its output. The tools exit non-zero or are
+// killed by the timeout after printing partial results, so output is parsed
+// even when the run failed.
+func runTool(ctx context.Context, domain, name string, args ...string) ([]string, error) {
+	output, err := subprocess.Run(ctx, domain, name, args...)
+	if err != nil && len(output) == 0 {
+		return nil, err
+	}
+	return parseHosts(string(output), domain), nil
+}
+
+// parseHosts reads one host per line and keeps those under the base domain.
+// Only the first field is used since some amass versions annotate lines.
+func parseHosts(output, domain string) []string {
+	domain = strings.TrimPrefix(domainutil.Normalize(domain), "*.")
+
+	var hosts []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		host := strings.TrimPrefix(domainutil.Normalize(fields[0]), "*.")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,105 @@
+package domainutil
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// profile maps Unicode labels to ASCII the same way a resolver would, but
+// without the strict STD3 rules so hosts like _dmarc.example.com survive.
+var profile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// Normalize returns the canonical form of a host used for storage and
+// deduplication: no protocol, path or port, no trailing dot, lowercase and
+// with internationalized labels converted to ASCII (punycode).
+func Normalize(domain string) string {
+	domain = strings.TrimSpace(domain)
+
+	// Remove protocol
+	if idx := strings.Index(domain, "://"); idx != -1 {
+		domain = domain[idx+3:]
+	}
+
+	// Remove paths, queries and fragments
+	if idx := strings.IndexAny(domain, "/?#"); idx != -1 {
+		domain = domain[:idx]
+	}
+
+	// Remove credentials
+	if idx := strings.LastIndex(domain, "@"); idx != -1 {
+		domain = domain[idx+1:]
+	}
+
+	// Remove ports
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	} else if idx := strings.LastIndex(domain, ":"); idx != -1 && !strings.Contains(domain[:idx], ":") {
+		domain = domain[:idx]
+	}
+
+	domain = strings.TrimRight(domain, ".")
+	domain = strings.ToLower(domain)
+
+	return ToASCII(domain)
+}
+
+// StripWildcards reduces a wildcard pattern to the host it is anchored on by
+// dropping every label up to and including the last one that contains a
+// "*", e.g. "*.*.example.com" or "api-*.example.com" become "example.com".
+func StripWildcards(domain string) string {
+	if idx := strings.LastIndex(domain, "*"); idx != -1 {
+		dot := strings.Index(domain[idx:], ".")
+		if dot == -1 {
+			return ""
+		}
+		domain = domain[idx+dot+1:]
+	}
+	return domain
+}
+
+// IsValidHost reports whether a normalized host looks like a host name that
+// can be resolved: at least two labels of letters, digits, hyphens and
+// underscores, within the DNS length limits. IP addresses are valid too.
+func IsValidHost(domain string) bool {
+	if net.ParseIP(domain) != nil {
+		return true
+	}
+	if len(domain) > 253 || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ToASCII converts a Unicode host to its punycode form. Hosts that are already
+// ASCII, or that cannot be converted, are returned unchanged.
+func ToASCII(domain string) string {
+	if isASCII(domain) {
+		return domain
+	}
+	ascii, err := profile.ToASCII(domain)
+	if err != nil {
+		return domain
+	}
+	return ascii
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
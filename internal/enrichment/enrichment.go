@@ -1,18 +1,52 @@
 package enrichment
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os/exec"
 	"sync"
 	"time"
+
+	"watchtower/internal/domainutil"
+	"watchtower/internal/subprocess"
 )
 
-type Service struct{}
+// ErrHTTPXMissing is returned when httpx isn't installed
+var ErrHTTPXMissing = errors.New("httpx not found in PATH")
+
+// Service runs httpx against domains. The concurrency limit is shared by all
+// callers, so programs scanned in parallel don't multiply the httpx processes.
+type Service struct {
+	semaphore chan struct{}
 
-func NewService() *Service {
-	return &Service{}
+	lookup    sync.Once
+	available bool
+}
+
+func NewService(concurrency int) *Service {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Service{semaphore: make(chan struct{}, concurrency)}
+}
+
+// Available reports whether httpx is installed. It is looked up once and a
+// missing binary is logged once, so callers can skip enrichment instead of
+// failing for every host.
+func (s *Service) Available() bool {
+	s.lookup.Do(func() {
+		if _, err := exec.LookPath("httpx"); err != nil {
+			log.Printf("httpx not found in PATH, domain enrichment is disabled")
+			return
+		}
+		s.available = true
+	})
+	return s.available
 }
 
 type DomainDetails struct {
@@ -24,13 +58,13 @@ type DomainDetails struct {
 	Server       string
 	ContentType  string
 	ContentLength int64
+	FaviconHash  *int32 // nil if the host serves no favicon
 }
 
 // EnrichDomain uses httpx to get detailed information about a domain
 func (s *Service) EnrichDomain(ctx context.Context, domain string) (*DomainDetails, error) {
-	// Check if httpx is available
-	if _, err := exec.LookPath("httpx"); err != nil {
-		return nil, fmt.Errorf("httpx not found in PATH: %w", err)
+	if !s.Available() {
+		return nil, ErrHTTPXMissing
 	}
 
 	// Create context with timeout
@@ -38,8 +72,8 @@ func (s *Service) EnrichDomain(ctx context.Context, domain string) (*DomainDetai
 	defer cancel()
 
 	// Run httpx with JSON output
-	cmd := exec.CommandContext(cmdCtx, "httpx", 
-		"-u", fmt.Sprintf("https://%s", domain),
+	output, err := subprocess.Run(cmdCtx, domain, "httpx",
+		"-u", fmt.Sprintf("https://%s", domainutil.ToASCII(domain)),
 		"-json",
 		"-title",
 		"-tech-detect",
@@ -47,8 +81,6 @@ func (s *Service) EnrichDomain(ctx context.Context, domain string) (*DomainDetai
 		"-silent",
 		"-timeout", "10",
 	)
-
-	output, err := cmd.Output()
 	if err != nil {
 		// Try HTTP if HTTPS fails
 		return s.enrichDomainHTTP(ctx, domain)
@@ -58,18 +90,8 @@ func (s *Service) EnrichDomain(ctx context.Context, domain string) (*DomainDetai
 		return s.enrichDomainHTTP(ctx, domain)
 	}
 
-	// Parse JSON output
-	var httpxResult struct {
-		URL           string   `json:"url"`
-		StatusCode    int      `json:"status_code"`
-		Title         string   `json:"title"`
-		Technologies  []string `json:"technologies"`
-		Server        string   `json:"server"`
-		ContentType   string   `json:"content_type"`
-		ContentLength int64    `json:"content_length"`
-	}
-
-	if err := json.Unmarshal(output, &httpxResult); err != nil {
+	httpxResult, err := parseHTTPXOutput(output)
+	if err != nil {
 		// If JSON parsing fails, try HTTP
 		return s.enrichDomainHTTP(ctx, domain)
 	}
@@ -90,8 +112,8 @@ func (s *Service) enrichDomainHTTP(ctx context.Context, domain string) (*DomainD
 	cmdCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(cmdCtx, "httpx",
-		"-u", fmt.Sprintf("http://%s", domain),
+	output, err := subprocess.Run(cmdCtx, domain, "httpx",
+		"-u", fmt.Sprintf("http://%s", domainutil.ToASCII(domain)),
 		"-json",
 		"-title",
 		"-tech-detect",
@@ -99,13 +121,10 @@ func (s *Service) enrichDomainHTTP(ctx context.Context, domain string) (*DomainD
 		"-silent",
 		"-timeout", "10",
 	)
-
-	output, err := cmd.Output()
 	if err != nil {
-		return &DomainDetails{
-			Domain: domain,
-			Status: "down",
-		}, nil
+		// httpx exits cleanly for unreachable hosts, so a failed run is a
+		// tool error rather than a down host
+		return nil, err
 	}
 
 	if len(output) == 0 {
@@ -115,17 +134,8 @@ func (s *Service) enrichDomainHTTP(ctx context.Context, domain string) (*DomainD
 		}, nil
 	}
 
-	var httpxResult struct {
-		URL           string   `json:"url"`
-		StatusCode    int      `json:"status_code"`
-		Title         string   `json:"title"`
-		Technologies  []string `json:"technologies"`
-		Server        string   `json:"server"`
-		ContentType   string   `json:"content_type"`
-		ContentLength int64    `json:"content_length"`
-	}
-
-	if err := json.Unmarshal(output, &httpxResult); err != nil {
+	httpxResult, err := parseHTTPXOutput(output)
+	if err != nil {
 		return &DomainDetails{
 			Domain: domain,
 			Status: "unknown",
@@ -144,10 +154,67 @@ func (s *Service) enrichDomainHTTP(ctx context.Context, domain string) (*DomainD
 	}, nil
 }
 
+// httpxResult is one line of httpx -json output
+type httpxResult struct {
+	URL           string   `json:"url"`
+	StatusCode    int      `json:"status_code"`
+	Title         string   `json:"title"`
+	Technologies  []string `json:"technologies"`
+	Server        string   `json:"server"`
+	ContentType   string   `json:"content_type"`
+	ContentLength int64    `json:"content_length"`
+
+	// Field names used by current httpx releases
+	Tech      []string `json:"tech"`
+	WebServer string   `json:"webserver"`
+}
+
+// parseHTTPXOutput returns the first result of httpx -json output, which is
+// newline-delimited JSON with one object per probed URL. Lines that aren't
+// JSON objects, such as stray log output, are skipped.
+func parseHTTPXOutput(output []byte) (*httpxResult, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	// Responses with large headers or bodies produce long lines
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var lastErr error
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var result httpxResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			lastErr = err
+			continue
+		}
+		if len(result.Technologies) == 0 {
+			result.Technologies = result.Tech
+		}
+		if result.Server == "" {
+			result.Server = result.WebServer
+		}
+		return &result, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("no parsable httpx result: %w", lastErr)
+	}
+	return nil, fmt.Errorf("no httpx result in output")
+}
+
+// EnrichResult is the outcome of enriching one domain: either its details
+// or the error that prevented enrichment
+type EnrichResult struct {
+	Details *DomainDetails
+	Err     error
+}
+
 // EnrichDomains enriches multiple domains in parallel
-func (s *Service) EnrichDomains(ctx context.Context, domains []string) map[string]*DomainDetails {
-	results := make(map[string]*DomainDetails)
-	semaphore := make(chan struct{}, 10) // Limit concurrent httpx processes
+func (s *Service) EnrichDomains(ctx context.Context, domains []string) map[string]EnrichResult {
+	results := make(map[string]EnrichResult)
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 
@@ -155,15 +222,29 @@ func (s *Service) EnrichDomains(ctx context.Context, domains []string) map[strin
 		wg.Add(1)
 		go func(d string) {
 			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			details, err := s.EnrichDomain(ctx, d)
-			if err == nil && details != nil {
+			select {
+			case s.semaphore <- struct{}{}:
+			case <-ctx.Done():
 				mu.Lock()
-				results[d] = details
+				results[d] = EnrichResult{Err: ctx.Err()}
 				mu.Unlock()
+				return
+			}
+			defer func() { <-s.semaphore }()
+
+			details, err := s.EnrichDomain(ctx, d)
+			if err == nil && details == nil {
+				err = fmt.Errorf("no details returned")
+			}
+			// A missing favicon is common and not an enrichment failure
+			if err == nil && details.Status == "up" {
+				if hash, err := FaviconHash(ctx, d); err == nil {
+					details.FaviconHash = &hash
+				}
 			}
+			mu.Lock()
+			results[d] = EnrichResult{Details: details, Err: err}
+			mu.Unlock()
 		}(domain)
 	}
 
@@ -0,0 +1,102 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseHTTPXOutput(t *testing.T) {
+	const first = `{"timestamp":"2024-05-02T10:15:32.118Z","url":"https://app.example.com","input":"app.example.com","title":"Example App","scheme":"https","webserver":"nginx/1.25.3","content_type":"text/html","method":"GET","host":"93.184.216.34","port":"443","content_length":5120,"status_code":200,"tech":["Nginx:1.25.3","React"],"failed":false}`
+	const second = `{"timestamp":"2024-05-02T10:15:32.402Z","url":"https://app.example.com:8443","input":"app.example.com","title":"Admin","webserver":"Apache","content_length":0,"status_code":401,"tech":["Apache HTTP Server"],"failed":false}`
+	const legacy = `{"url":"http://old.example.com","status_code":301,"title":"Moved","technologies":["IIS:10.0"],"server":"Microsoft-IIS/10.0"}`
+
+	tests := []struct {
+		name    string
+		output  string
+		want    *httpxResult
+		wantErr bool
+	}{
+		{
+			name:   "several JSON lines take the first",
+			output: first + "\n" + second + "\n",
+			want: &httpxResult{
+				URL:           "https://app.example.com",
+				StatusCode:    200,
+				Title:         "Example App",
+				Technologies:  []string{"Nginx:1.25.3", "React"},
+				Server:        "nginx/1.25.3",
+				ContentType:   "text/html",
+				ContentLength: 5120,
+			},
+		},
+		{
+			name:   "trailing newline",
+			output: second + "\n\n",
+			want: &httpxResult{
+				URL:          "https://app.example.com:8443",
+				StatusCode:   401,
+				Title:        "Admin",
+				Technologies: []string{"Apache HTTP Server"},
+				Server:       "Apache",
+			},
+		},
+		{
+			name:   "leading banner line",
+			output: "[INF] Current httpx version v1.6.0 (latest)\n" + legacy + "\n",
+			want: &httpxResult{
+				URL:          "http://old.example.com",
+				StatusCode:   301,
+				Title:        "Moved",
+				Technologies: []string{"IIS:10.0"},
+				Server:       "Microsoft-IIS/10.0",
+			},
+		},
+		{
+			name:    "empty output",
+			output:  "",
+			wantErr: true,
+		},
+		{
+			name:    "only a broken line",
+			output:  `{"url": "https://app.example.com",` + "\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHTTPXOutput([]byte(tt.output))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseHTTPXOutput() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHTTPXOutput() error = %v", err)
+			}
+			// The raw fields of current releases are folded into the
+			// documented ones
+			got.Tech, got.WebServer = nil, ""
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHTTPXOutput() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingHTTPX(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	s := NewService(1)
+
+	if s.Available() {
+		t.Fatal("Available() = true without httpx in PATH")
+	}
+	for _, domain := range []string{"a.example.com", "b.example.com"} {
+		if _, err := s.EnrichDomain(context.Background(), domain); !errors.Is(err, ErrHTTPXMissing) {
+			t.Errorf("EnrichDomain(%s): %v, want ErrHTTPXMissing", domain, err)
+		}
+	}
+}
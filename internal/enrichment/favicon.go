@@ -0,0 +1,125 @@
+package enrichment
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/http"
+	"strings"
+	"time"
+
+	"watchtower/internal/domainutil"
+)
+
+// maxFaviconSize bounds how much of a favicon is read
+const maxFaviconSize = 1 << 20
+
+// faviconClient fetches favicons. Certificates aren't verified since the
+// hash is only used to correlate hosts, the same as httpx does.
+var faviconClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+// FaviconHash fetches /favicon.ico of a domain over HTTPS, falling back to
+// HTTP, and returns its Shodan-style mmh3 hash
+func FaviconHash(ctx context.Context, domain string) (int32, error) {
+	var lastErr error
+	for _, scheme := range []string{"https", "http"} {
+		data, err := fetchFavicon(ctx, fmt.Sprintf("%s://%s/favicon.ico", scheme, domainutil.ToASCII(domain)))
+		if err == nil {
+			return faviconHash(data), nil
+		}
+		lastErr = err
+	}
+	return 0, lastErr
+}
+
+func fetchFavicon(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := faviconClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFaviconSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s: empty favicon", url)
+	}
+	return data, nil
+}
+
+// faviconHash is the hash Shodan indexes as http.favicon.hash: mmh3 of the
+// base64 encoding with a newline after every 76 characters, as produced by
+// Python's base64.encodebytes
+func faviconHash(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteByte('\n')
+	return int32(murmur3([]byte(b.String())))
+}
+
+// murmur3 is MurmurHash3 x86 32-bit with seed 0
+func murmur3(data []byte) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	var h uint32
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := uint32(data[i*4]) | uint32(data[i*4+1])<<8 | uint32(data[i*4+2])<<16 | uint32(data[i*4+3])<<24
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
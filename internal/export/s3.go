@@ -0,0 +1,76 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type S3Config struct {
+	Endpoint  string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	Prefix    string
+	UseSSL    bool
+}
+
+// S3Exporter uploads scan artifacts to an S3-compatible bucket
+type S3Exporter struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Exporter creates an exporter for the configured bucket. It returns
+// nil without error when no endpoint or bucket is configured.
+func NewS3Exporter(cfg S3Config) (*S3Exporter, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, nil
+	}
+
+	// Accept endpoints written as URLs as well as bare host:port
+	endpoint := cfg.Endpoint
+	if strings.HasPrefix(endpoint, "https://") {
+		endpoint = strings.TrimPrefix(endpoint, "https://")
+		cfg.UseSSL = true
+	} else if strings.HasPrefix(endpoint, "http://") {
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+		cfg.UseSSL = false
+	}
+
+	client, err := minio.New(strings.TrimSuffix(endpoint, "/"), &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	return &S3Exporter{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: strings.Trim(cfg.Prefix, "/"),
+	}, nil
+}
+
+// Upload stores data under name, below the configured prefix
+func (e *S3Exporter) Upload(ctx context.Context, name string, data []byte, contentType string) error {
+	key := name
+	if e.prefix != "" {
+		key = e.prefix + "/" + name
+	}
+
+	_, err := e.client.PutObject(ctx, e.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to bucket %s: %w", key, e.bucket, err)
+	}
+	return nil
+}
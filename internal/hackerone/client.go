@@ -1,10 +1,13 @@
 package hackerone
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"time"
 )
@@ -13,8 +16,31 @@ type Client struct {
 	token      string
 	httpClient *http.Client
 	baseURL    string
+	cursors    CursorStore
+	cursorTTL  time.Duration
+
+	// Transient failures are retried maxRetries times, waiting
+	// retryBaseDelay before the first retry and doubling it after each
+	maxRetries     int
+	retryBaseDelay time.Duration
+}
+
+// CursorStore persists the pagination state of an interrupted program fetch
+// so the next fetch can resume it. LoadCursor returns an empty next URL when
+// nothing is stored.
+type CursorStore interface {
+	LoadCursor(key string) (next string, state []byte, savedAt time.Time, err error)
+	SaveCursor(key, next string, state []byte) error
+	DeleteCursor(key string) error
 }
 
+// ErrProgramNotFound is returned by GetProgram for handles HackerOne doesn't
+// know
+var ErrProgramNotFound = fmt.Errorf("program not found")
+
+// programsCursorKey identifies the GetAllPrograms cursor in the store
+const programsCursorKey = "hackerone_programs"
+
 type Program struct {
 	ID         string `json:"id"`
 	Type       string `json:"type"`
@@ -43,7 +69,9 @@ func NewClient(token string) *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		baseURL: "https://api.hackerone.com/v1",
+		baseURL:        "https://api.hackerone.com/v1",
+		maxRetries:     3,
+		retryBaseDelay: time.Second,
 	}
 }
 
@@ -70,12 +98,33 @@ func (c *Client) setAuth(req *http.Request) {
 	}
 }
 
-func (c *Client) GetAllPrograms() ([]Program, error) {
+// SetRetryPolicy changes how often transient failures are retried and the
+// delay before the first retry, which doubles after each one
+func (c *Client) SetRetryPolicy(maxRetries int, baseDelay time.Duration) {
+	c.maxRetries = maxRetries
+	c.retryBaseDelay = baseDelay
+}
+
+// EnableResume makes GetAllPrograms save its position after every page and
+// resume from it on the next call if the saved cursor is younger than ttl.
+// The cursor is dropped after a complete pass.
+func (c *Client) EnableResume(store CursorStore, ttl time.Duration) {
+	c.cursors = store
+	c.cursorTTL = ttl
+}
+
+func (c *Client) GetAllPrograms(ctx context.Context) ([]Program, error) {
 	var allPrograms []Program
 	url := fmt.Sprintf("%s/hackers/programs", c.baseURL)
 
+	if next, resumed := c.resumeCursor(); next != "" {
+		log.Printf("Resuming program fetch after %d programs from an interrupted run", len(resumed))
+		url = next
+		allPrograms = resumed
+	}
+
 	for url != "" {
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -83,7 +132,7 @@ func (c *Client) GetAllPrograms() ([]Program, error) {
 		c.setAuth(req)
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := c.httpClient.Do(req)
+		resp, err := c.doWithRetry(req)
 		if err != nil {
 			return nil, err
 		}
@@ -107,28 +156,197 @@ func (c *Client) GetAllPrograms() ([]Program, error) {
 		// Check for next page
 		if programsResp.Links.Next != nil {
 			url = *programsResp.Links.Next
+			c.saveCursor(url, allPrograms)
 		} else {
 			url = ""
 		}
 
 		// Rate limiting - be respectful
-		time.Sleep(500 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	if c.cursors != nil {
+		if err := c.cursors.DeleteCursor(programsCursorKey); err != nil {
+			log.Printf("Error clearing program fetch cursor: %v", err)
+		}
 	}
 
 	return allPrograms, nil
 }
 
-func (c *Client) GetProgramScope(handle string) ([]string, error) {
+// resumeCursor returns the next page URL and the programs fetched before it
+// if a fresh cursor is stored
+func (c *Client) resumeCursor() (string, []Program) {
+	if c.cursors == nil || c.cursorTTL <= 0 {
+		return "", nil
+	}
+
+	next, state, savedAt, err := c.cursors.LoadCursor(programsCursorKey)
+	if err != nil {
+		log.Printf("Error loading program fetch cursor: %v", err)
+		return "", nil
+	}
+	if next == "" || time.Since(savedAt) > c.cursorTTL {
+		return "", nil
+	}
+
+	var programs []Program
+	if err := json.Unmarshal(state, &programs); err != nil {
+		log.Printf("Ignoring unreadable program fetch cursor: %v", err)
+		return "", nil
+	}
+	return next, programs
+}
+
+func (c *Client) saveCursor(next string, programs []Program) {
+	if c.cursors == nil || c.cursorTTL <= 0 {
+		return
+	}
+
+	state, err := json.Marshal(programs)
+	if err != nil {
+		log.Printf("Error encoding program fetch cursor: %v", err)
+		return
+	}
+	if err := c.cursors.SaveCursor(programsCursorKey, next, state); err != nil {
+		log.Printf("Error saving program fetch cursor: %v", err)
+	}
+}
+
+// ProgramURL returns the public page of a program. The URL reported by the
+// API is used when it points at the program's handle on hackerone.com;
+// empty values and values left over from renamed programs are replaced by
+// https://hackerone.com/<handle>.
+func ProgramURL(handle, apiURL string) string {
+	canonical := "https://hackerone.com/" + handle
+	if handle == "" {
+		return apiURL
+	}
+
+	parsed, err := neturl.Parse(strings.TrimSpace(apiURL))
+	if err != nil || parsed.Scheme != "https" {
+		return canonical
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	first, _, _ := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if host != "hackerone.com" || !strings.EqualFold(first, handle) {
+		return canonical
+	}
+	return apiURL
+}
+
+// GetProgram fetches a single program by its handle
+func (c *Client) GetProgram(ctx context.Context, handle string) (*Program, error) {
+	url := fmt.Sprintf("%s/hackers/programs/%s", c.baseURL, handle)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setAuth(req)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrProgramNotFound, handle)
+		}
+		return nil, fmt.Errorf("HackerOne API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var program Program
+	if err := json.NewDecoder(resp.Body).Decode(&program); err != nil {
+		return nil, err
+	}
+	if program.Attributes.Handle == "" {
+		program.Attributes.Handle = handle
+	}
+	return &program, nil
+}
+
+// Scope is a single structured scope entry of a program
+type Scope struct {
+	Identifier            string `json:"identifier"`
+	AssetType             string `json:"asset_type"`
+	EligibleForBounty     bool   `json:"eligible_for_bounty"`
+	EligibleForSubmission bool   `json:"eligible_for_submission"`
+	Instruction           string `json:"instruction,omitempty"`
+	MaxSeverity           string `json:"max_severity,omitempty"`
+}
+
+// scopeAttributes mirrors the structured-scope attributes of the API
+type scopeAttributes struct {
+	AssetIdentifier       string `json:"asset_identifier"`
+	AssetType             string `json:"asset_type"`
+	EligibleForBounty     bool   `json:"eligible_for_bounty"`
+	EligibleForSubmission bool   `json:"eligible_for_submission"`
+	Instruction           string `json:"instruction"`
+	MaxSeverity           string `json:"max_severity"`
+}
+
+func (a scopeAttributes) toScope() Scope {
+	return Scope{
+		Identifier:            a.AssetIdentifier,
+		AssetType:             a.AssetType,
+		EligibleForBounty:     a.EligibleForBounty,
+		EligibleForSubmission: a.EligibleForSubmission,
+		Instruction:           a.Instruction,
+		MaxSeverity:           a.MaxSeverity,
+	}
+}
+
+// IsWeb reports whether the asset can hold domains and is probed; other
+// types like CIDR, mobile apps or source code are only recorded
+func (s Scope) IsWeb() bool {
+	return s.AssetType == "URL" || s.AssetType == "DOMAIN" || s.AssetType == "WILDCARD"
+}
+
+// GetProgramScope returns the domain-like scope identifiers of a program.
+// Out-of-scope assets, those not eligible for submission, are left out
+// unless includeIneligible is set.
+func (c *Client) GetProgramScope(ctx context.Context, handle string, includeIneligible bool) ([]string, error) {
+	scopes, err := c.GetProgramScopeDetailed(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !scope.IsWeb() {
+			continue
+		}
+		if !scope.EligibleForSubmission && !includeIneligible {
+			continue
+		}
+		domains = append(domains, scope.Identifier)
+	}
+	return domains, nil
+}
+
+// GetProgramScopeDetailed returns every scope entry of a program, of any
+// asset type, together with its eligibility metadata
+func (c *Client) GetProgramScopeDetailed(ctx context.Context, handle string) ([]Scope, error) {
 	// Try the direct structured_scopes endpoint first (more reliable)
-	domains, err := c.getProgramScopesDirect(handle)
-	if err == nil && len(domains) > 0 {
-		return domains, nil
+	scopes, err := c.getProgramScopesDirect(ctx, handle)
+	if err == nil && len(scopes) > 0 {
+		return scopes, nil
 	}
 
 	// Fallback: try to get from program endpoint with included scopes
 	url := fmt.Sprintf("%s/hackers/programs/%s?include=structured_scopes", c.baseURL, handle)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +354,7 @@ func (c *Client) GetProgramScope(handle string) ([]string, error) {
 	c.setAuth(req)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
@@ -148,7 +366,7 @@ func (c *Client) GetProgramScope(handle string) ([]string, error) {
 			return nil, fmt.Errorf("HackerOne API authentication failed (401) for program scope. Please check your API token. Error: %s", string(body))
 		}
 		// If we can't get scopes, return empty (will fall back to program domain)
-		return []string{}, nil
+		return []Scope{}, nil
 	}
 
 	// Parse JSON:API format with included data
@@ -170,57 +388,40 @@ func (c *Client) GetProgramScope(handle string) ([]string, error) {
 			} `json:"relationships"`
 		} `json:"data"`
 		Included []struct {
-			ID         string `json:"id"`
-			Type       string `json:"type"`
-			Attributes struct {
-				AssetIdentifier       string `json:"asset_identifier"`
-				AssetType             string `json:"asset_type"`
-				EligibleForBounty     bool   `json:"eligible_for_bounty"`
-				EligibleForSubmission bool   `json:"eligible_for_submission"`
-			} `json:"attributes"`
+			ID         string          `json:"id"`
+			Type       string          `json:"type"`
+			Attributes scopeAttributes `json:"attributes"`
 		} `json:"included"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&programResponse); err != nil {
 		// If parsing fails, return empty (will use program domain as fallback)
-		return []string{}, nil
+		return []Scope{}, nil
 	}
 
 	// Map scope IDs to actual scope data from included array
-	scopeMap := make(map[string]struct {
-		AssetIdentifier string
-		AssetType       string
-	})
+	scopeMap := make(map[string]scopeAttributes)
 	for _, included := range programResponse.Included {
 		if included.Type == "structured-scope" {
-			scopeMap[included.ID] = struct {
-				AssetIdentifier string
-				AssetType       string
-			}{
-				AssetIdentifier: included.Attributes.AssetIdentifier,
-				AssetType:       included.Attributes.AssetType,
-			}
+			scopeMap[included.ID] = included.Attributes
 		}
 	}
 
-	var resultDomains []string
+	var result []Scope
 	for _, scopeRef := range programResponse.Data.Relationships.StructuredScopes.Data {
 		if scope, ok := scopeMap[scopeRef.ID]; ok {
-			// Include domains, URLs, and wildcards
-			if scope.AssetType == "URL" || scope.AssetType == "DOMAIN" || scope.AssetType == "WILDCARD" {
-				resultDomains = append(resultDomains, scope.AssetIdentifier)
-			}
+			result = append(result, scope.toScope())
 		}
 	}
 
-	return resultDomains, nil
+	return result, nil
 }
 
 // getProgramScopesDirect tries to get scopes using the direct structured_scopes endpoint
-func (c *Client) getProgramScopesDirect(handle string) ([]string, error) {
+func (c *Client) getProgramScopesDirect(ctx context.Context, handle string) ([]Scope, error) {
 	url := fmt.Sprintf("%s/hackers/programs/%s/structured_scopes", c.baseURL, handle)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -228,7 +429,7 @@ func (c *Client) getProgramScopesDirect(handle string) ([]string, error) {
 	c.setAuth(req)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
@@ -236,32 +437,23 @@ func (c *Client) getProgramScopesDirect(handle string) ([]string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		// If this endpoint doesn't work, return empty (will fall back to program domain)
-		return []string{}, nil
+		return []Scope{}, nil
 	}
 
 	var scopesResponse struct {
 		Data []struct {
-			Attributes struct {
-				AssetIdentifier       string `json:"asset_identifier"`
-				AssetType             string `json:"asset_type"`
-				EligibleForBounty     bool   `json:"eligible_for_bounty"`
-				EligibleForSubmission bool   `json:"eligible_for_submission"`
-			} `json:"attributes"`
+			Attributes scopeAttributes `json:"attributes"`
 		} `json:"data"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&scopesResponse); err != nil {
-		return []string{}, nil
+		return []Scope{}, nil
 	}
 
-	var domains []string
+	var scopes []Scope
 	for _, scope := range scopesResponse.Data {
-		// Include all asset types that could be domains
-		assetType := scope.Attributes.AssetType
-		if assetType == "URL" || assetType == "DOMAIN" || assetType == "WILDCARD" {
-			domains = append(domains, scope.Attributes.AssetIdentifier)
-		}
+		scopes = append(scopes, scope.Attributes.toScope())
 	}
 
-	return domains, nil
+	return scopes, nil
 }
@@ -0,0 +1,33 @@
+package hackerone
+
+import "testing"
+
+func TestProgramURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle string
+		apiURL string
+		want   string
+	}{
+		{"matching URL is kept", "acme", "https://hackerone.com/acme", "https://hackerone.com/acme"},
+		{"subpage is kept", "acme", "https://hackerone.com/acme/policy_scopes", "https://hackerone.com/acme/policy_scopes"},
+		{"www host and case", "acme", "https://www.hackerone.com/Acme", "https://www.hackerone.com/Acme"},
+		{"empty URL", "acme", "", "https://hackerone.com/acme"},
+		{"whitespace URL", "acme", "   ", "https://hackerone.com/acme"},
+		{"renamed program", "acme", "https://hackerone.com/acme_old", "https://hackerone.com/acme"},
+		{"handle prefix only", "acme", "https://hackerone.com/acmecorp", "https://hackerone.com/acme"},
+		{"other host", "acme", "https://example.com/acme", "https://hackerone.com/acme"},
+		{"plain http", "acme", "http://hackerone.com/acme", "https://hackerone.com/acme"},
+		{"relative path", "acme", "/acme", "https://hackerone.com/acme"},
+		{"unparsable URL", "acme", "https://hackerone.com/%zz", "https://hackerone.com/acme"},
+		{"no handle keeps the API value", "", "https://hackerone.com/acme", "https://hackerone.com/acme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProgramURL(tt.handle, tt.apiURL); got != tt.want {
+				t.Errorf("ProgramURL(%q, %q) = %q, want %q", tt.handle, tt.apiURL, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package hackerone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// graphqlURL is HackerOne's public GraphQL endpoint. It serves the directory
+// data of public programs without authentication.
+const graphqlURL = "https://hackerone.com/graphql"
+
+// ProgramMetadata is directory data of a program that the REST API doesn't
+// expose. Fields are nil when HackerOne doesn't publish them.
+type ProgramMetadata struct {
+	BountyMin       *float64
+	BountyMax       *float64
+	Currency        string
+	ResolvedReports *int
+}
+
+const programMetadataQuery = `query ProgramMetadata($handle: String!) {
+  team(handle: $handle) {
+    currency
+    resolved_report_count
+    top_bounty_lower_amount
+    top_bounty_upper_amount
+  }
+}`
+
+// GetProgramMetadata fetches the bounty range and resolved report count of a
+// program from the GraphQL API
+func (c *Client) GetProgramMetadata(ctx context.Context, handle string) (*ProgramMetadata, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"query":     programMetadataQuery,
+		"variables": map[string]string{"handle": handle},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", graphqlURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("HackerOne GraphQL error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data struct {
+			Team *struct {
+				Currency            string   `json:"currency"`
+				ResolvedReportCount *int     `json:"resolved_report_count"`
+				TopBountyLower      *float64 `json:"top_bounty_lower_amount"`
+				TopBountyUpper      *float64 `json:"top_bounty_upper_amount"`
+			} `json:"team"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("HackerOne GraphQL error: %s", result.Errors[0].Message)
+	}
+
+	team := result.Data.Team
+	if team == nil {
+		return nil, fmt.Errorf("program %s not found", handle)
+	}
+	return &ProgramMetadata{
+		BountyMin:       team.TopBountyLower,
+		BountyMax:       team.TopBountyUpper,
+		Currency:        team.Currency,
+		ResolvedReports: team.ResolvedReportCount,
+	}, nil
+}
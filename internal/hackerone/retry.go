@@ -0,0 +1,86 @@
+package hackerone
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetryAfter caps how long a Retry-After header can stall a scan
+const maxRetryAfter = time.Minute
+
+// doWithRetry sends a request, retrying network errors, 5xx responses and
+// 429 Too Many Requests with exponential backoff. A Retry-After header
+// longer than the backoff is honored. Other responses, including 401 and
+// 403, are returned as is.
+func (c *Client) doWithRetry(req *http.Request) (*http.Response, error) {
+	backoff := c.retryBaseDelay
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if attempt >= c.maxRetries || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := backoff
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("status %d", resp.StatusCode)
+			if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > wait {
+				wait = retryAfter
+			}
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		log.Printf("HackerOne request %s %s failed (%s), retrying in %s (%d/%d)",
+			req.Method, req.URL.Path, reason, wait, attempt+1, c.maxRetries)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether a failed request is worth repeating
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date, capped at maxRetryAfter
+func parseRetryAfter(value string) time.Duration {
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = time.Until(at)
+	}
+	if wait < 0 {
+		return 0
+	}
+	if wait > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return wait
+}
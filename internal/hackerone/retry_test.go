@@ -0,0 +1,137 @@
+package hackerone
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retryServer answers the first len(statuses) requests with those statuses
+// and 200 afterwards, setting Retry-After on each failure if given
+func retryServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func testClient(maxRetries int) *Client {
+	client := NewClient("token")
+	client.SetRetryPolicy(maxRetries, 0)
+	return client
+}
+
+func get(t *testing.T, client *Client, url string) int {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.doWithRetry(req)
+	if err != nil {
+		t.Fatalf("doWithRetry() error = %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestDoWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   int
+		wantStatus   int
+		wantRequests int32
+	}{
+		{"5xx is retried", []int{500, 502, 503}, 3, 200, 4},
+		{"429 is retried", []int{429}, 3, 200, 2},
+		{"gives up after max retries", []int{503, 503, 503, 503}, 3, 503, 4},
+		{"401 is not retried", []int{401}, 3, 401, 1},
+		{"403 is not retried", []int{403}, 3, 403, 1},
+		{"404 is not retried", []int{404}, 3, 404, 1},
+		{"no retries configured", []int{500}, 0, 500, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := retryServer(t, "", tt.statuses...)
+
+			if got := get(t, testClient(tt.maxRetries), server.URL); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryHonorsRetryAfter(t *testing.T) {
+	server, requests := retryServer(t, "1", http.StatusTooManyRequests)
+
+	start := time.Now()
+	if got := get(t, testClient(3), server.URL); got != http.StatusOK {
+		t.Fatalf("status = %d, want 200", got)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the 1s Retry-After", elapsed)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestDoWithRetryStopsOnCancel(t *testing.T) {
+	server, requests := retryServer(t, "30", http.StatusServiceUnavailable)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testClient(3).doWithRetry(req); err == nil {
+		t.Fatal("doWithRetry() succeeded, want the context error")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"garbage", 0},
+		{"0", 0},
+		{"-5", 0},
+		{"7", 7 * time.Second},
+		{"86400", maxRetryAfter},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+		{time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat), maxRetryAfter},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package healthcheck
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// certStatus validates the certificate presented on the first hop of an HTTPS
+// response against the requested host name and the system roots. With verification
+// disabled on the transport this is the only place invalid certs show up.
+func certStatus(resp *http.Response) (bool, string) {
+	// Follow redirects back to the response of the original request
+	first := resp
+	for first.Request != nil && first.Request.Response != nil {
+		first = first.Request.Response
+	}
+	if first.TLS == nil || first.Request == nil {
+		return false, "no TLS connection state"
+	}
+
+	if err := verifyCertificate(first.TLS, first.Request.URL.Hostname()); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+func verifyCertificate(state *tls.ConnectionState, host string) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// certError extracts the certificate problem from a failed HTTPS request, if
+// the request failed because of the certificate
+func certError(err error) (string, bool) {
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &verifyErr) {
+		return verifyErr.Err.Error(), true
+	}
+
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &hostnameErr) || errors.As(err, &authorityErr) || errors.As(err, &invalidErr) {
+		return err.Error(), true
+	}
+	return "", false
+}
@@ -2,131 +2,490 @@ package healthcheck
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"watchtower/internal/domainutil"
 )
 
 type Service struct {
-	timeout time.Duration
-	workers int
-	client  *http.Client
+	timeout   time.Duration
+	workers   int
+	client    *http.Client
+	probe     Probe
+	userAgent string
+	headers   map[string]string
+	ports     []int
+	retries   int
+	retryWait time.Duration // base delay between retries
 }
 
-func NewService(timeout time.Duration, workers int) *Service {
-	return &Service{
-		timeout: timeout,
-		workers: workers,
-		client: &http.Client{
-			Timeout: timeout,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     30 * time.Second,
-			},
+// defaultRetryWait is the base delay between retries of a failed check
+const defaultRetryWait = 500 * time.Millisecond
+
+// DefaultPorts are the ports checked unless HEALTHCHECK_PORTS says otherwise
+var DefaultPorts = []int{80, 443}
+
+// Probe describes the request used to decide whether a host is alive.
+// The zero value requests the root path with GET.
+type Probe struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// ParseProbe parses a probe spec of the form "[METHOD ]path[ body]",
+// e.g. "/health" or "POST /api/ping {\"ping\":true}".
+func ParseProbe(spec string) (Probe, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Probe{}, fmt.Errorf("empty probe")
+	}
+
+	probe := Probe{Method: http.MethodGet}
+	if !strings.HasPrefix(spec, "/") {
+		method, rest, _ := strings.Cut(spec, " ")
+		probe.Method = strings.ToUpper(method)
+		spec = strings.TrimSpace(rest)
+	}
+
+	path, body, _ := strings.Cut(spec, " ")
+	if !strings.HasPrefix(path, "/") {
+		return Probe{}, fmt.Errorf("probe path must start with /: %q", path)
+	}
+	probe.Path = path
+	probe.Body = strings.TrimSpace(body)
+	return probe, nil
+}
+
+// NewService creates a health checker. With insecure set, TLS verification is
+// skipped so hosts with broken certificates still count as up; the
+// certificate is then validated separately and reported in the result.
+// Without followRedirects a redirect is recorded instead of followed. Every
+// request carries userAgent and the extra headers, e.g. an auth header for
+// gated staging hosts.
+func NewService(timeout time.Duration, workers int, insecure, followRedirects bool, userAgent string, headers map[string]string) *Service {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     30 * time.Second,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: insecure},
 		},
 	}
+	if !followRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	if userAgent == "" {
+		userAgent = "Watchtower/1.0"
+	}
+
+	return &Service{
+		timeout:   timeout,
+		workers:   workers,
+		client:    client,
+		userAgent: userAgent,
+		headers:   headers,
+		retryWait: defaultRetryWait,
+	}
+}
+
+// WithProbe returns a copy of the service that checks hosts with the given
+// probe instead of a GET on the root path
+func (s *Service) WithProbe(probe Probe) *Service {
+	clone := *s
+	clone.probe = probe
+	return &clone
+}
+
+// WithPorts returns a copy of the service that probes the given ports of each
+// host instead of DefaultPorts
+func (s *Service) WithPorts(ports []int) *Service {
+	clone := *s
+	clone.ports = ports
+	return &clone
+}
+
+// WithRetries returns a copy of the service that retries a failed check up
+// to n times before reporting the domain down
+func (s *Service) WithRetries(n int) *Service {
+	clone := *s
+	clone.retries = n
+	return &clone
+}
+
+// WithRetryDelay returns a copy of the service that waits about attempt*d
+// before each retry; zero retries right away
+func (s *Service) WithRetryDelay(d time.Duration) *Service {
+	clone := *s
+	clone.retryWait = d
+	return &clone
+}
+
+// WithTimeout returns a copy of the service whose requests time out after d.
+// The copy shares the connection pool of the original.
+func (s *Service) WithTimeout(d time.Duration) *Service {
+	clone := *s
+	clone.timeout = d
+	client := *s.client
+	client.Timeout = d
+	clone.client = &client
+	return &clone
 }
 
 type CheckResult struct {
-	Domain string
-	Status string // "up", "down", "unknown"
-	Error  error
+	Domain     string
+	Status     string // "up", "down", "unknown"
+	Resolved   bool   // whether the domain had DNS records
+	Reason     string // why the domain is down, one of the Reason constants
+	StatusCode int    // last HTTP status received, 0 if none
+	FinalURL   string // URL the check ended at; the redirect target if redirects aren't followed
+	OpenPorts  []int  // ports that answered HTTP(S), in ascending order
+	CertValid  *bool  // nil when no certificate was seen
+	CertError  string // why the certificate is invalid
+	Error      error
 }
 
+// CheckDomain checks a domain, retrying a failed check up to the configured
+// number of times with a jittered delay so a network blip doesn't flip a
+// domain to down. Hosts that don't resolve are not retried.
 func (s *Service) CheckDomain(ctx context.Context, domain string) CheckResult {
-	// Try HTTPS first, then HTTP
-	urls := []string{
-		fmt.Sprintf("https://%s", domain),
-		fmt.Sprintf("http://%s", domain),
+	result := s.checkOnce(ctx, domain)
+	for attempt := 1; attempt <= s.retries; attempt++ {
+		if result.Status != "down" || result.Reason == ReasonDNS {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(s.retryDelay(attempt)):
+		}
+		result = s.checkOnce(ctx, domain)
+	}
+	return result
+}
+
+// retryDelay waits longer with every attempt; the jitter keeps the workers
+// from retrying a shared host in lockstep
+func (s *Service) retryDelay(attempt int) time.Duration {
+	if s.retryWait <= 0 {
+		return 0
+	}
+	return time.Duration(attempt)*s.retryWait + time.Duration(rand.Int63n(int64(s.retryWait)))
+}
+
+// checkOnce probes every configured port of a domain in parallel. The
+// domain is up if any port answers below 500. Status code, final URL and
+// certificate come from the preferred port that answered, 443 before the
+// others.
+func (s *Service) checkOnce(ctx context.Context, domain string) CheckResult {
+	// Internationalized hosts must be probed by their punycode form
+	host := domainutil.ToASCII(domain)
+
+	// A host without DNS records can't be up; skip the HTTP attempts
+	if err := s.lookup(ctx, host); err != nil {
+		return CheckResult{
+			Domain: domain,
+			Status: "down",
+			Reason: ReasonDNS,
+			Error:  fmt.Errorf("domain does not resolve: %w", err),
+		}
+	}
+
+	ports := s.ports
+	if len(ports) == 0 {
+		ports = DefaultPorts
+	}
+
+	results := make([]portResult, len(ports))
+	var wg sync.WaitGroup
+	for i, port := range ports {
+		wg.Add(1)
+		go func(i, port int) {
+			defer wg.Done()
+			results[i] = s.checkPort(ctx, host, port)
+		}(i, port)
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].port == 443 && results[j].port != 443
+	})
+
+	primary := primaryPort(results)
+
+	result := CheckResult{
+		Domain:     domain,
+		Status:     "down",
+		Resolved:   true,
+		StatusCode: primary.statusCode,
+		FinalURL:   primary.finalURL,
+		CertValid:  primary.certValid,
+		CertError:  primary.certError,
+	}
+	for _, r := range results {
+		if r.answered() {
+			result.OpenPorts = append(result.OpenPorts, r.port)
+		}
+		if result.CertValid == nil && r.certValid != nil {
+			result.CertValid, result.CertError = r.certValid, r.certError
+		}
+	}
+	sort.Ints(result.OpenPorts)
+
+	// Consider 2xx, 3xx, and even 4xx as "up" (server is responding)
+	if primary.up() {
+		result.Status = "up"
+		return result
+	}
+
+	// A server error beats any connection failure since the host answered
+	switch {
+	case primary.answered():
+		result.Reason = Reason5xx
+	case primary.reason != "":
+		result.Reason = primary.reason
+	default:
+		result.Reason = ReasonError
+	}
+	result.Error = fmt.Errorf("domain not reachable (%s)", result.Reason)
+	return result
+}
+
+// primaryPort picks the first port that is up, else the first that answered
+// at all, else the first one checked
+func primaryPort(results []portResult) *portResult {
+	for i := range results {
+		if results[i].up() {
+			return &results[i]
+		}
+	}
+	for i := range results {
+		if results[i].answered() {
+			return &results[i]
+		}
+	}
+	return &results[0]
+}
+
+// portResult is the outcome of probing one port of a host
+type portResult struct {
+	port       int
+	statusCode int // 0 if nothing answered
+	finalURL   string
+	reason     string // why the port did not answer
+	certValid  *bool
+	certError  string
+}
+
+func (r portResult) answered() bool {
+	return r.statusCode > 0
+}
+
+func (r portResult) up() bool {
+	return r.answered() && r.statusCode < 500
+}
+
+// portURLs returns the URLs tried for a port. Ports other than 80 and 443 may
+// speak either protocol, so HTTPS is tried before HTTP.
+func portURLs(host string, port int, path string) []string {
+	switch port {
+	case 443:
+		return []string{fmt.Sprintf("https://%s%s", host, path)}
+	case 80:
+		return []string{fmt.Sprintf("http://%s%s", host, path)}
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	return []string{
+		fmt.Sprintf("https://%s%s", addr, path),
+		fmt.Sprintf("http://%s%s", addr, path),
+	}
+}
+
+// checkPort probes one port, stopping at the first URL that is up
+func (s *Service) checkPort(ctx context.Context, host string, port int) portResult {
+	method := s.probe.Method
+	if method == "" {
+		method = http.MethodGet
 	}
 
-	for _, url := range urls {
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	result := portResult{port: port}
+	for _, url := range portURLs(host, port, s.probe.Path) {
+		isHTTPS := strings.HasPrefix(url, "https://")
+
+		var body io.Reader
+		if s.probe.Body != "" {
+			body = strings.NewReader(s.probe.Body)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
 		if err != nil {
 			continue
 		}
 
-		req.Header.Set("User-Agent", "Watchtower/1.0")
+		if s.probe.Body != "" && (strings.HasPrefix(s.probe.Body, "{") || strings.HasPrefix(s.probe.Body, "[")) {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		s.setHeaders(req)
 
 		resp, err := s.client.Do(req)
 		if err != nil {
+			// The first failure is the most telling; the HTTP fallback
+			// usually fails the same way
+			if result.reason == "" {
+				result.reason = failureReason(err)
+			}
+			// A rejected certificate is a finding even though the check
+			// falls back to HTTP
+			if msg, ok := certError(err); isHTTPS && ok {
+				valid := false
+				result.certValid, result.certError = &valid, msg
+			}
 			continue
 		}
 		resp.Body.Close()
+		result.statusCode = resp.StatusCode
+		result.finalURL = responseURL(resp)
 
-		// Consider 2xx, 3xx, and even 4xx as "up" (server is responding)
-		if resp.StatusCode < 500 {
-			return CheckResult{
-				Domain: domain,
-				Status: "up",
-			}
+		if isHTTPS {
+			valid, msg := certStatus(resp)
+			result.certValid, result.certError = &valid, msg
+		}
+
+		if result.up() {
+			break
+		}
+	}
+	return result
+}
+
+// setHeaders applies the configured User-Agent and extra headers
+func (s *Service) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", s.userAgent)
+	for key, value := range s.headers {
+		// Go sends req.Host, not a Host header
+		if strings.EqualFold(key, "Host") {
+			req.Host = value
+			continue
 		}
+		req.Header.Set(key, value)
 	}
+}
 
-	return CheckResult{
-		Domain: domain,
-		Status: "down",
-		Error:  fmt.Errorf("domain not reachable"),
+// responseURL returns the URL a response came from, or the target of an
+// unfollowed redirect
+func responseURL(resp *http.Response) string {
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if location, err := resp.Location(); err == nil {
+			return location.String()
+		}
 	}
+	if resp.Request == nil {
+		return ""
+	}
+	return resp.Request.URL.String()
 }
 
-func (s *Service) CheckDomains(ctx context.Context, domains []string) []CheckResult {
-	results := make([]CheckResult, len(domains))
+// lookup resolves a host within the check timeout
+func (s *Service) lookup(ctx context.Context, host string) error {
+	lookupCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
-	// Create worker pool
-	domainChan := make(chan string, len(domains))
-	resultChan := make(chan CheckResult, len(domains))
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	_, err := net.DefaultResolver.LookupHost(lookupCtx, host)
+	return err
+}
 
-	// Send domains to channel
-	for _, domain := range domains {
-		domainChan <- domain
+// CheckDomainsStream checks domains with the worker pool and emits each
+// result as soon as it completes, in completion order. The channel is closed
+// once every domain has been checked or the context is cancelled; domains
+// skipped because of cancellation produce no result. Callers must drain the
+// channel.
+func (s *Service) CheckDomainsStream(ctx context.Context, domains []string) <-chan CheckResult {
+	workers := s.workers
+	if workers < 1 {
+		workers = 1
 	}
-	close(domainChan)
+
+	domainChan := make(chan string)
+	resultChan := make(chan CheckResult, workers)
+
+	// Feed domains lazily so memory doesn't grow with the input size
+	go func() {
+		defer close(domainChan)
+		for _, domain := range domains {
+			select {
+			case domainChan <- domain:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
 	// Start workers
 	var wg sync.WaitGroup
-	for i := 0; i < s.workers; i++ {
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for domain := range domainChan {
+				if ctx.Err() != nil {
+					return
+				}
+				result := s.CheckDomain(ctx, domain)
 				select {
+				case resultChan <- result:
 				case <-ctx.Done():
 					return
-				default:
-					result := s.CheckDomain(ctx, domain)
-					resultChan <- result
 				}
 			}
 		}()
 	}
 
-	// Wait for all workers to finish
+	// Close the stream once all workers are done
 	go func() {
 		wg.Wait()
 		close(resultChan)
 	}()
 
-	// Collect results
-	index := 0
-	resultMap := make(map[string]CheckResult)
-	for result := range resultChan {
+	return resultChan
+}
+
+// CheckDomains checks all domains and returns the results in input order.
+// Domains that could not be checked are reported as "unknown".
+func (s *Service) CheckDomains(ctx context.Context, domains []string) []CheckResult {
+	resultMap := make(map[string]CheckResult, len(domains))
+	for result := range s.CheckDomainsStream(ctx, domains) {
 		resultMap[result.Domain] = result
 	}
 
 	// Preserve order
-	for _, domain := range domains {
+	results := make([]CheckResult, len(domains))
+	for i, domain := range domains {
 		if result, ok := resultMap[domain]; ok {
-			results[index] = result
+			results[i] = result
 		} else {
-			results[index] = CheckResult{
+			results[i] = CheckResult{
 				Domain: domain,
 				Status: "unknown",
 			}
 		}
-		index++
 	}
 
 	return results
@@ -0,0 +1,91 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer answers 503 to the first failures requests and 200 afterwards.
+// It returns the service probing it, the host to check and the request count.
+func testServer(t *testing.T, failures int32) (*Service, string, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewService(2*time.Second, 1, false, true, "", nil).
+		WithPorts([]int{port}).
+		WithRetries(2).
+		WithRetryDelay(0)
+	return service, u.Hostname(), &requests
+}
+
+func TestCheckDomainRetriesUntilUp(t *testing.T) {
+	service, host, requests := testServer(t, 1)
+
+	result := service.CheckDomain(context.Background(), host)
+	if result.Status != "up" {
+		t.Fatalf("status = %q (reason %q), want up", result.Status, result.Reason)
+	}
+	if result.StatusCode != http.StatusOK {
+		t.Errorf("status code = %d, want %d", result.StatusCode, http.StatusOK)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestCheckDomainDownAfterAllRetries(t *testing.T) {
+	service, host, requests := testServer(t, 1000)
+
+	result := service.CheckDomain(context.Background(), host)
+	if result.Status != "down" {
+		t.Fatalf("status = %q, want down", result.Status)
+	}
+	if result.Reason != Reason5xx {
+		t.Errorf("reason = %q, want %q", result.Reason, Reason5xx)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3 (one check and two retries)", got)
+	}
+}
+
+func TestCheckDomainDoesNotRetryDNSFailures(t *testing.T) {
+	// A retry would wait far longer than the deadline
+	service := NewService(2*time.Second, 1, false, true, "", nil).
+		WithRetries(2).
+		WithRetryDelay(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result := service.CheckDomain(ctx, "watchtower-test.invalid")
+	if result.Status != "down" || result.Reason != ReasonDNS {
+		t.Fatalf("status = %q, reason = %q, want down because of dns", result.Status, result.Reason)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("check waited for a retry: %v", ctx.Err())
+	}
+}
@@ -0,0 +1,54 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Reasons recorded for domains that are down
+const (
+	ReasonDNS     = "dns"
+	ReasonTimeout = "timeout"
+	ReasonTLS     = "tls"
+	ReasonRefused = "refused"
+	ReasonReset   = "reset"
+	Reason5xx     = "5xx"
+	ReasonError   = "error"
+)
+
+// failureReason classifies why a request failed
+func failureReason(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ReasonTimeout
+		}
+		return ReasonDNS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ReasonTimeout
+	}
+
+	if _, ok := certError(err); ok {
+		return ReasonTLS
+	}
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || strings.Contains(err.Error(), "tls: ") {
+		return ReasonTLS
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReasonRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ReasonReset
+	}
+	return ReasonError
+}
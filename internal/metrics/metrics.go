@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Scan metrics, updated by the scheduler and served on /metrics
+var (
+	scansTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watchtower_scan_total",
+		Help: "Number of full scans that finished, by result.",
+	}, []string{"result"})
+	scanErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "watchtower_scan_errors_total",
+		Help: "Number of errors recorded by finished full scans.",
+	})
+	scanDuration = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchtower_scan_duration_seconds",
+		Help: "Duration of the last successful full scan.",
+	})
+	scanLastCompleted = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchtower_scan_last_completed_timestamp_seconds",
+		Help: "Unix time the last successful full scan finished.",
+	})
+	scansRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchtower_scan_running",
+		Help: "Number of full scans in progress.",
+	})
+	statusChangesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "watchtower_status_changes_total",
+		Help: "Number of domain status changes recorded by scans.",
+	})
+
+	domainsTotal = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchtower_domains_total",
+		Help: "Number of stored domains.",
+	})
+	domainsNew = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchtower_domains_new",
+		Help: "Number of domains flagged as new.",
+	})
+	domainsUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchtower_domains_up",
+		Help: "Number of domains whose last check was up.",
+	})
+	domainsDown = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchtower_domains_down",
+		Help: "Number of domains whose last check was down.",
+	})
+	programsTotal = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchtower_programs_total",
+		Help: "Number of stored programs.",
+	})
+)
+
+// Results of a full scan, the result label of watchtower_scan_total
+const (
+	ScanSucceeded = "success"
+	ScanFailed    = "failed"
+	ScanCancelled = "cancelled"
+)
+
+func init() {
+	for _, result := range []string{ScanSucceeded, ScanFailed, ScanCancelled} {
+		scansTotal.WithLabelValues(result)
+	}
+}
+
+// ScanStarted marks a full scan as running
+func ScanStarted() {
+	scansRunning.Inc()
+}
+
+// ScanFinished records a full scan that ran from started to finished with
+// the given result. Only successful scans update the duration and the last
+// completed time.
+func ScanFinished(started, finished time.Time, errors int, result string) {
+	scansRunning.Dec()
+	scansTotal.WithLabelValues(result).Inc()
+	scanErrorsTotal.Add(float64(errors))
+	if result != ScanSucceeded {
+		return
+	}
+	scanDuration.Set(finished.Sub(started).Seconds())
+	scanLastCompleted.Set(float64(finished.Unix()))
+}
+
+// AddStatusChanges counts status changes recorded by a scan
+func AddStatusChanges(n int) {
+	statusChangesTotal.Add(float64(n))
+}
+
+// SetDomainStats refreshes the domain and program gauges from the
+// statistics returned by database.GetStats
+func SetDomainStats(stats map[string]interface{}) {
+	setGauge(domainsTotal, stats["total_domains"])
+	setGauge(domainsNew, stats["new_domains"])
+	setGauge(domainsUp, stats["up_domains"])
+	setGauge(domainsDown, stats["down_domains"])
+	setGauge(programsTotal, stats["total_programs"])
+}
+
+func setGauge(gauge prometheus.Gauge, value interface{}) {
+	if n, ok := value.(int); ok {
+		gauge.Set(float64(n))
+	}
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScanFinished(t *testing.T) {
+	started := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name          string
+		result        string
+		finished      time.Time
+		wantCompleted float64
+	}{
+		{name: "success", result: ScanSucceeded, finished: started.Add(time.Minute), wantCompleted: float64(started.Add(time.Minute).Unix())},
+		{name: "failure keeps last completion", result: ScanFailed, finished: started.Add(time.Hour), wantCompleted: float64(started.Add(time.Minute).Unix())},
+		{name: "cancel keeps last completion", result: ScanCancelled, finished: started.Add(2 * time.Hour), wantCompleted: float64(started.Add(time.Minute).Unix())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := testutil.ToFloat64(scansTotal.WithLabelValues(tt.result))
+			ScanStarted()
+			ScanFinished(started, tt.finished, 0, tt.result)
+
+			if got := testutil.ToFloat64(scansTotal.WithLabelValues(tt.result)) - before; got != 1 {
+				t.Errorf("scan_total{result=%q} grew by %v, want 1", tt.result, got)
+			}
+			if got := testutil.ToFloat64(scanLastCompleted); got != tt.wantCompleted {
+				t.Errorf("last completed = %v, want %v", got, tt.wantCompleted)
+			}
+			if got := testutil.ToFloat64(scanDuration); got != time.Minute.Seconds() {
+				t.Errorf("duration = %v, want %v", got, time.Minute.Seconds())
+			}
+		})
+	}
+}
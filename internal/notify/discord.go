@@ -0,0 +1,238 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"watchtower/internal/database"
+)
+
+// discordMaxEmbeds is the number of embeds Discord accepts in one message
+const discordMaxEmbeds = 10
+
+// A batch posts at most discordMaxBatchEmbeds embeds; the rest are only
+// counted so a large scan doesn't flood the channel and the rate limit
+const discordMaxBatchEmbeds = 50
+
+// Rate limited posts are retried up to discordMaxRetries times, waiting as
+// long as Discord asks but never longer than discordMaxRetryAfter
+const (
+	discordMaxRetries    = 3
+	discordMaxRetryAfter = time.Minute
+)
+
+// Embed colors for status transitions and new domains
+const (
+	discordColorUp    = 0x2eb67d
+	discordColorDown  = 0xe01e5a
+	discordColorOther = 0x9e9e9e
+	discordColorNew   = 0x3498db
+)
+
+// DiscordNotifier posts status changes and new domains as embeds to a
+// Discord webhook, at most ten embeds per message and discordMaxBatchEmbeds
+// per batch
+type DiscordNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewDiscordNotifier(url string) *DiscordNotifier {
+	return &DiscordNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+// NotifyStatusChanges posts one embed per change
+func (n *DiscordNotifier) NotifyStatusChanges(changes []database.StatusChange) error {
+	embeds := make([]discordEmbed, 0, len(changes))
+	for _, change := range changes {
+		color := discordColorOther
+		switch change.NewStatus {
+		case "up":
+			color = discordColorUp
+		case "down":
+			color = discordColorDown
+		}
+		embeds = append(embeds, discordEmbed{
+			Title: "Status change",
+			Color: color,
+			Fields: []discordField{
+				{Name: "Program", Value: change.Program, Inline: true},
+				{Name: "Domain", Value: change.Domain, Inline: true},
+				{Name: "Status", Value: fmt.Sprintf("%s → %s", change.OldStatus, change.NewStatus), Inline: true},
+			},
+			Timestamp: change.ChangedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return n.postEmbeds(fmt.Sprintf("Watchtower: %d status changes", len(changes)), embeds)
+}
+
+// NotifyNewDomains posts one embed per newly discovered domain
+func (n *DiscordNotifier) NotifyNewDomains(domains []database.Domain) error {
+	embeds := make([]discordEmbed, 0, len(domains))
+	for _, domain := range domains {
+		status := domain.Status
+		if status == "" {
+			status = "unknown"
+		}
+		embeds = append(embeds, discordEmbed{
+			Title: "New domain",
+			Color: discordColorNew,
+			Fields: []discordField{
+				{Name: "Program", Value: domain.Program, Inline: true},
+				{Name: "Domain", Value: domain.Domain, Inline: true},
+				{Name: "Status", Value: status, Inline: true},
+			},
+		})
+	}
+	return n.postEmbeds(fmt.Sprintf("Watchtower: %d new domains", len(domains)), embeds)
+}
+
+// NotifyAlerts posts one embed per alert. Program alerts such as surges have
+// no domain field, as Discord rejects empty field values.
+func (n *DiscordNotifier) NotifyAlerts(alerts []database.Alert) error {
+	embeds := make([]discordEmbed, 0, len(alerts))
+	for _, alert := range alerts {
+		fields := []discordField{{Name: "Program", Value: alert.Program, Inline: true}}
+		if alert.Domain != "" {
+			fields = append(fields, discordField{Name: "Domain", Value: alert.Domain, Inline: true})
+		}
+		fields = append(fields, discordField{Name: "Detail", Value: alert.Detail, Inline: false})
+		embeds = append(embeds, discordEmbed{
+			Title:     alertLabel(alert.Type),
+			Color:     discordColorOther,
+			Fields:    fields,
+			Timestamp: alert.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return n.postEmbeds(fmt.Sprintf("Watchtower: %d alerts", len(alerts)), embeds)
+}
+
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Color     int            `json:"color"`
+	Fields    []discordField `json:"fields"`
+	Timestamp string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// postEmbeds sends the embeds in chunks of discordMaxEmbeds; only the first
+// message carries the summary line. Embeds past discordMaxBatchEmbeds are
+// replaced by a final message counting them. A failure after the first
+// message is a PartialError counting the embeds already sent.
+func (n *DiscordNotifier) postEmbeds(content string, embeds []discordEmbed) error {
+	omitted := 0
+	if len(embeds) > discordMaxBatchEmbeds {
+		omitted = len(embeds) - discordMaxBatchEmbeds
+		embeds = embeds[:discordMaxBatchEmbeds]
+	}
+
+	for start := 0; start < len(embeds); start += discordMaxEmbeds {
+		end := start + discordMaxEmbeds
+		if end > len(embeds) {
+			end = len(embeds)
+		}
+		message := discordMessage{Embeds: embeds[start:end]}
+		if start == 0 {
+			message.Content = content
+		}
+		if err := n.post(message); err != nil {
+			return partial(start, err)
+		}
+	}
+	if omitted > 0 {
+		if err := n.post(discordMessage{Content: fmt.Sprintf("…and %d more not shown", omitted), Embeds: []discordEmbed{}}); err != nil {
+			return partial(len(embeds), err)
+		}
+	}
+	return nil
+}
+
+// post sends one message, waiting and retrying when Discord rate limits it
+func (n *DiscordNotifier) post(message discordMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		wait, err := n.send(body)
+		if wait == 0 || attempt >= discordMaxRetries {
+			return err
+		}
+		time.Sleep(wait)
+	}
+}
+
+// send posts a message body once. Discord answers 204 No Content on success
+// and a JSON body with a message and code on failure. A 429 answer returns
+// how long to wait before trying again, taken from retry_after.
+func (n *DiscordNotifier) send(body []byte) (time.Duration, error) {
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	var discordErr struct {
+		Message    string  `json:"message"`
+		Code       int     `json:"code"`
+		RetryAfter float64 `json:"retry_after"`
+	}
+	decoded := json.Unmarshal(detail, &discordErr) == nil
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err := fmt.Errorf("discord rate limited the webhook for %.1fs", discordErr.RetryAfter)
+		return discordRetryAfter(discordErr.RetryAfter, resp.Header.Get("Retry-After")), err
+	}
+	if decoded && discordErr.Message != "" {
+		return 0, fmt.Errorf("discord returned status %d: %s (code %d)", resp.StatusCode, discordErr.Message, discordErr.Code)
+	}
+	return 0, fmt.Errorf("discord returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+}
+
+// discordRetryAfter is the wait of a rate limited post: the retry_after of
+// the body in seconds, else the Retry-After header, else one second. It is
+// capped at discordMaxRetryAfter.
+func discordRetryAfter(retryAfter float64, header string) time.Duration {
+	wait := time.Duration(retryAfter * float64(time.Second))
+	if wait <= 0 {
+		if seconds, err := strconv.ParseFloat(strings.TrimSpace(header), 64); err == nil && seconds > 0 {
+			wait = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	if wait <= 0 {
+		wait = time.Second
+	}
+	if wait > discordMaxRetryAfter {
+		wait = discordMaxRetryAfter
+	}
+	return wait
+}
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"watchtower/internal/database"
+)
+
+func TestDiscordRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		limited     int32 // requests answered with 429 before accepting
+		wantErr     bool
+		wantRequest int32
+	}{
+		{name: "accepted", limited: 0, wantRequest: 1},
+		{name: "limited once", limited: 1, wantRequest: 2},
+		{name: "always limited", limited: 100, wantErr: true, wantRequest: discordMaxRetries + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.limited {
+					w.WriteHeader(http.StatusTooManyRequests)
+					fmt.Fprint(w, `{"message": "You are being rate limited.", "retry_after": 0.01, "global": false}`)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			err := NewDiscordNotifier(server.URL).NotifyStatusChanges([]database.StatusChange{
+				{Domain: "a.example.com", Program: "p", OldStatus: "down", NewStatus: "up"},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequest {
+				t.Errorf("%d requests, want %d", got, tt.wantRequest)
+			}
+		})
+	}
+}
+
+func TestDiscordCapsEmbeds(t *testing.T) {
+	tests := []struct {
+		name         string
+		domains      int
+		wantMessages int
+		wantEmbeds   int
+	}{
+		{name: "one message", domains: 7, wantMessages: 1, wantEmbeds: 7},
+		{name: "at the cap", domains: discordMaxBatchEmbeds, wantMessages: 5, wantEmbeds: discordMaxBatchEmbeds},
+		{name: "over the cap", domains: 500, wantMessages: 6, wantEmbeds: discordMaxBatchEmbeds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var messages []discordMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var message discordMessage
+				if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				messages = append(messages, message)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			var domains []database.Domain
+			for i := 0; i < tt.domains; i++ {
+				domains = append(domains, database.Domain{Domain: fmt.Sprintf("host%d.example.com", i), Program: "p"})
+			}
+			if err := NewDiscordNotifier(server.URL).NotifyNewDomains(domains); err != nil {
+				t.Fatalf("NotifyNewDomains: %v", err)
+			}
+
+			embeds := 0
+			for _, message := range messages {
+				if len(message.Embeds) > discordMaxEmbeds {
+					t.Errorf("message has %d embeds, limit %d", len(message.Embeds), discordMaxEmbeds)
+				}
+				embeds += len(message.Embeds)
+			}
+			if len(messages) != tt.wantMessages || embeds != tt.wantEmbeds {
+				t.Errorf("%d messages with %d embeds, want %d with %d", len(messages), embeds, tt.wantMessages, tt.wantEmbeds)
+			}
+		})
+	}
+}
+
+func TestDiscordRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter float64
+		header     string
+		want       time.Duration
+	}{
+		{name: "body", retryAfter: 1.5, want: 1500 * time.Millisecond},
+		{name: "body wins over header", retryAfter: 2, header: "5", want: 2 * time.Second},
+		{name: "header", header: "3", want: 3 * time.Second},
+		{name: "nothing", want: time.Second},
+		{name: "capped", retryAfter: 3600, want: discordMaxRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discordRetryAfter(tt.retryAfter, tt.header); got != tt.want {
+				t.Errorf("discordRetryAfter(%v, %q) = %v, want %v", tt.retryAfter, tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscordAlertFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		alert      database.Alert
+		wantFields []string
+	}{
+		{
+			name:       "domain alert",
+			alert:      database.Alert{Type: database.AlertTypeTech, Domain: "ci.example.com", Program: "p", Detail: "Jenkins"},
+			wantFields: []string{"Program", "Domain", "Detail"},
+		},
+		{
+			name:       "surge alert",
+			alert:      database.Alert{Type: database.AlertTypeSurge, Program: "p", Detail: "10 -> 100 domains"},
+			wantFields: []string{"Program", "Detail"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var messages []discordMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var message discordMessage
+				if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				// Discord rejects fields without a value
+				for _, embed := range message.Embeds {
+					for _, field := range embed.Fields {
+						if field.Value == "" {
+							http.Error(w, "empty field "+field.Name, http.StatusBadRequest)
+							return
+						}
+					}
+				}
+				messages = append(messages, message)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			if err := NewDiscordNotifier(server.URL).NotifyAlerts([]database.Alert{tt.alert}); err != nil {
+				t.Fatalf("NotifyAlerts: %v", err)
+			}
+			var names []string
+			for _, field := range messages[0].Embeds[0].Fields {
+				names = append(names, field.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.wantFields) {
+				t.Errorf("fields = %v, want %v", names, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"watchtower/internal/database"
+)
+
+// emailMaxDomains bounds the new domain table of a digest; the remaining
+// domains are only counted
+const emailMaxDomains = 500
+
+// smtpsPort is the port that speaks TLS from the start instead of STARTTLS
+const smtpsPort = 465
+
+// Digest summarizes the findings of one scan
+type Digest struct {
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	Stats         map[string]interface{}
+	NewDomains    []database.Domain
+	StatusChanges []database.StatusChange
+}
+
+// DigestNotifier delivers a digest after each full scan
+type DigestNotifier interface {
+	Name() string
+	NotifyScanDigest(digest *Digest) error
+}
+
+// EmailConfig holds the SMTP settings of an EmailNotifier
+type EmailConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+// EmailNotifier mails an HTML digest of each scan over SMTP. Port 465 uses
+// implicit TLS; other ports upgrade with STARTTLS when the server offers it.
+type EmailNotifier struct {
+	config EmailConfig
+}
+
+func NewEmailNotifier(config EmailConfig) *EmailNotifier {
+	return &EmailNotifier{config: config}
+}
+
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Enabled reports whether a server, sender and recipient are configured
+func (n *EmailNotifier) Enabled() bool {
+	return n.config.Host != "" && n.config.From != "" && len(n.config.To) > 0
+}
+
+// NotifyScanDigest mails the digest; it does nothing when SMTP isn't
+// configured
+func (n *EmailNotifier) NotifyScanDigest(digest *Digest) error {
+	if !n.Enabled() {
+		return nil
+	}
+
+	var body bytes.Buffer
+	if err := digestTemplate.Execute(&body, newDigestView(digest)); err != nil {
+		return fmt.Errorf("render digest: %w", err)
+	}
+
+	subject := fmt.Sprintf("Watchtower scan digest: %d new domains, %d status changes",
+		len(digest.NewDomains), len(digest.StatusChanges))
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	message.Write(body.Bytes())
+
+	return n.send(message.Bytes())
+}
+
+func (n *EmailNotifier) send(message []byte) error {
+	addr := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+	tlsConfig := &tls.Config{ServerName: n.config.Host}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if n.config.Port == smtpsPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if n.config.Port != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("starttls: %w", err)
+			}
+		}
+	}
+
+	if n.config.User != "" {
+		auth := smtp.PlainAuth("", n.config.User, n.config.Password, n.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.config.From); err != nil {
+		return err
+	}
+	for _, to := range n.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+type digestView struct {
+	*Digest
+	Domains       []database.Domain
+	HiddenDomains int
+	TotalDomains  interface{}
+	UpDomains     interface{}
+	DownDomains   interface{}
+	TotalPrograms interface{}
+	ScanDuration  time.Duration
+}
+
+func newDigestView(digest *Digest) digestView {
+	view := digestView{
+		Digest:        digest,
+		Domains:       digest.NewDomains,
+		TotalDomains:  digest.Stats["total_domains"],
+		UpDomains:     digest.Stats["up_domains"],
+		DownDomains:   digest.Stats["down_domains"],
+		TotalPrograms: digest.Stats["total_programs"],
+		ScanDuration:  digest.FinishedAt.Sub(digest.StartedAt).Round(time.Second),
+	}
+	if len(view.Domains) > emailMaxDomains {
+		view.HiddenDomains = len(view.Domains) - emailMaxDomains
+		view.Domains = view.Domains[:emailMaxDomains]
+	}
+	return view
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+<h2>Watchtower scan digest</h2>
+<p>Scan started {{.StartedAt.Format "2006-01-02 15:04:05 MST"}} and took {{.ScanDuration}}.</p>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr><td>Total domains</td><td><b>{{.TotalDomains}}</b></td></tr>
+<tr><td>New domains</td><td><b>{{len .NewDomains}}</b></td></tr>
+<tr><td>Up / down</td><td><b>{{.UpDomains}}</b> / <b>{{.DownDomains}}</b></td></tr>
+<tr><td>Status changes</td><td><b>{{len .StatusChanges}}</b></td></tr>
+<tr><td>Programs</td><td><b>{{.TotalPrograms}}</b></td></tr>
+</table>
+
+<h3>New domains</h3>
+{{if .Domains}}
+<table border="1" cellpadding="6" style="border-collapse: collapse;">
+<tr><th>Domain</th><th>Program</th><th>Status</th></tr>
+{{range .Domains}}<tr><td><code>{{.Domain}}</code></td><td>{{.Program}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>
+{{if .HiddenDomains}}<p>…and {{.HiddenDomains}} more.</p>{{end}}
+{{else}}<p>No new domains.</p>{{end}}
+
+<h3>Status changes</h3>
+{{if .StatusChanges}}
+<table border="1" cellpadding="6" style="border-collapse: collapse;">
+<tr><th>Domain</th><th>Program</th><th>Change</th><th>Time</th></tr>
+{{range .StatusChanges}}<tr><td><code>{{.Domain}}</code></td><td>{{.Program}}</td><td>{{.OldStatus}} → {{.NewStatus}}</td><td>{{.ChangedAt.Format "15:04:05"}}</td></tr>
+{{end}}</table>
+{{else}}<p>No status changes.</p>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"fmt"
+
+	"watchtower/internal/database"
+)
+
+// Notifier delivers the status changes of a scan to an external service.
+// Deliveries are tracked per notifier: a failing notifier gets the changes
+// again after the next scan, the others don't. A notifier that sends a batch
+// in several requests returns a PartialError when a later one fails. Changes
+// are marked notified once every configured notifier accepted them.
+type Notifier interface {
+	Name() string
+	NotifyStatusChanges(changes []database.StatusChange) error
+}
+
+// AlertNotifier delivers alerts such as technology changes on known hosts.
+// Like status changes, deliveries are tracked per notifier.
+type AlertNotifier interface {
+	Name() string
+	NotifyAlerts(alerts []database.Alert) error
+}
+
+// PartialError is returned by a notifier that delivered the first Delivered
+// items of a batch, in order, before failing. Only those are recorded as
+// delivered, so the retry after the next scan doesn't send them again.
+type PartialError struct {
+	Delivered int
+	Err       error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("failed after %d delivered: %v", e.Delivered, e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// partial reports a failure after delivered items; with nothing delivered
+// the error is returned as is
+func partial(delivered int, err error) error {
+	if delivered == 0 {
+		return err
+	}
+	return &PartialError{Delivered: delivered, Err: err}
+}
+
+// alertLabel is the human readable name of an alert type
+func alertLabel(alertType string) string {
+	switch alertType {
+	case database.AlertTypeTechChange:
+		return "New technologies"
+	case database.AlertTypeTech:
+		return "Technology alert"
+	case database.AlertTypeSurge:
+		return "Domain surge"
+	default:
+		return alertType
+	}
+}
+
+// DomainNotifier announces the domains discovered by a scan. A service may
+// implement it alongside Notifier or on its own.
+type DomainNotifier interface {
+	Name() string
+	NotifyNewDomains(domains []database.Domain) error
+}
@@ -0,0 +1,271 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"watchtower/internal/database"
+)
+
+// Slack limits how much a single message may contain; larger batches are
+// split over several messages
+const (
+	slackMaxAttachments = 20
+	slackMaxDomainLines = 50
+	slackMaxBlocks      = 50   // blocks per message, including the header
+	slackMaxSectionText = 3000 // characters per section block
+)
+
+// Attachment colors for status transitions
+const (
+	slackColorUp    = "#2eb67d"
+	slackColorDown  = "#e01e5a"
+	slackColorOther = "#9e9e9e"
+)
+
+// SlackNotifier sends status changes and new domains to a Slack incoming
+// webhook. The changes of one scan are batched into as few messages as the
+// Slack limits allow.
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// NotifyStatusChanges posts one colored attachment per change, green for
+// changes to up and red for changes to down
+func (n *SlackNotifier) NotifyStatusChanges(changes []database.StatusChange) error {
+	for start := 0; start < len(changes); start += slackMaxAttachments {
+		end := start + slackMaxAttachments
+		if end > len(changes) {
+			end = len(changes)
+		}
+		batch := changes[start:end]
+
+		attachments := make([]slackAttachment, 0, len(batch))
+		for _, change := range batch {
+			attachments = append(attachments, slackAttachment{
+				Color: statusColor(change.NewStatus),
+				Blocks: []slackBlock{markdownSection(fmt.Sprintf("*%s* `%s`\n%s → *%s* at %s",
+					change.Program, change.Domain, change.OldStatus, change.NewStatus,
+					change.ChangedAt.UTC().Format("2006-01-02 15:04 MST")))},
+			})
+		}
+
+		title := fmt.Sprintf("%d status changes", len(changes))
+		if len(changes) > slackMaxAttachments {
+			title += fmt.Sprintf(" (%d-%d)", start+1, end)
+		}
+		if err := n.post(slackMessage{
+			Text:        "Watchtower: " + title,
+			Blocks:      []slackBlock{headerBlock("Watchtower: " + title)},
+			Attachments: attachments,
+		}); err != nil {
+			return partial(start, err)
+		}
+	}
+	return nil
+}
+
+// NotifyNewDomains posts the newly discovered domains grouped by program.
+// At most slackMaxDomainLines domains are listed; the rest are summed up.
+func (n *SlackNotifier) NotifyNewDomains(domains []database.Domain) error {
+	if len(domains) == 0 {
+		return nil
+	}
+
+	byProgram := make(map[string][]string)
+	for _, domain := range domains {
+		byProgram[domain.Program] = append(byProgram[domain.Program], domain.Domain)
+	}
+	programs := make([]string, 0, len(byProgram))
+	for program := range byProgram {
+		programs = append(programs, program)
+	}
+	sort.Strings(programs)
+
+	var sections []string
+	lines := 0
+	for i, program := range programs {
+		if lines >= slackMaxDomainLines {
+			rest := 0
+			for _, other := range programs[i:] {
+				rest += len(byProgram[other])
+			}
+			sections = append(sections, fmt.Sprintf("…and %d more domains in %d programs", rest, len(programs)-i))
+			break
+		}
+
+		hosts := byProgram[program]
+		sort.Strings(hosts)
+		programLines := []string{fmt.Sprintf("*%s* (%d)", program, len(hosts))}
+		for j, host := range hosts {
+			if lines >= slackMaxDomainLines {
+				programLines = append(programLines, fmt.Sprintf("…and %d more", len(hosts)-j))
+				break
+			}
+			programLines = append(programLines, fmt.Sprintf("`%s`", host))
+			lines++
+		}
+		sections = append(sections, packSections(programLines)...)
+	}
+
+	return n.postSections(fmt.Sprintf("Watchtower: %d new domains", len(domains)), sections)
+}
+
+// NotifyAlerts posts the alerts as one line each, split over several
+// sections and messages when there are many
+func (n *SlackNotifier) NotifyAlerts(alerts []database.Alert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		if alert.Domain == "" {
+			lines = append(lines, fmt.Sprintf("*%s* %s: %s", alert.Program, alertLabel(alert.Type), alert.Detail))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("*%s* `%s` %s: %s", alert.Program, alert.Domain, alertLabel(alert.Type), alert.Detail))
+	}
+	return n.postSections(fmt.Sprintf("Watchtower: %d alerts", len(alerts)), packSections(lines))
+}
+
+// packSections joins lines into section texts of at most slackMaxSectionText
+// characters. A line that is too long on its own is cut.
+func packSections(lines []string) []string {
+	var sections []string
+	var text strings.Builder
+	for _, line := range lines {
+		if len(line) > slackMaxSectionText {
+			line = truncateText(line, slackMaxSectionText)
+		}
+		if text.Len() > 0 && text.Len()+1+len(line) > slackMaxSectionText {
+			sections = append(sections, text.String())
+			text.Reset()
+		}
+		if text.Len() > 0 {
+			text.WriteString("\n")
+		}
+		text.WriteString(line)
+	}
+	if text.Len() > 0 {
+		sections = append(sections, text.String())
+	}
+	return sections
+}
+
+// truncateText cuts text to at most max bytes on a rune boundary, ending it
+// with an ellipsis
+func truncateText(text string, max int) string {
+	const ellipsis = "…"
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + ellipsis
+}
+
+// postSections posts a header and the sections, split over as many messages
+// as the block limit requires
+func (n *SlackNotifier) postSections(title string, sections []string) error {
+	perMessage := slackMaxBlocks - 1
+	parts := (len(sections) + perMessage - 1) / perMessage
+	for part := 0; part < parts; part++ {
+		start := part * perMessage
+		end := start + perMessage
+		if end > len(sections) {
+			end = len(sections)
+		}
+
+		header := title
+		if parts > 1 {
+			header += fmt.Sprintf(" (%d/%d)", part+1, parts)
+		}
+		blocks := []slackBlock{headerBlock(header)}
+		for _, section := range sections[start:end] {
+			blocks = append(blocks, markdownSection(section))
+		}
+		if err := n.post(slackMessage{Text: header, Blocks: blocks}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Blocks      []slackBlock      `json:"blocks,omitempty"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func headerBlock(text string) slackBlock {
+	return slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: text}}
+}
+
+func markdownSection(text string) slackBlock {
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}}
+}
+
+func statusColor(status string) string {
+	switch status {
+	case "up":
+		return slackColorUp
+	case "down":
+		return slackColorDown
+	default:
+		return slackColorOther
+	}
+}
+
+func (n *SlackNotifier) post(message slackMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"watchtower/internal/database"
+)
+
+// slackRecorder is a Slack webhook that keeps the messages it receives
+type slackRecorder struct {
+	mu       sync.Mutex
+	messages []slackMessage
+}
+
+func (r *slackRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var message slackMessage
+	if err := json.NewDecoder(req.Body).Decode(&message); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.messages = append(r.messages, message)
+	r.mu.Unlock()
+}
+
+func checkSlackLimits(t *testing.T, messages []slackMessage) {
+	t.Helper()
+	for i, message := range messages {
+		if len(message.Blocks) > slackMaxBlocks {
+			t.Errorf("message %d has %d blocks, limit %d", i, len(message.Blocks), slackMaxBlocks)
+		}
+		for _, block := range message.Blocks {
+			if block.Type == "section" && len(block.Text.Text) > slackMaxSectionText {
+				t.Errorf("message %d has a section of %d characters, limit %d", i, len(block.Text.Text), slackMaxSectionText)
+			}
+		}
+	}
+}
+
+func TestSlackNotifyNewDomainsLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		programs int
+		perProg  int
+	}{
+		{name: "one program", programs: 1, perProg: 3},
+		{name: "many programs", programs: 200, perProg: 1},
+		{name: "many domains", programs: 2, perProg: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &slackRecorder{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			var domains []database.Domain
+			for p := 0; p < tt.programs; p++ {
+				for d := 0; d < tt.perProg; d++ {
+					domains = append(domains, database.Domain{
+						Domain:  fmt.Sprintf("host%d.program%d.example.com", d, p),
+						Program: fmt.Sprintf("program%d", p),
+					})
+				}
+			}
+			if err := NewSlackNotifier(server.URL).NotifyNewDomains(domains); err != nil {
+				t.Fatalf("NotifyNewDomains: %v", err)
+			}
+			if len(recorder.messages) == 0 {
+				t.Fatal("no message posted")
+			}
+			checkSlackLimits(t, recorder.messages)
+		})
+	}
+}
+
+func TestSlackNotifyAlertsLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		alerts    int
+		detailLen int
+	}{
+		{name: "few short alerts", alerts: 3, detailLen: 10},
+		{name: "many long alerts", alerts: 500, detailLen: 400},
+		{name: "one oversized alert", alerts: 1, detailLen: 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &slackRecorder{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			var alerts []database.Alert
+			for i := 0; i < tt.alerts; i++ {
+				alerts = append(alerts, database.Alert{
+					Type:    database.AlertTypeTechChange,
+					Domain:  fmt.Sprintf("host%d.example.com", i),
+					Program: "program",
+					Detail:  strings.Repeat("x", tt.detailLen),
+				})
+			}
+			if err := NewSlackNotifier(server.URL).NotifyAlerts(alerts); err != nil {
+				t.Fatalf("NotifyAlerts: %v", err)
+			}
+			checkSlackLimits(t, recorder.messages)
+
+			// Every alert is delivered exactly once
+			lines := 0
+			for _, message := range recorder.messages {
+				for _, block := range message.Blocks {
+					if block.Type == "section" {
+						lines += strings.Count(block.Text.Text, "\n") + 1
+					}
+				}
+			}
+			if lines != tt.alerts {
+				t.Errorf("posted %d alert lines, want %d", lines, tt.alerts)
+			}
+		})
+	}
+}
+
+func TestSlackAlertLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		alert database.Alert
+		want  string
+	}{
+		{
+			name:  "domain alert",
+			alert: database.Alert{Type: database.AlertTypeTech, Domain: "ci.example.com", Program: "p", Detail: "Jenkins"},
+			want:  "*p* `ci.example.com` " + alertLabel(database.AlertTypeTech) + ": Jenkins",
+		},
+		{
+			name:  "surge alert",
+			alert: database.Alert{Type: database.AlertTypeSurge, Program: "p", Detail: "10 -> 100 domains"},
+			want:  "*p* " + alertLabel(database.AlertTypeSurge) + ": 10 -> 100 domains",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &slackRecorder{}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			if err := NewSlackNotifier(server.URL).NotifyAlerts([]database.Alert{tt.alert}); err != nil {
+				t.Fatalf("NotifyAlerts: %v", err)
+			}
+			var got string
+			for _, block := range recorder.messages[0].Blocks {
+				if block.Type == "section" {
+					got = block.Text.Text
+				}
+			}
+			if got != tt.want {
+				t.Errorf("line = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
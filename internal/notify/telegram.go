@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"watchtower/internal/database"
+)
+
+// telegramMaxMessage is Telegram's limit on the length of a message text
+const telegramMaxMessage = 4096
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// TelegramNotifier sends a summary of newly discovered domains, grouped by
+// program, to a Telegram chat through the Bot API
+type TelegramNotifier struct {
+	token  string
+	chatID string
+	client *http.Client
+}
+
+func NewTelegramNotifier(token, chatID string) *TelegramNotifier {
+	return &TelegramNotifier{
+		token:  token,
+		chatID: chatID,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+// NotifyNewDomains sends the domains in as many messages as needed to stay
+// under Telegram's message length limit
+func (n *TelegramNotifier) NotifyNewDomains(domains []database.Domain) error {
+	if len(domains) == 0 {
+		return nil
+	}
+
+	byProgram := make(map[string][]string)
+	for _, domain := range domains {
+		byProgram[domain.Program] = append(byProgram[domain.Program], domain.Domain)
+	}
+	programs := make([]string, 0, len(byProgram))
+	for program := range byProgram {
+		programs = append(programs, program)
+	}
+	sort.Strings(programs)
+
+	lines := []string{fmt.Sprintf("Watchtower: %d new domains", len(domains))}
+	for _, program := range programs {
+		hosts := byProgram[program]
+		sort.Strings(hosts)
+		lines = append(lines, "", fmt.Sprintf("%s (%d)", program, len(hosts)))
+		for _, host := range hosts {
+			lines = append(lines, "  "+host)
+		}
+	}
+
+	for _, message := range splitMessage(lines, telegramMaxMessage) {
+		if err := n.send(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitMessage joins lines into messages of at most limit bytes. A single
+// line longer than the limit is cut.
+func splitMessage(lines []string, limit int) []string {
+	var messages []string
+	var current strings.Builder
+	for _, line := range lines {
+		if len(line) > limit {
+			line = line[:limit]
+		}
+		if current.Len() > 0 && current.Len()+1+len(line) > limit {
+			messages = append(messages, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte('\n')
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		messages = append(messages, current.String())
+	}
+	return messages
+}
+
+func (n *TelegramNotifier) send(text string) error {
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPIURL, n.token)
+	resp, err := n.client.PostForm(endpoint, url.Values{
+		"chat_id":                  {n.chatID},
+		"text":                     {text},
+		"disable_web_page_preview": {"true"},
+	})
+	if err != nil {
+		// The request URL contains the bot token; keep it out of the logs
+		if urlErr, ok := err.(*url.Error); ok {
+			return fmt.Errorf("telegram request failed: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		var telegramErr struct {
+			Description string `json:"description"`
+		}
+		if json.Unmarshal(detail, &telegramErr) == nil && telegramErr.Description != "" {
+			return fmt.Errorf("telegram returned status %d: %s", resp.StatusCode, telegramErr.Description)
+		}
+		return fmt.Errorf("telegram returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
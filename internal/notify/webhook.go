@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"watchtower/internal/database"
+)
+
+// WebhookNotifier posts every status change as its own JSON request
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// statusChangePayload is the body posted for a status change. NewlyUp marks
+// the down to up transitions that usually mean a new target came online.
+type statusChangePayload struct {
+	Domain    string    `json:"domain"`
+	Program   string    `json:"program"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	ChangedAt time.Time `json:"changed_at"`
+	NewlyUp   bool      `json:"newly_up"`
+}
+
+// alertPayload is the body posted for an alert; type tells it apart from a
+// status change
+type alertPayload struct {
+	Type      string    `json:"type"`
+	Domain    string    `json:"domain"`
+	Program   string    `json:"program"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// NotifyStatusChanges posts the changes in order and stops at the first
+// failed delivery, reporting the changes already posted
+func (n *WebhookNotifier) NotifyStatusChanges(changes []database.StatusChange) error {
+	for i, change := range changes {
+		if err := n.post(statusChangePayload{
+			Domain:    change.Domain,
+			Program:   change.Program,
+			OldStatus: change.OldStatus,
+			NewStatus: change.NewStatus,
+			ChangedAt: change.ChangedAt,
+			NewlyUp:   change.OldStatus == "down" && change.NewStatus == "up",
+		}); err != nil {
+			return partial(i, fmt.Errorf("status change of %s: %w", change.Domain, err))
+		}
+	}
+	return nil
+}
+
+// NotifyAlerts posts the alerts in order and stops at the first failed
+// delivery, reporting the alerts already posted
+func (n *WebhookNotifier) NotifyAlerts(alerts []database.Alert) error {
+	for i, alert := range alerts {
+		if err := n.post(alertPayload{
+			Type:      alert.Type,
+			Domain:    alert.Domain,
+			Program:   alert.Program,
+			Detail:    alert.Detail,
+			CreatedAt: alert.CreatedAt,
+		}); err != nil {
+			return partial(i, fmt.Errorf("%s alert of %s: %w", alert.Type, alert.Domain, err))
+		}
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) post(payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Watchtower/1.0")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"watchtower/internal/database"
+)
+
+func TestWebhookPartialDelivery(t *testing.T) {
+	tests := []struct {
+		name          string
+		failFrom      int32 // first request answered with 500, 0 for none
+		wantErr       bool
+		wantDelivered int
+	}{
+		{name: "all delivered", failFrom: 0},
+		{name: "first fails", failFrom: 1, wantErr: true, wantDelivered: 0},
+		{name: "later fails", failFrom: 3, wantErr: true, wantDelivered: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if n := atomic.AddInt32(&requests, 1); tt.failFrom > 0 && n >= tt.failFrom {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			err := NewWebhookNotifier(server.URL).NotifyStatusChanges([]database.StatusChange{
+				{Domain: "a.example.com", Program: "p", OldStatus: "down", NewStatus: "up"},
+				{Domain: "b.example.com", Program: "p", OldStatus: "down", NewStatus: "up"},
+				{Domain: "c.example.com", Program: "p", OldStatus: "down", NewStatus: "up"},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			delivered := 0
+			var partial *PartialError
+			if errors.As(err, &partial) {
+				delivered = partial.Delivered
+			}
+			if delivered != tt.wantDelivered {
+				t.Errorf("%d reported delivered, want %d", delivered, tt.wantDelivered)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Event types streamed to Bus subscribers
+const (
+	EventDomainNew    = "domain_new"
+	EventStatusChange = "status_change"
+	EventScanComplete = "scan_complete"
+)
+
+// Event is a scan event delivered to in-process subscribers
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// subscriberBuffer bounds the events waiting for a slow subscriber; beyond it
+// the subscriber misses events
+const subscriberBuffer = 100
+
+// Bus is an Output that hands events to in-process subscribers such as the
+// web server's live feed. Only newly discovered domains are forwarded.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]bool)}
+}
+
+// Subscribe returns a channel receiving all events from now on and a
+// function that ends the subscription
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = true
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.subscribers[ch] {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *Bus) Name() string {
+	return "events"
+}
+
+func (b *Bus) PublishDomains(ctx context.Context, events []DomainEvent) error {
+	for _, event := range events {
+		if event.New {
+			b.publish(Event{Type: EventDomainNew, Data: event})
+		}
+	}
+	return nil
+}
+
+func (b *Bus) PublishStatusChange(ctx context.Context, event StatusChangeEvent) error {
+	b.publish(Event{Type: EventStatusChange, Data: event})
+	return nil
+}
+
+func (b *Bus) PublishScanComplete(ctx context.Context, event ScanEvent) error {
+	b.publish(Event{Type: EventScanComplete, Data: event})
+	return nil
+}
+
+func (b *Bus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Event subscriber is falling behind, dropping %s event", event.Type)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package output
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Output is a sink that receives scan results in addition to the database,
+// e.g. a webhook or a message queue
+type Output interface {
+	Name() string
+	PublishDomains(ctx context.Context, events []DomainEvent) error
+	PublishStatusChange(ctx context.Context, event StatusChangeEvent) error
+	PublishScanComplete(ctx context.Context, event ScanEvent) error
+}
+
+// DomainEvent is published for every domain a scan records, batched per
+// program. New is set for domains seen for the first time.
+type DomainEvent struct {
+	Domain         string    `json:"domain"`
+	Program        string    `json:"program"`
+	Status         string    `json:"status"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Source         string    `json:"source,omitempty"`
+	BountyEligible bool      `json:"bounty_eligible"`
+	New            bool      `json:"new"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// StatusChangeEvent is published when a domain's status changes
+type StatusChangeEvent struct {
+	ID        int64     `json:"id"`
+	Domain    string    `json:"domain"`
+	Program   string    `json:"program"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ScanEvent is published when a full scan finishes
+type ScanEvent struct {
+	StartedAt     time.Time      `json:"started_at"`
+	FinishedAt    time.Time      `json:"finished_at"`
+	ProgramsTotal int            `json:"programs_total"`
+	ErrorCount    int            `json:"error_count"`
+	Errors        map[string]int `json:"errors_by_category"`
+}
+
+// queueSize bounds the events waiting for each output. Domain batches are
+// dropped beyond it so a stuck sink can never stall a scan; status changes
+// and finished scans wait for room instead.
+const queueSize = 1000
+
+// Fanout delivers every event to all of its outputs. Each output has its own
+// queue and goroutine, so a slow webhook doesn't hold up the others.
+type Fanout struct {
+	sinks   []*sink
+	timeout time.Duration
+
+	mu      sync.RWMutex // guards closed; held while enqueueing
+	closed  bool
+	running sync.WaitGroup
+}
+
+// sink is the queue of a single output
+type sink struct {
+	output Output
+	queue  chan publishFunc
+}
+
+type publishFunc func(ctx context.Context, o Output) error
+
+// NewFanout starts delivering to the given outputs. It returns nil when there
+// are no outputs; a nil Fanout ignores all events.
+func NewFanout(outputs ...Output) *Fanout {
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	f := &Fanout{timeout: 30 * time.Second}
+	for _, o := range outputs {
+		sk := &sink{output: o, queue: make(chan publishFunc, queueSize)}
+		f.sinks = append(f.sinks, sk)
+		f.running.Add(1)
+		go f.run(sk)
+	}
+	return f
+}
+
+// PublishDomains publishes the domains one batch of a program recorded. The
+// batch is dropped for outputs whose queue is full.
+func (f *Fanout) PublishDomains(events []DomainEvent) {
+	if len(events) == 0 {
+		return
+	}
+	f.enqueue("domain", false, func(ctx context.Context, o Output) error {
+		return o.PublishDomains(ctx, events)
+	})
+}
+
+func (f *Fanout) PublishStatusChange(event StatusChangeEvent) {
+	f.enqueue("status change", true, func(ctx context.Context, o Output) error {
+		return o.PublishStatusChange(ctx, event)
+	})
+}
+
+func (f *Fanout) PublishScanComplete(event ScanEvent) {
+	f.enqueue("scan complete", true, func(ctx context.Context, o Output) error {
+		return o.PublishScanComplete(ctx, event)
+	})
+}
+
+// enqueue hands an event to every output. With wait set it blocks until the
+// queue has room rather than dropping the event.
+func (f *Fanout) enqueue(kind string, wait bool, publish publishFunc) {
+	if f == nil {
+		return
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed {
+		log.Printf("Outputs are closed, dropping %s event", kind)
+		return
+	}
+	for _, sk := range f.sinks {
+		if wait {
+			sk.queue <- publish
+			continue
+		}
+		select {
+		case sk.queue <- publish:
+		default:
+			log.Printf("Output %s queue full, dropping %s event", sk.output.Name(), kind)
+		}
+	}
+}
+
+// Close stops accepting events and waits until every output delivered the
+// events already queued, or until ctx is done
+func (f *Fanout) Close(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		for _, sk := range f.sinks {
+			close(sk.queue)
+		}
+	}
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		f.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *Fanout) run(sk *sink) {
+	defer f.running.Done()
+	for publish := range sk.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+		if err := publish(ctx, sk.output); err != nil {
+			log.Printf("Output %s failed: %v", sk.output.Name(), err)
+		}
+		cancel()
+	}
+}
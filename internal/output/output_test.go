@@ -0,0 +1,159 @@
+package output
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedOutput blocks every delivery until release is closed and counts the
+// events it received
+type gatedOutput struct {
+	release chan struct{}
+	mu      sync.Mutex
+	domains int
+	changes int
+}
+
+func (o *gatedOutput) Name() string { return "gated" }
+
+func (o *gatedOutput) PublishDomains(ctx context.Context, events []DomainEvent) error {
+	<-o.release
+	o.mu.Lock()
+	o.domains += len(events)
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *gatedOutput) PublishStatusChange(ctx context.Context, event StatusChangeEvent) error {
+	<-o.release
+	o.mu.Lock()
+	o.changes++
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *gatedOutput) PublishScanComplete(ctx context.Context, event ScanEvent) error {
+	<-o.release
+	return nil
+}
+
+func (o *gatedOutput) counts() (int, int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.domains, o.changes
+}
+
+func TestFanoutSlowOutputDoesNotBlockBus(t *testing.T) {
+	slow := &gatedOutput{release: make(chan struct{})}
+	defer close(slow.release)
+	bus := NewBus()
+	events, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	f := NewFanout(slow, bus)
+
+	f.PublishDomains([]DomainEvent{{Domain: "a.example.com", New: true}, {Domain: "b.example.com", New: true}})
+	for _, want := range []string{"a.example.com", "b.example.com"} {
+		select {
+		case event := <-events:
+			if got := event.Data.(DomainEvent).Domain; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("bus didn't receive %s while another output was stuck", want)
+		}
+	}
+}
+
+func TestFanoutFullQueue(t *testing.T) {
+	const published = queueSize + 10
+	tests := []struct {
+		name    string
+		publish func(f *Fanout)
+		// The output may have taken one event off the queue before it filled
+		minDomains, maxDomains int
+		wantChanges            int
+	}{
+		{
+			name:        "status changes wait for room",
+			publish:     func(f *Fanout) { f.PublishStatusChange(StatusChangeEvent{Domain: "a.example.com"}) },
+			wantChanges: published,
+		},
+		{
+			name:       "domain batches are dropped",
+			publish:    func(f *Fanout) { f.PublishDomains([]DomainEvent{{Domain: "a.example.com"}}) },
+			minDomains: queueSize,
+			maxDomains: queueSize + 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &gatedOutput{release: make(chan struct{})}
+			f := NewFanout(out)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < published; i++ {
+					tt.publish(f)
+				}
+			}()
+			// Let the queue fill up before the output catches up
+			time.Sleep(100 * time.Millisecond)
+			close(out.release)
+			<-done
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				domains, changes := out.counts()
+				if changes == tt.wantChanges && domains >= tt.minDomains && domains <= tt.maxDomains {
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("received %d domains and %d status changes, want %d-%d and %d",
+						domains, changes, tt.minDomains, tt.maxDomains, tt.wantChanges)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestFanoutCloseDrainsQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		stuck       bool
+		wantErr     bool
+		wantChanges int
+	}{
+		{name: "queued events are delivered", wantChanges: 20},
+		{name: "gives up on a stuck output", stuck: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &gatedOutput{release: make(chan struct{})}
+			f := NewFanout(out)
+			for i := 0; i < 20; i++ {
+				f.PublishStatusChange(StatusChangeEvent{Domain: "a.example.com"})
+			}
+			if tt.stuck {
+				defer close(out.release)
+			} else {
+				close(out.release)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := f.Close(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Close: %v, want error %v", err, tt.wantErr)
+			}
+			if _, changes := out.counts(); changes != tt.wantChanges {
+				t.Errorf("%d status changes delivered, want %d", changes, tt.wantChanges)
+			}
+			// Events published after Close are dropped instead of panicking
+			f.PublishStatusChange(StatusChangeEvent{Domain: "b.example.com"})
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Webhook posts every event as JSON to a URL. The body has the form
+// {"event": "domains"|"status_change"|"scan_complete", "data": ...}; the data
+// of a domains event is the list of domains one batch of a program recorded.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (w *Webhook) Name() string {
+	return "webhook " + w.url
+}
+
+func (w *Webhook) PublishDomains(ctx context.Context, events []DomainEvent) error {
+	return w.post(ctx, "domains", events)
+}
+
+func (w *Webhook) PublishStatusChange(ctx context.Context, event StatusChangeEvent) error {
+	return w.post(ctx, "status_change", event)
+}
+
+func (w *Webhook) PublishScanComplete(ctx context.Context, event ScanEvent) error {
+	return w.post(ctx, "scan_complete", event)
+}
+
+func (w *Webhook) post(ctx context.Context, kind string, data interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"event": kind,
+		"data":  data,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Watchtower/1.0")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s event rejected with status %d", kind, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"watchtower/internal/domainutil"
+)
+
+type Service struct {
+	resolver *net.Resolver
+	workers  int
+	timeout  time.Duration
+}
+
+// Result is the outcome of resolving a single domain
+type Result struct {
+	Domain string
+	IPs    []string
+	Err    error
+}
+
+// NotFound reports whether the domain definitively has no records, as opposed
+// to a lookup that failed or timed out
+func (r Result) NotFound() bool {
+	var dnsErr *net.DNSError
+	return errors.As(r.Err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// Internal reports whether the domain resolved only to private, loopback or
+// otherwise reserved addresses that can't be reached from the internet
+func (r Result) Internal() bool {
+	if r.Err != nil || len(r.IPs) == 0 {
+		return false
+	}
+	for _, ip := range r.IPs {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !isReserved(addr.Unmap()) {
+			return false
+		}
+	}
+	return true
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func isReserved(addr netip.Addr) bool {
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() ||
+		addr.IsUnspecified() || addr.IsMulticast() || sharedAddressSpace.Contains(addr) ||
+		(addr.Is4() && addr.As4()[0] == 0)
+}
+
+// NewService creates a resolver that runs up to workers lookups at a time,
+// each bounded by timeout
+func NewService(workers int, timeout time.Duration) *Service {
+	return &Service{
+		resolver: net.DefaultResolver,
+		workers:  workers,
+		timeout:  timeout,
+	}
+}
+
+// ResolveDomains looks up the addresses of all domains with a bounded worker
+// pool. When ctx is done the results gathered so far are returned; domains
+// that were not resolved by then are missing from the map.
+func (s *Service) ResolveDomains(ctx context.Context, domains []string) map[string]Result {
+	workers := s.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	domainChan := make(chan string)
+	resultChan := make(chan Result, workers)
+
+	go func() {
+		defer close(domainChan)
+		for _, domain := range domains {
+			select {
+			case domainChan <- domain:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range domainChan {
+				resultChan <- s.resolve(ctx, domain)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	results := make(map[string]Result, len(domains))
+	for result := range resultChan {
+		// Lookups cut short by the overall deadline say nothing about the domain
+		if result.Err != nil && ctx.Err() != nil {
+			continue
+		}
+		results[result.Domain] = result
+	}
+	return results
+}
+
+// resolve looks up a single domain with its own timeout so one slow
+// nameserver can't stall the batch
+func (s *Service) resolve(ctx context.Context, domain string) Result {
+	lookupCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	ips, err := s.resolver.LookupHost(lookupCtx, domainutil.ToASCII(domain))
+	return Result{Domain: domain, IPs: ips, Err: err}
+}
@@ -0,0 +1,142 @@
+package scanning
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"watchtower/internal/domainutil"
+	"watchtower/internal/subprocess"
+)
+
+// nucleiTimeout bounds a single nuclei run over the live hosts of a program
+const nucleiTimeout = 30 * time.Minute
+
+// Service runs nuclei against live hosts. Nuclei parallelizes internally, so
+// only one run is started at a time even when programs are scanned in
+// parallel.
+type Service struct {
+	semaphore chan struct{}
+}
+
+func NewService() *Service {
+	return &Service{semaphore: make(chan struct{}, 1)}
+}
+
+// Finding is one nuclei match
+type Finding struct {
+	Domain     string
+	TemplateID string
+	Name       string
+	Severity   string
+	MatchedAt  string // URL or address the template matched
+}
+
+// RunNuclei runs the templates at the given path against the domains and
+// returns what matched. Findings on hosts outside domains are dropped.
+func (s *Service) RunNuclei(ctx context.Context, domains []string, templates string) ([]Finding, error) {
+	if len(domains) == 0 {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("nuclei"); err != nil {
+		return nil, fmt.Errorf("nuclei not found in PATH: %w", err)
+	}
+
+	select {
+	case s.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.semaphore }()
+
+	input, err := os.CreateTemp("", "watchtower-nuclei-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nuclei input file: %w", err)
+	}
+	defer os.Remove(input.Name())
+
+	wanted := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		wanted[domain] = true
+		if _, err := fmt.Fprintln(input, domainutil.ToASCII(domain)); err != nil {
+			input.Close()
+			return nil, fmt.Errorf("failed to write nuclei input file: %w", err)
+		}
+	}
+	if err := input.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write nuclei input file: %w", err)
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, nucleiTimeout)
+	defer cancel()
+
+	output, err := subprocess.Run(cmdCtx, fmt.Sprintf("%d hosts", len(domains)), "nuclei",
+		"-l", input.Name(),
+		"-t", templates,
+		"-jsonl",
+		"-silent",
+		"-no-color",
+		"-disable-update-check",
+	)
+	if err != nil && len(output) == 0 {
+		return nil, err
+	}
+	return parseNucleiOutput(output, wanted)
+}
+
+// nucleiResult is one line of nuclei -jsonl output
+type nucleiResult struct {
+	TemplateID string `json:"template-id"`
+	Info       struct {
+		Name     string `json:"name"`
+		Severity string `json:"severity"`
+	} `json:"info"`
+	Host      string `json:"host"`
+	MatchedAt string `json:"matched-at"`
+}
+
+// parseNucleiOutput reads nuclei -jsonl output, skipping lines that aren't
+// JSON objects and duplicate matches
+func parseNucleiOutput(output []byte, wanted map[string]bool) ([]Finding, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	// Results can embed whole requests and responses
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var findings []Finding
+	seen := make(map[Finding]bool)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var result nucleiResult
+		if err := json.Unmarshal(line, &result); err != nil || result.TemplateID == "" {
+			continue
+		}
+
+		domain := domainutil.Normalize(result.Host)
+		if !wanted[domain] {
+			continue
+		}
+		finding := Finding{
+			Domain:     domain,
+			TemplateID: result.TemplateID,
+			Name:       result.Info.Name,
+			Severity:   result.Info.Severity,
+			MatchedAt:  result.MatchedAt,
+		}
+		if finding.MatchedAt == "" {
+			finding.MatchedAt = result.Host
+		}
+		if !seen[finding] {
+			seen[finding] = true
+			findings = append(findings, finding)
+		}
+	}
+	return findings, scanner.Err()
+}
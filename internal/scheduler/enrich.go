@@ -0,0 +1,239 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"watchtower/internal/database"
+	"watchtower/internal/enrichment"
+)
+
+// ReenrichResult reports the outcome of a re-enrichment pass
+type ReenrichResult struct {
+	Attempted     int               `json:"attempted"`
+	Enriched      int               `json:"enriched"`
+	FailedDomains []string          `json:"failed_domains"`
+	Errors        map[string]string `json:"errors,omitempty"` // failure reason by domain
+}
+
+// ErrReenrichRunning is returned when a re-enrichment pass is already running
+var ErrReenrichRunning = fmt.Errorf("re-enrichment already running")
+
+// ReenrichMissing retries enrichment for up to limit live domains that have
+// no stored domain_info, so hosts that blipped during a scan eventually get
+// their details filled in
+func (s *Scheduler) ReenrichMissing(ctx context.Context, limit int) (*ReenrichResult, error) {
+	if !s.reenriching.CompareAndSwap(false, true) {
+		return nil, ErrReenrichRunning
+	}
+	defer s.reenriching.Store(false)
+
+	if !s.enrichmentService.Available() {
+		return nil, enrichment.ErrHTTPXMissing
+	}
+
+	domains, err := s.db.GetDomainsWithoutInfo(limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains without info: %w", err)
+	}
+
+	result := &ReenrichResult{Attempted: len(domains), FailedDomains: []string{}, Errors: map[string]string{}}
+	if len(domains) == 0 {
+		return result, nil
+	}
+
+	log.Printf("Re-enriching %d domains without info...", len(domains))
+	names := make([]string, len(domains))
+	for i, d := range domains {
+		names[i] = d.Domain
+	}
+	details := s.enrichmentService.EnrichDomains(ctx, names)
+
+	for _, d := range domains {
+		detail, ok := details[d.Domain]
+		if !ok {
+			result.FailedDomains = append(result.FailedDomains, d.Domain)
+			result.Errors[d.Domain] = "not enriched"
+			continue
+		}
+		if detail.Err != nil {
+			log.Printf("Error enriching %s: %v", d.Domain, detail.Err)
+			result.FailedDomains = append(result.FailedDomains, d.Domain)
+			result.Errors[d.Domain] = detail.Err.Error()
+			continue
+		}
+		if err := s.saveEnrichment(d.Program, detail.Details, false); err != nil {
+			log.Printf("Error saving domain info for %s: %v", d.Domain, err)
+			result.FailedDomains = append(result.FailedDomains, d.Domain)
+			result.Errors[d.Domain] = err.Error()
+			continue
+		}
+		result.Enriched++
+	}
+
+	log.Printf("Re-enrichment finished: %d of %d domains enriched", result.Enriched, result.Attempted)
+	return result, nil
+}
+
+// enrichProgramDomains runs httpx on the live domains of a program and
+// stores the details in domain_info. It does nothing when httpx isn't
+// installed.
+func (s *Scheduler) enrichProgramDomains(ctx context.Context, run *scanRun, handle string, domains []string) {
+	if !s.enrichmentService.Available() {
+		return
+	}
+	log.Printf("Enriching %d live domains for program %s...", len(domains), handle)
+	details := s.enrichmentService.EnrichDomains(ctx, domains)
+
+	enriched := 0
+	for _, domain := range domains {
+		detail, ok := details[domain]
+		if !ok {
+			continue
+		}
+		if detail.Err != nil {
+			run.summary.AddError(handle, CategoryEnrich, fmt.Errorf("enrich %s: %w", domain, detail.Err))
+			continue
+		}
+		if err := s.saveEnrichment(handle, detail.Details, run.silent); err != nil {
+			run.summary.AddError(handle, CategorySave, fmt.Errorf("save domain info %s: %w", domain, err))
+			continue
+		}
+		enriched++
+	}
+	log.Printf("Enriched %d of %d live domains for program %s", enriched, len(domains), handle)
+}
+
+// saveEnrichment persists enrichment details for a domain of a program. The
+// alerts of a silent scan are recorded as already notified.
+func (s *Scheduler) saveEnrichment(program string, details *enrichment.DomainDetails, silent bool) error {
+	previous, err := s.db.GetDomainInfo(details.Domain)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	info := &database.DomainInfo{
+		Domain:       details.Domain,
+		Program:      program,
+		Status:       details.Status,
+		Title:        details.Title,
+		StatusCode:   details.StatusCode,
+		Server:       details.Server,
+		Technologies: details.Technologies,
+		FaviconHash:  details.FaviconHash,
+		LastChecked:  time.Now(),
+	}
+	if err := s.db.SaveDomainInfo(info); err != nil {
+		return err
+	}
+
+	s.checkTechAlerts(program, details, silent)
+	s.checkTechChanges(program, previous, details, silent)
+	return nil
+}
+
+// checkTechChanges records a tech_change alert when a host that was already
+// enriched while up starts running technologies it didn't before. Names are
+// compared without versions, so upgrades and reordering are not changes.
+func (s *Scheduler) checkTechChanges(program string, previous *database.DomainInfo, details *enrichment.DomainDetails, silent bool) {
+	if previous == nil || previous.Status != "up" || details.Status != "up" {
+		return
+	}
+
+	known := make(map[string]bool, len(previous.Technologies))
+	for _, tech := range previous.Technologies {
+		known[techName(tech)] = true
+	}
+
+	var added []string
+	for _, tech := range details.Technologies {
+		name := techName(tech)
+		if name == "" || known[name] {
+			continue
+		}
+		known[name] = true
+		added = append(added, tech)
+	}
+	if len(added) == 0 {
+		return
+	}
+	sort.Strings(added)
+
+	alert := &database.Alert{
+		Type:    database.AlertTypeTechChange,
+		Domain:  details.Domain,
+		Program: program,
+		Detail:  strings.Join(added, ", "),
+	}
+	created, err := s.saveAlert(alert, silent)
+	if err != nil {
+		log.Printf("Error saving tech change for %s: %v", details.Domain, err)
+		return
+	}
+	if created {
+		log.Printf("[TECH CHANGE] %s (%s) now runs %s", details.Domain, program, alert.Detail)
+	}
+}
+
+// checkTechAlerts records a tech_alert when a domain runs any of the
+// technologies listed in ALERT_ON_TECH
+func (s *Scheduler) checkTechAlerts(program string, details *enrichment.DomainDetails, silent bool) {
+	if len(s.alertTechs) == 0 {
+		return
+	}
+
+	var matched []string
+	seen := make(map[string]bool)
+	for _, tech := range details.Technologies {
+		name := techName(tech)
+		if s.alertTechs[name] && !seen[name] {
+			seen[name] = true
+			matched = append(matched, tech)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+	sort.Strings(matched)
+
+	alert := &database.Alert{
+		Type:    database.AlertTypeTech,
+		Domain:  details.Domain,
+		Program: program,
+		Detail:  strings.Join(matched, ", "),
+	}
+	created, err := s.saveAlert(alert, silent)
+	if err != nil {
+		log.Printf("Error saving tech alert for %s: %v", details.Domain, err)
+		return
+	}
+	if created {
+		log.Printf("[TECH ALERT] %s (%s) runs %s", details.Domain, program, alert.Detail)
+	}
+}
+
+// saveAlert records an alert; with silent set a new alert is marked notified
+// right away
+func (s *Scheduler) saveAlert(alert *database.Alert, silent bool) (bool, error) {
+	created, err := s.db.SaveAlert(alert)
+	if err != nil || !created || !silent {
+		return created, err
+	}
+	if err := s.db.MarkAlertNotified(alert.ID); err != nil {
+		log.Printf("Error clearing alert %d of silent scan: %v", alert.ID, err)
+	}
+	return created, nil
+}
+
+// techName returns the lowercase technology name without its version, e.g.
+// "Jenkins:2.401" becomes "jenkins"
+func techName(tech string) string {
+	name, _, _ := strings.Cut(tech, ":")
+	return strings.ToLower(strings.TrimSpace(name))
+}
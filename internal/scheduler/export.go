@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"watchtower/internal/database"
+)
+
+// scanArtifact is the per-scan snapshot uploaded to S3
+type scanArtifact struct {
+	StartedAt     time.Time               `json:"started_at"`
+	FinishedAt    time.Time               `json:"finished_at"`
+	Summary       *ScanSummary            `json:"summary"`
+	NewDomains    []database.Domain       `json:"new_domains"`
+	StatusChanges []database.StatusChange `json:"status_changes"`
+}
+
+// exportScan uploads the scan's new domains and status changes to S3. It is
+// a no-op without an exporter, and failures never fail the scan.
+func (s *Scheduler) exportScan(run *scanRun) {
+	if s.exporter == nil {
+		return
+	}
+
+	if err := s.uploadScanArtifact(run); err != nil {
+		log.Printf("Scan export to S3 failed: %v", err)
+	}
+}
+
+func (s *Scheduler) uploadScanArtifact(run *scanRun) error {
+	summary := run.summary.Snapshot()
+
+	newDomains, err := s.db.GetDomainsDiscoveredSince(summary.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to load new domains: %w", err)
+	}
+	changes, err := s.db.GetStatusChangesSince(summary.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to load status changes: %w", err)
+	}
+
+	data, err := json.MarshalIndent(scanArtifact{
+		StartedAt:     summary.StartedAt,
+		FinishedAt:    summary.FinishedAt,
+		Summary:       summary,
+		NewDomains:    newDomains,
+		StatusChanges: changes,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	name := fmt.Sprintf("scan-%s.json", summary.StartedAt.UTC().Format("20060102T150405Z"))
+	if err := s.exporter.Upload(ctx, name, data, "application/json"); err != nil {
+		return err
+	}
+
+	log.Printf("Exported scan artifact %s (%d new domains, %d status changes)", name, len(newDomains), len(changes))
+	return nil
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"log"
+
+	"watchtower/internal/database"
+	"watchtower/internal/hackerone"
+)
+
+// manualProgram stands in for a program that only exists through imported
+// domains, e.g. a private engagement
+func manualProgram(handle string) hackerone.Program {
+	var program hackerone.Program
+	program.Type = database.ProgramSourceManual
+	program.Attributes.Handle = handle
+	program.Attributes.Name = handle
+	return program
+}
+
+// isManualProgram reports whether a program has no HackerOne counterpart
+func isManualProgram(program hackerone.Program) bool {
+	return program.Type == database.ProgramSourceManual
+}
+
+// addManualPrograms appends the programs of imported domains that are not
+// among the programs fetched from HackerOne
+func (s *Scheduler) addManualPrograms(programs []hackerone.Program) []hackerone.Program {
+	handles, err := s.db.GetManualPrograms()
+	if err != nil {
+		log.Printf("Error loading manual programs: %v", err)
+		return programs
+	}
+
+	known := make(map[string]bool, len(programs))
+	for _, program := range programs {
+		known[program.Attributes.Handle] = true
+	}
+	added := 0
+	for _, handle := range handles {
+		if !known[handle] {
+			programs = append(programs, manualProgram(handle))
+			added++
+		}
+	}
+	if added > 0 {
+		log.Printf("Added %d manual programs", added)
+	}
+	return programs
+}
+
+// manualDomains returns the imported domains of a program
+func (s *Scheduler) manualDomains(handle string) []string {
+	domains, err := s.db.GetManualDomains(handle)
+	if err != nil {
+		log.Printf("Error loading manual domains of %s: %v", handle, err)
+	}
+	return domains
+}
@@ -0,0 +1,280 @@
+package scheduler
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"watchtower/internal/config"
+	"watchtower/internal/database"
+	"watchtower/internal/notify"
+)
+
+// maxNotifyBatch bounds how many status changes are delivered after one scan;
+// the rest stay unnotified for the next one
+const maxNotifyBatch = 500
+
+// notifyStatusChanges hands the unnotified status changes, oldest first, to
+// every notifier that hasn't received them yet. Changes are marked notified
+// once all notifiers have them. Failures are logged and never fail the scan.
+func (s *Scheduler) notifyStatusChanges() {
+	if len(s.notifiers) == 0 {
+		return
+	}
+
+	// Full and watch scans finish independently; one delivery at a time
+	// keeps them from sending the same changes twice
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+
+	changes, err := s.db.GetUnnotifiedStatusChanges(maxNotifyBatch)
+	if err != nil {
+		log.Printf("Error loading unnotified status changes: %v", err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	ids := make([]int64, len(changes))
+	for i, change := range changes {
+		ids[i] = change.ID
+	}
+	names := make([]string, len(s.notifiers))
+	for i, notifier := range s.notifiers {
+		names[i] = notifier.Name()
+	}
+	complete := s.deliverPending(database.DeliveryStatusChange, ids, names, func(notifier int, items []int) error {
+		batch := make([]database.StatusChange, len(items))
+		for i, item := range items {
+			batch[i] = changes[item]
+		}
+		return s.notifiers[notifier].NotifyStatusChanges(batch)
+	})
+	if !complete {
+		return
+	}
+
+	for _, change := range changes {
+		if err := s.db.MarkStatusChangeNotified(change.ID); err != nil {
+			log.Printf("Error marking status change %d notified: %v", change.ID, err)
+		}
+	}
+	if err := s.db.ClearDeliveries(database.DeliveryStatusChange, ids); err != nil {
+		log.Printf("Error clearing deliveries of status changes: %v", err)
+	}
+	log.Printf("Sent %d status changes to %d notifiers", len(changes), len(s.notifiers))
+}
+
+// notifyAlerts hands the unnotified alerts of every type (tech_alert,
+// program_surge and tech_change) to the alert notifiers, tracking deliveries per notifier like status changes
+func (s *Scheduler) notifyAlerts() {
+	if len(s.alertNotifiers) == 0 {
+		return
+	}
+
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+
+	alerts, err := s.db.GetUnnotifiedAlerts(maxNotifyBatch)
+	if err != nil {
+		log.Printf("Error loading unnotified alerts: %v", err)
+		return
+	}
+	if len(alerts) == 0 {
+		return
+	}
+
+	ids := make([]int64, len(alerts))
+	for i, alert := range alerts {
+		ids[i] = alert.ID
+	}
+	names := make([]string, len(s.alertNotifiers))
+	for i, notifier := range s.alertNotifiers {
+		names[i] = notifier.Name()
+	}
+	complete := s.deliverPending(database.DeliveryAlert, ids, names, func(notifier int, items []int) error {
+		batch := make([]database.Alert, len(items))
+		for i, item := range items {
+			batch[i] = alerts[item]
+		}
+		return s.alertNotifiers[notifier].NotifyAlerts(batch)
+	})
+	if !complete {
+		return
+	}
+
+	for _, alert := range alerts {
+		if err := s.db.MarkAlertNotified(alert.ID); err != nil {
+			log.Printf("Error marking alert %d notified: %v", alert.ID, err)
+		}
+	}
+	if err := s.db.ClearDeliveries(database.DeliveryAlert, ids); err != nil {
+		log.Printf("Error clearing deliveries of alerts: %v", err)
+	}
+	log.Printf("Sent %d alerts to %d notifiers", len(alerts), len(s.alertNotifiers))
+}
+
+// deliverPending sends each notifier the items it hasn't received yet; send
+// delivers the items at the given indexes to the notifier at that index of
+// names. Deliveries are recorded per notifier, so a failing notifier doesn't
+// make the others send the same items again on the next attempt. It reports
+// whether every notifier now has every item.
+func (s *Scheduler) deliverPending(kind string, ids []int64, names []string, send func(notifier int, items []int) error) bool {
+	complete := true
+	for n, name := range names {
+		delivered, err := s.db.DeliveredTo(kind, name)
+		if err != nil {
+			log.Printf("Error loading deliveries of notifier %s: %v", name, err)
+			complete = false
+			continue
+		}
+
+		var items []int
+		var pending []int64
+		for i, id := range ids {
+			if !delivered[id] {
+				items = append(items, i)
+				pending = append(pending, id)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		if err := send(n, items); err != nil {
+			complete = false
+			var partial *notify.PartialError
+			if errors.As(err, &partial) && partial.Delivered > 0 && partial.Delivered <= len(pending) {
+				if err := s.db.MarkDelivered(kind, name, pending[:partial.Delivered]); err != nil {
+					log.Printf("Error recording deliveries of notifier %s: %v", name, err)
+				}
+				pending = pending[partial.Delivered:]
+			}
+			log.Printf("Notifier %s failed, %d %s items stay pending for it: %v", name, len(pending), kind, err)
+			continue
+		}
+		if err := s.db.MarkDelivered(kind, name, pending); err != nil {
+			log.Printf("Error recording deliveries of notifier %s: %v", name, err)
+			complete = false
+		}
+	}
+	return complete
+}
+
+// notifyNewDomains announces the domains discovered since a scan started to
+// the notifiers that support it. Silent scans announce nothing.
+func (s *Scheduler) notifyNewDomains(since time.Time, silent bool) {
+	if len(s.domainNotifiers) == 0 || silent {
+		return
+	}
+
+	discovered, err := s.db.GetDomainsDiscoveredSince(since)
+	if err != nil {
+		log.Printf("Error loading new domains for notification: %v", err)
+		return
+	}
+	var domains []database.Domain
+	for _, domain := range discovered {
+		if domain.IsNew {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		return
+	}
+	for _, notifier := range s.domainNotifiers {
+		if err := notifier.NotifyNewDomains(domains); err != nil {
+			log.Printf("Notifier %s failed to announce %d new domains: %v", notifier.Name(), len(domains), err)
+		}
+	}
+}
+
+// notifyScanDigest sends the findings of a full scan to the digest
+// notifiers. Silent scans send nothing.
+func (s *Scheduler) notifyScanDigest(run *scanRun) {
+	if len(s.digestNotifiers) == 0 || run.silent {
+		return
+	}
+
+	started := run.summary.StartedAt
+	stats, err := s.db.GetStats()
+	if err != nil {
+		log.Printf("Error loading stats for scan digest: %v", err)
+		return
+	}
+	discovered, err := s.db.GetDomainsDiscoveredSince(started)
+	if err != nil {
+		log.Printf("Error loading new domains for scan digest: %v", err)
+		return
+	}
+	changes, err := s.db.GetStatusChangesSince(started)
+	if err != nil {
+		log.Printf("Error loading status changes for scan digest: %v", err)
+		return
+	}
+
+	digest := &notify.Digest{
+		StartedAt:     started,
+		FinishedAt:    run.summary.FinishedAt,
+		Stats:         stats,
+		StatusChanges: changes,
+	}
+	for _, domain := range discovered {
+		if domain.IsNew {
+			digest.NewDomains = append(digest.NewDomains, domain)
+		}
+	}
+
+	for _, notifier := range s.digestNotifiers {
+		if err := notifier.NotifyScanDigest(digest); err != nil {
+			log.Printf("Notifier %s failed to send the scan digest: %v", notifier.Name(), err)
+		}
+	}
+}
+
+// notifiers groups the notifiers enabled in the configuration by what they
+// deliver
+type notifiers struct {
+	status  []notify.Notifier
+	domains []notify.DomainNotifier
+	digest  []notify.DigestNotifier
+	alerts  []notify.AlertNotifier
+}
+
+// buildNotifiers creates the notifiers enabled in the configuration
+func buildNotifiers(cfg *config.Config) notifiers {
+	var built notifiers
+	if cfg.NotifyWebhookURL != "" {
+		webhook := notify.NewWebhookNotifier(cfg.NotifyWebhookURL)
+		built.status = append(built.status, webhook)
+		built.alerts = append(built.alerts, webhook)
+	}
+	if cfg.SlackWebhookURL != "" {
+		slack := notify.NewSlackNotifier(cfg.SlackWebhookURL)
+		built.status = append(built.status, slack)
+		built.domains = append(built.domains, slack)
+		built.alerts = append(built.alerts, slack)
+	}
+	if cfg.DiscordWebhookURL != "" {
+		discord := notify.NewDiscordNotifier(cfg.DiscordWebhookURL)
+		built.status = append(built.status, discord)
+		built.domains = append(built.domains, discord)
+		built.alerts = append(built.alerts, discord)
+	}
+	if cfg.TelegramBotToken != "" && cfg.TelegramChatID != "" {
+		built.domains = append(built.domains, notify.NewTelegramNotifier(cfg.TelegramBotToken, cfg.TelegramChatID))
+	}
+	email := notify.NewEmailNotifier(notify.EmailConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		User:     cfg.SMTPUser,
+		Password: cfg.SMTPPass,
+		From:     cfg.EmailFrom,
+		To:       cfg.EmailTo,
+	})
+	if email.Enabled() {
+		built.digest = append(built.digest, email)
+	}
+	return built
+}
@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"watchtower/internal/database"
+	"watchtower/internal/notify"
+)
+
+// recordingNotifier records the status changes it receives and fails while
+// fail is set
+type recordingNotifier struct {
+	name     string
+	fail     bool
+	received [][]string
+}
+
+func (n *recordingNotifier) Name() string { return n.name }
+
+func (n *recordingNotifier) NotifyStatusChanges(changes []database.StatusChange) error {
+	if n.fail {
+		return errors.New("unavailable")
+	}
+	var domains []string
+	for _, change := range changes {
+		domains = append(domains, change.Domain)
+	}
+	n.received = append(n.received, domains)
+	return nil
+}
+
+func TestNotifyStatusChangesPerNotifier(t *testing.T) {
+	db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		for _, status := range []string{"up", "down"} {
+			if _, err := db.SaveDomain(&database.Domain{Domain: name, Program: "p", Status: status, DiscoveredAt: time.Now()}); err != nil {
+				t.Fatalf("SaveDomain: %v", err)
+			}
+		}
+	}
+
+	healthy := &recordingNotifier{name: "healthy"}
+	flaky := &recordingNotifier{name: "flaky", fail: true}
+	s := &Scheduler{db: db, notifiers: []notify.Notifier{healthy, flaky}}
+
+	steps := []struct {
+		name        string
+		flakyFails  bool
+		wantHealthy int
+		wantFlaky   int
+		wantPending int
+	}{
+		{name: "one notifier fails", flakyFails: true, wantHealthy: 1, wantFlaky: 0, wantPending: 2},
+		{name: "failed notifier recovers", flakyFails: false, wantHealthy: 1, wantFlaky: 1, wantPending: 0},
+		{name: "nothing left to send", flakyFails: false, wantHealthy: 1, wantFlaky: 1, wantPending: 0},
+	}
+	for _, step := range steps {
+		flaky.fail = step.flakyFails
+		s.notifyStatusChanges()
+
+		if len(healthy.received) != step.wantHealthy {
+			t.Errorf("%s: healthy notifier got %d batches, want %d", step.name, len(healthy.received), step.wantHealthy)
+		}
+		if len(flaky.received) != step.wantFlaky {
+			t.Errorf("%s: flaky notifier got %d batches, want %d", step.name, len(flaky.received), step.wantFlaky)
+		}
+		pending, err := db.GetUnnotifiedStatusChanges(maxNotifyBatch)
+		if err != nil {
+			t.Fatalf("GetUnnotifiedStatusChanges: %v", err)
+		}
+		if len(pending) != step.wantPending {
+			t.Errorf("%s: %d changes unnotified, want %d", step.name, len(pending), step.wantPending)
+		}
+	}
+
+	for _, batches := range [][][]string{healthy.received, flaky.received} {
+		if len(batches) == 0 {
+			continue
+		}
+		if got := batches[0]; len(got) != 2 || got[0] != "a.example.com" || got[1] != "b.example.com" {
+			t.Errorf("batch = %v, want oldest first [a.example.com b.example.com]", got)
+		}
+	}
+}
+
+// partialNotifier accepts the first accept changes of every batch and fails
+// the rest
+type partialNotifier struct {
+	accept   int
+	received []string
+}
+
+func (n *partialNotifier) Name() string { return "partial" }
+
+func (n *partialNotifier) NotifyStatusChanges(changes []database.StatusChange) error {
+	for i, change := range changes {
+		if i == n.accept {
+			return &notify.PartialError{Delivered: i, Err: errors.New("unavailable")}
+		}
+		n.received = append(n.received, change.Domain)
+	}
+	return nil
+}
+
+func TestNotifyStatusChangesPartialDelivery(t *testing.T) {
+	db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		for _, status := range []string{"up", "down"} {
+			if _, err := db.SaveDomain(&database.Domain{Domain: name, Program: "p", Status: status, DiscoveredAt: time.Now()}); err != nil {
+				t.Fatalf("SaveDomain: %v", err)
+			}
+		}
+	}
+
+	n := &partialNotifier{accept: 2}
+	s := &Scheduler{db: db, notifiers: []notify.Notifier{n}}
+
+	s.notifyStatusChanges()
+	if pending, _ := db.GetUnnotifiedStatusChanges(maxNotifyBatch); len(pending) != 3 {
+		t.Errorf("%d changes unnotified after a partial delivery, want 3", len(pending))
+	}
+
+	n.accept = 3
+	s.notifyStatusChanges()
+	want := []string{"a.example.com", "b.example.com", "c.example.com"}
+	if len(n.received) != len(want) {
+		t.Fatalf("received %v, want each change once: %v", n.received, want)
+	}
+	for i := range want {
+		if n.received[i] != want[i] {
+			t.Errorf("received %v, want %v", n.received, want)
+			break
+		}
+	}
+	if pending, _ := db.GetUnnotifiedStatusChanges(maxNotifyBatch); len(pending) != 0 {
+		t.Errorf("%d changes unnotified after the retry, want 0", len(pending))
+	}
+}
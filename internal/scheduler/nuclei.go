@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"watchtower/internal/database"
+)
+
+// scanProgramFindings runs the NUCLEI_TEMPLATES on the live domains of a
+// program and stores what matched in findings
+func (s *Scheduler) scanProgramFindings(ctx context.Context, run *scanRun, handle string, domains []string) {
+	log.Printf("Running nuclei on %d live domains for program %s...", len(domains), handle)
+	results, err := s.nuclei.RunNuclei(ctx, domains, s.config.NucleiTemplates)
+	if err != nil {
+		log.Printf("Nuclei failed for %s: %v", handle, err)
+		run.summary.AddError(handle, CategoryNuclei, err)
+		return
+	}
+
+	findings := make([]database.Finding, 0, len(results))
+	for _, result := range results {
+		findings = append(findings, database.Finding{
+			Domain:     result.Domain,
+			Program:    handle,
+			TemplateID: result.TemplateID,
+			Name:       result.Name,
+			Severity:   result.Severity,
+			MatchedAt:  result.MatchedAt,
+		})
+	}
+	created, err := s.db.SaveFindings(findings)
+	if err != nil {
+		run.summary.AddError(handle, CategorySave, fmt.Errorf("save findings: %w", err))
+		return
+	}
+	log.Printf("Nuclei found %d findings for program %s (%d new)", len(findings), handle, created)
+}
@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Per-program scans started by StartProgramScan are kept in memory; the
+// oldest finished ones are forgotten past maxProgramScans.
+const (
+	maxProgramScans    = 50
+	programScanTimeout = 30 * time.Minute
+)
+
+// Statuses of a per-program scan
+const (
+	ProgramScanRunning   = "running"
+	ProgramScanCompleted = "completed"
+	ProgramScanFailed    = "failed"
+	ProgramScanCancelled = "cancelled"
+)
+
+// ProgramScan describes a per-program scan started by StartProgramScan
+type ProgramScan struct {
+	ID      int64        `json:"scan_id"`
+	Program string       `json:"program"`
+	Status  string       `json:"status"`
+	Error   string       `json:"error,omitempty"`
+	Summary *ScanSummary `json:"summary"`
+}
+
+// programScan is a per-program scan; state is guarded by Scheduler.mu
+type programScan struct {
+	state   ProgramScan
+	summary *ScanSummary
+}
+
+// StartProgramScan fetches a program and scans it in the background, even if
+// it is fresh. It returns the ID to look the scan up with ProgramScanState.
+// The scan doesn't depend on ctx, which is only used to fetch the program;
+// Shutdown cancels it.
+func (s *Scheduler) StartProgramScan(ctx context.Context, handle string) (int64, error) {
+	program, err := s.fetchProgram(ctx, handle)
+	if err != nil {
+		return 0, err
+	}
+
+	scan := &programScan{summary: newScanSummary()}
+	s.mu.Lock()
+	s.lastScanID++
+	scan.state = ProgramScan{ID: s.lastScanID, Program: handle, Status: ProgramScanRunning}
+	s.programScans[scan.state.ID] = scan
+	s.forgetProgramScansLocked()
+	s.active.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.active.Done()
+		scanCtx, cancel := context.WithTimeout(s.stopped, programScanTimeout)
+		defer cancel()
+
+		err := s.scanProgram(scanCtx, scan.summary, *program)
+		if err != nil {
+			log.Printf("Program scan %d: %v", scan.state.ID, err)
+		}
+
+		s.mu.Lock()
+		switch {
+		case err == nil:
+			scan.state.Status = ProgramScanCompleted
+		case errors.Is(err, context.Canceled):
+			scan.state.Status = ProgramScanCancelled
+			scan.state.Error = err.Error()
+		default:
+			scan.state.Status = ProgramScanFailed
+			scan.state.Error = err.Error()
+		}
+		s.mu.Unlock()
+		s.refreshDomainMetrics()
+	}()
+	return scan.state.ID, nil
+}
+
+// ProgramScanState returns a per-program scan by ID. The summary of a running
+// scan holds the errors recorded so far.
+func (s *Scheduler) ProgramScanState(id int64) (ProgramScan, bool) {
+	s.mu.Lock()
+	scan, ok := s.programScans[id]
+	var state ProgramScan
+	if ok {
+		state = scan.state
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ProgramScan{}, false
+	}
+	state.Summary = scan.summary.Snapshot()
+	return state, true
+}
+
+// forgetProgramScansLocked drops the oldest finished scans past
+// maxProgramScans. Must be called with s.mu held.
+func (s *Scheduler) forgetProgramScansLocked() {
+	for id, scan := range s.programScans {
+		if id <= s.lastScanID-maxProgramScans && scan.state.Status != ProgramScanRunning {
+			delete(s.programScans, id)
+		}
+	}
+}
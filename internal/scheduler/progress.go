@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// Scan progress states and phases
+const (
+	ScanStateIdle    = "idle"
+	ScanStateRunning = "running"
+
+	PhaseFetchingPrograms = "fetching_programs"
+	PhaseProcessing       = "processing"
+	PhaseRetrying         = "retrying"
+	PhaseFinishing        = "finishing"
+)
+
+// ScanProgress describes how far the running scan got. Programs are
+// processed in parallel, so every program in flight is listed.
+type ScanProgress struct {
+	State            string     `json:"state"`
+	ScanID           int64      `json:"scan_id,omitempty"`
+	Phase            string     `json:"phase,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	ProgramIndex     int        `json:"program_index"`
+	ProgramsDone     int        `json:"programs_done"`
+	TotalPrograms    int        `json:"total_programs"`
+	CurrentProgram   string     `json:"current_program,omitempty"`
+	CurrentPrograms  []string   `json:"current_programs"`
+	DomainsProcessed int        `json:"domains_processed"`
+}
+
+// scanProgress tracks a running scan. A nil *scanProgress ignores all
+// updates, so programs scanned outside a full scan don't need one.
+type scanProgress struct {
+	mu       sync.Mutex
+	state    ScanProgress
+	inFlight []string
+}
+
+func newScanProgress(id int64) *scanProgress {
+	now := time.Now()
+	return &scanProgress{state: ScanProgress{
+		State:     ScanStateRunning,
+		ScanID:    id,
+		Phase:     PhaseFetchingPrograms,
+		StartedAt: &now,
+	}}
+}
+
+func (p *scanProgress) setPhase(phase string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Phase = phase
+}
+
+func (p *scanProgress) setTotal(total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.TotalPrograms = total
+}
+
+// startProgram marks a program as in flight. Retries don't count towards the
+// program index again.
+func (p *scanProgress) startProgram(handle string, retry bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !retry {
+		p.state.ProgramIndex++
+	}
+	p.state.CurrentProgram = handle
+	p.inFlight = append(p.inFlight, handle)
+}
+
+func (p *scanProgress) finishProgram(handle string, retry bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !retry {
+		p.state.ProgramsDone++
+	}
+	for i, h := range p.inFlight {
+		if h == handle {
+			p.inFlight = append(p.inFlight[:i], p.inFlight[i+1:]...)
+			break
+		}
+	}
+}
+
+func (p *scanProgress) addDomains(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.DomainsProcessed += n
+}
+
+func (p *scanProgress) snapshot() ScanProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.state
+	state.CurrentPrograms = append([]string{}, p.inFlight...)
+	return state
+}
+
+// Progress reports the progress of the running scan, or the idle state when
+// no scan is running
+func (s *Scheduler) Progress() ScanProgress {
+	s.mu.Lock()
+	progress := s.progress
+	s.mu.Unlock()
+	if progress == nil {
+		return ScanProgress{State: ScanStateIdle, CurrentPrograms: []string{}}
+	}
+	return progress.snapshot()
+}
@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"watchtower/internal/config"
+)
+
+// PruneResult counts the rows deleted by Prune
+type PruneResult struct {
+	Domains       int `json:"domains"`
+	StatusChanges int `json:"status_changes"`
+}
+
+// Prune applies the retention policy: domains not checked within
+// RETENTION_DAYS are deleted and status changes are trimmed to the newest
+// STATUS_CHANGES_KEEP. Stale domains are only pruned in full scan mode since
+// the lighter modes never update last_checked.
+func (s *Scheduler) Prune() (PruneResult, error) {
+	var result PruneResult
+
+	if s.config.RetentionDays > 0 && s.config.ScanMode == config.ScanModeFull {
+		pruned, err := s.db.PruneStaleDomains(time.Duration(s.config.RetentionDays) * 24 * time.Hour)
+		if err != nil {
+			return result, err
+		}
+		result.Domains = pruned
+	}
+
+	if s.config.StatusChangesKeep > 0 {
+		pruned, err := s.db.PruneStatusChanges(s.config.StatusChangesKeep)
+		if err != nil {
+			return result, err
+		}
+		result.StatusChanges = pruned
+	}
+
+	if result.Domains > 0 || result.StatusChanges > 0 {
+		log.Printf("Pruned %d stale domains and %d old status changes", result.Domains, result.StatusChanges)
+	}
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ScheduleState describes the periodic scan schedule
+type ScheduleState struct {
+	Paused   bool      `json:"paused"`
+	Running  bool      `json:"running"`
+	Interval string    `json:"interval"`
+	NextRun  time.Time `json:"next_run"`
+}
+
+// RunSchedule runs a scan every interval until ctx is cancelled. Ticks that
+// fire while the schedule is paused are skipped, not queued.
+func (s *Scheduler) RunSchedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.mu.Lock()
+	s.interval = interval
+	s.nextRun = time.Now().Add(interval)
+	s.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		s.nextRun = time.Now().Add(interval)
+		paused := s.paused
+		s.mu.Unlock()
+
+		if paused {
+			log.Println("Scheduled scan skipped: schedule is paused")
+			continue
+		}
+
+		// RunScan checks for a running scan under the same lock that
+		// registers its own
+		err := s.RunScan(ctx)
+		switch {
+		case errors.Is(err, ErrScanRunning):
+			log.Println("Scheduled scan skipped: a scan is already running")
+		case err != nil:
+			log.Printf("Scheduled scan error: %v", err)
+		}
+	}
+}
+
+// Shutdown stops all watches, per-program scans and scans started by
+// StartScan, and waits for running scans and watch scans to return. Scans
+// run by RunScan stop once their context is cancelled. It then waits for the
+// outputs to deliver the events still queued. Shutdown gives up when ctx is
+// done.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	for handle, w := range s.watches {
+		w.cancel()
+		delete(s.watches, handle)
+	}
+	if s.cancelScan != nil {
+		s.cancelScan()
+	}
+	s.stop()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// Deliver the events the scans published before they stopped
+	return s.outputs.Close(ctx)
+}
+
+// Pause stops scheduled scans from firing until Resume is called
+func (s *Scheduler) Pause() {
+	s.mu.Lock()
+	s.paused = true
+	s.mu.Unlock()
+	log.Println("Scan schedule paused")
+}
+
+// Resume re-enables scheduled scans
+func (s *Scheduler) Resume() {
+	s.mu.Lock()
+	s.paused = false
+	s.mu.Unlock()
+	log.Println("Scan schedule resumed")
+}
+
+// Schedule returns the current state of the scan schedule
+func (s *Scheduler) Schedule() ScheduleState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ScheduleState{
+		Paused:   s.paused,
+		Running:  s.scanning > 0,
+		Interval: s.interval.String(),
+		NextRun:  s.nextRun,
+	}
+}
@@ -2,16 +2,28 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"watchtower/internal/config"
 	"watchtower/internal/database"
 	"watchtower/internal/discovery"
+	"watchtower/internal/domainutil"
+	"watchtower/internal/enrichment"
+	"watchtower/internal/export"
 	"watchtower/internal/hackerone"
+	"watchtower/internal/metrics"
+	"watchtower/internal/notify"
+	"watchtower/internal/output"
+	"watchtower/internal/resolver"
+	"watchtower/internal/scanning"
+	"watchtower/internal/screenshot"
 	"watchtower/internal/healthcheck"
 )
 
@@ -20,7 +32,52 @@ type Scheduler struct {
 	hackeroneClient    *hackerone.Client
 	discoveryService   *discovery.Service
 	healthCheckService *healthcheck.Service
+	enrichmentService  *enrichment.Service
 	config             *config.Config
+	probes             map[string]healthcheck.Probe
+	timeouts           map[string]time.Duration
+	exporter           *export.S3Exporter
+	alertTechs         map[string]bool
+	watches            map[string]*watch
+	resolver           *resolver.Service
+	nuclei             *scanning.Service   // nil unless ENABLE_NUCLEI is set
+	screenshots        *screenshot.Service // nil unless ENABLE_SCREENSHOTS is set
+	events             *output.Bus
+	outputs            *output.Fanout
+	notifiers          []notify.Notifier
+	domainNotifiers    []notify.DomainNotifier
+	digestNotifiers    []notify.DigestNotifier
+	alertNotifiers     []notify.AlertNotifier
+	notifyMu           sync.Mutex
+
+	mu          sync.Mutex
+	lastSummary *ScanSummary
+	paused      bool
+	scanning    int            // scans currently running
+	cancelScan  context.CancelFunc
+	active      sync.WaitGroup // running scans and watches, awaited by Shutdown
+	interval    time.Duration
+	nextRun     time.Time
+	progress    *scanProgress // running full scan, nil when idle
+	reenriching atomic.Bool
+
+	// stopped is cancelled by Shutdown and parents per-program scans
+	stopped      context.Context
+	stop         context.CancelFunc
+	programScans map[int64]*programScan
+	lastScanID   int64
+}
+
+// scanRun carries the state shared by every program processed in one scan
+type scanRun struct {
+	summary *ScanSummary
+	// silent suppresses alert side effects while the first scan fills an
+	// empty database
+	silent bool
+	// force processes programs even if they are fresh
+	force bool
+	// progress is nil for single program scans
+	progress *scanProgress
 }
 
 func NewScheduler(
@@ -28,56 +85,507 @@ func NewScheduler(
 	hackeroneClient *hackerone.Client,
 	discoveryService *discovery.Service,
 	healthCheckService *healthcheck.Service,
+	enrichmentService *enrichment.Service,
 	cfg *config.Config,
 ) *Scheduler {
-	return &Scheduler{
+	// Parse per-program liveness probes once; a bad entry only disables that probe
+	probes := make(map[string]healthcheck.Probe)
+	for handle, spec := range cfg.HealthCheckProbes {
+		probe, err := healthcheck.ParseProbe(spec)
+		if err != nil {
+			log.Printf("Ignoring health check probe for %s: %v", handle, err)
+			continue
+		}
+		probes[handle] = probe
+	}
+
+	// Per-program timeouts override HEALTH_CHECK_TIMEOUT for slow programs
+	timeouts := make(map[string]time.Duration)
+	for handle, value := range cfg.HealthCheckTimeouts {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			log.Printf("Ignoring health check timeout for %s: invalid duration %q", handle, value)
+			continue
+		}
+		timeouts[handle] = timeout
+	}
+
+	events := output.NewBus()
+	sinks := []output.Output{events}
+	for _, url := range cfg.OutputWebhooks {
+		sinks = append(sinks, output.NewWebhook(url))
+	}
+
+	alertTechs := make(map[string]bool)
+	for _, tech := range cfg.AlertOnTech {
+		alertTechs[techName(tech)] = true
+	}
+
+	exporter, err := export.NewS3Exporter(export.S3Config{
+		Endpoint:  cfg.S3Endpoint,
+		Bucket:    cfg.S3Bucket,
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+		Region:    cfg.S3Region,
+		Prefix:    cfg.S3Prefix,
+		UseSSL:    cfg.S3UseSSL,
+	})
+	if err != nil {
+		log.Printf("S3 export disabled: %v", err)
+	} else if exporter != nil {
+		log.Printf("Exporting scan results to S3 bucket %s", cfg.S3Bucket)
+	}
+
+	notifiers := buildNotifiers(cfg)
+
+	s := &Scheduler{
 		db:                 db,
 		hackeroneClient:    hackeroneClient,
 		discoveryService:   discoveryService,
 		healthCheckService: healthCheckService,
+		enrichmentService:  enrichmentService,
 		config:             cfg,
+		probes:             probes,
+		timeouts:           timeouts,
+		exporter:           exporter,
+		alertTechs:         alertTechs,
+		watches:            make(map[string]*watch),
+		resolver:           resolver.NewService(cfg.ResolveConcurrency, cfg.ResolveTimeout),
+		events:             events,
+		outputs:            output.NewFanout(sinks...),
+		notifiers:          notifiers.status,
+		domainNotifiers:    notifiers.domains,
+		digestNotifiers:    notifiers.digest,
+		alertNotifiers:     notifiers.alerts,
+		programScans:       make(map[int64]*programScan),
+	}
+	s.stopped, s.stop = context.WithCancel(context.Background())
+	if cfg.EnableNuclei {
+		s.nuclei = scanning.NewService()
+		log.Printf("Running nuclei templates %s on live domains", cfg.NucleiTemplates)
 	}
+	if cfg.EnableScreenshots {
+		s.screenshots = screenshot.NewService(cfg.ScreenshotDir, cfg.ScreenshotConcurrency)
+		log.Printf("Taking screenshots of live domains into %s", cfg.ScreenshotDir)
+	}
+	if n, err := db.InterruptScanRuns(); err != nil {
+		log.Printf("Error closing interrupted scan runs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d scan runs left running by the previous process as interrupted", n)
+	}
+	s.refreshDomainMetrics()
+	return s
 }
 
-func (s *Scheduler) RunScan() error {
-	log.Println("Starting scan...")
+// ErrScanRunning is returned by RunScan and StartScan while another scan is
+// running
+var ErrScanRunning = fmt.Errorf("a scan is already running")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+// ErrNoScanRunning is returned by CancelScan when no scan is running
+var ErrNoScanRunning = fmt.Errorf("no scan is running")
+
+// RunScan scans every program, or returns ErrScanRunning if a scan is
+// already running. Cancelling parent or calling CancelScan stops the scan:
+// programs that haven't started are skipped and the post-scan steps don't
+// run.
+func (s *Scheduler) RunScan(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
 	defer cancel()
 
-	// Fetch all programs from HackerOne
-	log.Println("Fetching programs from HackerOne...")
-	programs, err := s.hackeroneClient.GetAllPrograms()
+	s.mu.Lock()
+	if s.scanning > 0 {
+		s.mu.Unlock()
+		return ErrScanRunning
+	}
+	s.beginScanLocked()
+	s.cancelScan = cancel
+	s.mu.Unlock()
+	return s.runScan(ctx, s.openScanRun(), false)
+}
+
+// CancelScan stops the running full scan, or returns ErrNoScanRunning
+func (s *Scheduler) CancelScan() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scanning == 0 || s.cancelScan == nil {
+		return ErrNoScanRunning
+	}
+	s.cancelScan()
+	log.Println("Scan cancelled")
+	return nil
+}
+
+// StartScan starts a scan in the background and returns the ID of its scan
+// run, or ErrScanRunning if a scan is already running. Shutdown cancels it.
+// force processes programs that SKIP_FRESH_WITHIN would skip.
+func (s *Scheduler) StartScan(force bool) (int64, error) {
+	s.mu.Lock()
+	if s.scanning > 0 {
+		s.mu.Unlock()
+		return 0, ErrScanRunning
+	}
+	s.beginScanLocked()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelScan = cancel
+	s.mu.Unlock()
+
+	id := s.openScanRun()
+
+	go func() {
+		defer cancel()
+		if err := s.runScan(ctx, id, force); err != nil {
+			log.Printf("Scan %d error: %v", id, err)
+		}
+	}()
+	return id, nil
+}
+
+// beginScanLocked registers a scan as running; runScan undoes the
+// registration. Must be called with s.mu held.
+func (s *Scheduler) beginScanLocked() {
+	s.scanning++
+	s.active.Add(1)
+	metrics.ScanStarted()
+}
+
+// openScanRun records the start of a scan and returns the run ID. A scan
+// whose run can't be recorded still runs, with ID 0.
+func (s *Scheduler) openScanRun() int64 {
+	id, err := s.db.StartScanRun()
+	if err != nil {
+		log.Printf("Error recording scan run: %v", err)
+		return 0
+	}
+	return id
+}
+
+// closeScanRun records the outcome and counts of a scan run
+func (s *Scheduler) closeScanRun(id int64, run *scanRun, scanErr error) {
+	if id == 0 {
+		return
+	}
+	summary := run.summary.Snapshot()
+	found, err := s.db.CountDomainsDiscoveredSince(summary.StartedAt)
 	if err != nil {
-		return fmt.Errorf("failed to fetch programs: %w", err)
+		log.Printf("Error counting domains of scan %d: %v", id, err)
 	}
+	stats := database.ScanStats{ProgramsProcessed: summary.ProgramsTotal, DomainsFound: found}
+	if err := s.db.FinishScanRun(id, stats, scanErr); err != nil {
+		log.Printf("Error recording end of scan %d: %v", id, err)
+	}
+}
 
-	log.Printf("Found %d programs", len(programs))
+func (s *Scheduler) runScan(parent context.Context, id int64, force bool) (err error) {
+	log.Printf("Starting scan %d (%s mode)...", id, s.config.ScanMode)
+	defer s.active.Done()
+	defer func() {
+		s.mu.Lock()
+		s.scanning--
+		s.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(parent, 2*time.Hour)
+	defer cancel()
+
+	run := &scanRun{summary: newScanSummary(), progress: newScanProgress(id), force: force}
+	defer func() { s.closeScanRun(id, run, err) }()
+	s.mu.Lock()
+	s.progress = run.progress
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.progress == run.progress {
+			s.progress = nil
+		}
+		s.mu.Unlock()
+	}()
+	if s.config.InitialScanSilent {
+		if count, err := s.db.CountDomains(); err == nil && count == 0 {
+			run.silent = true
+			log.Println("First scan on an empty database: alerts are suppressed for this run")
+		}
+	}
+
+	// Fetch all programs from HackerOne
+	log.Println("Fetching programs from HackerOne...")
+	programs, fetchErr := s.hackeroneClient.GetAllPrograms(ctx)
+	if fetchErr != nil {
+		run.summary.AddError("", CategoryScope, fetchErr)
+	} else {
+		log.Printf("Found %d programs", len(programs))
+	}
+	if !s.config.IncludePaused {
+		programs = s.skipPausedPrograms(ctx, programs)
+	}
+	// Manual programs are scanned even when HackerOne can't be reached
+	programs = s.addManualPrograms(programs)
+	if fetchErr != nil {
+		if len(programs) == 0 {
+			s.finishScan(run, 0, metrics.ScanFailed)
+			return fmt.Errorf("failed to fetch programs: %w", fetchErr)
+		}
+		log.Printf("Failed to fetch programs, scanning %d manual programs only: %v", len(programs), fetchErr)
+	}
+	run.progress.setTotal(len(programs))
+	run.progress.setPhase(PhaseProcessing)
 
 	// Process programs in parallel (with limit to avoid overwhelming the system)
-	semaphore := make(chan struct{}, 5) // Process up to 5 programs concurrently
-	var wg sync.WaitGroup
+	log.Printf("Processing %d programs, %d at a time", len(programs), s.config.ScanConcurrency)
+	var failedMu sync.Mutex
+	var failed []hackerone.Program
+	forEachProgram(ctx, programs, s.config.ScanConcurrency, s.config.ScanRampDuration, func(p hackerone.Program) {
+		run.progress.startProgram(p.Attributes.Handle, false)
+		defer run.progress.finishProgram(p.Attributes.Handle, false)
+		if err := s.processProgram(ctx, run, p); err != nil {
+			failedMu.Lock()
+			failed = append(failed, p)
+			failedMu.Unlock()
+		}
+	})
+	if parent.Err() != nil {
+		s.finishScan(run, len(programs), metrics.ScanCancelled)
+		return fmt.Errorf("scan cancelled: %w", parent.Err())
+	}
+	s.retryFailedPrograms(ctx, run, failed)
+
+	run.progress.setPhase(PhaseFinishing)
+	result := metrics.ScanSucceeded
+	if fetchErr != nil {
+		result = metrics.ScanFailed
+	}
+	s.finishScan(run, len(programs), result)
+	s.notifyStatusChanges()
+	if !run.silent {
+		s.notifyAlerts()
+	}
+	s.notifyNewDomains(run.summary.StartedAt, run.silent)
+	s.notifyScanDigest(run)
+	s.pruneCheckHistory()
+	if _, err := s.Prune(); err != nil {
+		log.Printf("Error applying retention policy: %v", err)
+	}
+	s.publishScanComplete(run)
+	s.exportScan(run)
+	if fetchErr != nil {
+		return fmt.Errorf("failed to fetch programs: %w", fetchErr)
+	}
+	log.Println("Scan completed successfully")
+	return nil
+}
+
+// forEachProgram calls fn for every program in its own goroutine, at most
+// limit at a time. With a ramp the limit grows from one to limit over that
+// duration. Programs that haven't started when ctx ends are skipped.
+func forEachProgram(ctx context.Context, programs []hackerone.Program, limit int, ramp time.Duration, fn func(hackerone.Program)) {
+	if limit < 1 {
+		limit = 1
+	}
+	semaphore := make(chan struct{}, limit)
+	if ramp > 0 {
+		rampSemaphore(ctx, semaphore, ramp)
+	}
 
+	var wg sync.WaitGroup
 	for _, program := range programs {
 		wg.Add(1)
 		go func(p hackerone.Program) {
 			defer wg.Done()
-			semaphore <- struct{}{}
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 			defer func() { <-semaphore }()
-
-			s.processProgram(ctx, p)
+			// A free slot and a cancelled ctx are both ready; don't start
+			if ctx.Err() != nil {
+				return
+			}
+			fn(p)
 		}(program)
 	}
-
 	wg.Wait()
+}
 
-	log.Println("Scan completed successfully")
-	return nil
+// rampSemaphore starts a scan at a concurrency of one and raises it to the
+// semaphore's capacity over the ramp duration, so the programs' subprocesses
+// don't all start in the same instant. It holds back all but one slot and
+// releases them evenly over the ramp.
+func rampSemaphore(ctx context.Context, semaphore chan struct{}, ramp time.Duration) {
+	reserved := cap(semaphore) - 1
+	if reserved < 1 {
+		return
+	}
+	for i := 0; i < reserved; i++ {
+		semaphore <- struct{}{}
+	}
+
+	step := ramp / time.Duration(reserved)
+	go func() {
+		for i := 0; i < reserved; i++ {
+			select {
+			case <-time.After(step):
+			case <-ctx.Done():
+			}
+			<-semaphore
+		}
+	}()
 }
 
-func (s *Scheduler) processProgram(ctx context.Context, program hackerone.Program) error {
-	log.Printf("Processing program: %s (%s)", program.Attributes.Name, program.Attributes.Handle)
+// retryFailedPrograms gives programs that failed in the main pass one more
+// attempt, sequentially and with a growing pause between attempts, until
+// SCAN_RETRY_BUDGET is used up. Whatever a retry saves is kept even if it
+// fails again; only the errors of a program's last attempt are counted.
+func (s *Scheduler) retryFailedPrograms(ctx context.Context, run *scanRun, failed []hackerone.Program) {
+	if len(failed) == 0 {
+		return
+	}
+
+	budget := s.config.ScanRetryBudget
+	if budget > len(failed) {
+		budget = len(failed)
+	}
+	if skipped := len(failed) - budget; skipped > 0 {
+		run.summary.skipRetries(skipped)
+		log.Printf("%d failed programs exceed SCAN_RETRY_BUDGET=%d and are not retried", skipped, s.config.ScanRetryBudget)
+	}
+	if budget == 0 {
+		return
+	}
+
+	log.Printf("Retrying %d failed programs", budget)
+	run.progress.setPhase(PhaseRetrying)
+	backoff := retryBaseBackoff
+	for _, program := range failed[:budget] {
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			run.summary.skipRetries(1)
+			continue
+		}
+		if backoff *= 2; backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+
+		handle := program.Attributes.Handle
+		run.summary.resetProgram(handle)
+		run.progress.startProgram(handle, true)
+		err := s.processProgram(ctx, run, program)
+		run.progress.finishProgram(handle, true)
+		run.summary.addRetry(handle, err)
+		if err != nil {
+			log.Printf("Retry of program %s failed: %v", handle, err)
+		} else {
+			log.Printf("Retry of program %s succeeded", handle)
+		}
+	}
+}
+
+// Pause before each program retry, doubling up to the maximum
+const (
+	retryBaseBackoff = 5 * time.Second
+	retryMaxBackoff  = time.Minute
+)
+
+// finishScan closes the scan summary, logs it, keeps it for the API and
+// records it in the metrics
+func (s *Scheduler) finishScan(run *scanRun, programsTotal int, result string) {
+	run.summary.finish(programsTotal)
+	log.Printf("Scan summary: %s", run.summary)
+
+	s.mu.Lock()
+	s.lastSummary = run.summary
+	s.mu.Unlock()
+
+	summary := run.summary.Snapshot()
+	metrics.ScanFinished(summary.StartedAt, summary.FinishedAt, summary.ErrorCount, result)
+	s.refreshDomainMetrics()
+}
 
+// refreshDomainMetrics sets the domain gauges from the current database stats
+func (s *Scheduler) refreshDomainMetrics() {
+	stats, err := s.db.GetStats()
+	if err != nil {
+		log.Printf("Error loading stats for metrics: %v", err)
+		return
+	}
+	metrics.SetDomainStats(stats)
+}
+
+// publishScanComplete sends the summary of a finished scan to the outputs
+func (s *Scheduler) publishScanComplete(run *scanRun) {
+	summary := run.summary.Snapshot()
+	s.outputs.PublishScanComplete(output.ScanEvent{
+		StartedAt:     summary.StartedAt,
+		FinishedAt:    summary.FinishedAt,
+		ProgramsTotal: summary.ProgramsTotal,
+		ErrorCount:    summary.ErrorCount,
+		Errors:        summary.ErrorsByCategory,
+	})
+}
+
+// pruneCheckHistory drops check history past CHECK_HISTORY_RETENTION and
+// status timeline events past DOMAIN_EVENT_RETENTION
+func (s *Scheduler) pruneCheckHistory() {
+	if s.config.CheckHistoryRetention > 0 {
+		pruned, err := s.db.PruneDomainChecks(s.config.CheckHistoryRetention)
+		if err != nil {
+			log.Printf("Error pruning check history: %v", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d check history rows older than %s", pruned, s.config.CheckHistoryRetention)
+		}
+	}
+	if s.config.DomainEventRetention > 0 {
+		pruned, err := s.db.PruneDomainEvents(s.config.DomainEventRetention)
+		if err != nil {
+			log.Printf("Error pruning domain events: %v", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d domain events older than %s", pruned, s.config.DomainEventRetention)
+		}
+	}
+}
+
+// Events returns the bus carrying new domains, status changes and finished
+// scans as they happen
+func (s *Scheduler) Events() *output.Bus {
+	return s.events
+}
+
+// LastScanSummary returns a snapshot of the most recently finished scan's
+// summary, or nil if no scan has finished yet
+func (s *Scheduler) LastScanSummary() *ScanSummary {
+	s.mu.Lock()
+	summary := s.lastSummary
+	s.mu.Unlock()
+
+	if summary == nil {
+		return nil
+	}
+	return summary.Snapshot()
+}
+
+// skipPausedPrograms drops programs that are not accepting reports. They are
+// still saved so their submission state stays queryable.
+func (s *Scheduler) skipPausedPrograms(ctx context.Context, programs []hackerone.Program) []hackerone.Program {
+	active := make([]hackerone.Program, 0, len(programs))
+	skipped := 0
+	for _, program := range programs {
+		if !strings.EqualFold(program.Attributes.SubmissionState, "paused") {
+			active = append(active, program)
+			continue
+		}
+		skipped++
+		if err := s.saveProgram(ctx, program); err != nil {
+			log.Printf("Error saving program %s: %v", program.Attributes.Handle, err)
+		}
+	}
+	if skipped > 0 {
+		log.Printf("Skipping %d paused programs (set INCLUDE_PAUSED=true to scan them)", skipped)
+	}
+	return active
+}
+
+// saveProgram stores a program with its derived type
+func (s *Scheduler) saveProgram(ctx context.Context, program hackerone.Program) error {
 	// Determine program type (RDP/VDP)
 	programType := "UNKNOWN"
 	submissionState := strings.ToUpper(program.Attributes.SubmissionState)
@@ -91,109 +599,534 @@ func (s *Scheduler) processProgram(ctx context.Context, program hackerone.Progra
 		programType = "VDP" // Otherwise likely VDP
 	}
 
+	if isManualProgram(program) {
+		return s.db.SaveProgram(&database.Program{
+			Name:        program.Attributes.Name,
+			Handle:      program.Attributes.Handle,
+			ProgramType: "UNKNOWN",
+			Source:      database.ProgramSourceManual,
+		})
+	}
+
 	// Save program to database
 	dbProgram := &database.Program{
-		Name:           program.Attributes.Name,
-		Handle:         program.Attributes.Handle,
-		URL:            program.Attributes.URL,
-		Domain:         program.Attributes.Domain,
-		OffersBounties: program.Attributes.OffersBounties,
-		ProgramType:    programType,
-	}
-	if err := s.db.SaveProgram(dbProgram); err != nil {
+		Name:            program.Attributes.Name,
+		Handle:          program.Attributes.Handle,
+		URL:             program.Attributes.URL,
+		APIURL:          program.Attributes.URL,
+		Domain:          program.Attributes.Domain,
+		OffersBounties:  program.Attributes.OffersBounties,
+		ProgramType:     programType,
+		Source:          database.ProgramSourceHackerOne,
+		SubmissionState: program.Attributes.SubmissionState,
+	}
+	if s.config.NormalizeProgramURLs {
+		dbProgram.URL = hackerone.ProgramURL(program.Attributes.Handle, program.Attributes.URL)
+	}
+
+	// Metadata is best effort; the previous values are kept when it fails
+	if s.config.ProgramMetadata {
+		if meta, err := s.hackeroneClient.GetProgramMetadata(ctx, program.Attributes.Handle); err != nil {
+			log.Printf("Error fetching metadata for %s: %v", program.Attributes.Handle, err)
+		} else {
+			dbProgram.BountyMin = meta.BountyMin
+			dbProgram.BountyMax = meta.BountyMax
+			dbProgram.BountyCurrency = meta.Currency
+			dbProgram.ResolvedReports = meta.ResolvedReports
+		}
+	}
+	return s.db.SaveProgram(dbProgram)
+}
+
+func (s *Scheduler) processProgram(ctx context.Context, run *scanRun, program hackerone.Program) (err error) {
+	// Get program scope; manual programs only have imported domains
+	var scopes []hackerone.Scope
+	var scopeErr error
+	if !isManualProgram(program) {
+		scopes, scopeErr = s.programScope(ctx, program.Attributes.Handle, run.force)
+	}
+	if scopeErr == nil && !run.force && s.programFresh(program.Attributes.Handle, scopes) {
+		log.Printf("Skipping program %s: scanned within %s and its scope is unchanged", program.Attributes.Handle, s.config.SkipFreshWithin)
+		return nil
+	}
+
+	log.Printf("Processing program: %s (%s)", program.Attributes.Name, program.Attributes.Handle)
+
+	if err := s.saveProgram(ctx, program); err != nil {
 		log.Printf("Error saving program %s: %v", program.Attributes.Handle, err)
+		run.summary.AddError(program.Attributes.Handle, CategorySave, err)
 		return err
 	}
 
-	// Get program scope
-	scopeDomains, err := s.hackeroneClient.GetProgramScope(program.Attributes.Handle)
-	if err != nil {
-		log.Printf("Error getting scope for %s: %v", program.Attributes.Handle, err)
+	if scopeErr != nil {
+		log.Printf("Error getting scope for %s: %v", program.Attributes.Handle, scopeErr)
+		run.summary.AddError(program.Attributes.Handle, CategoryScope, scopeErr)
+	}
+	// A program counts as scanned once it was processed to the end with its
+	// real scope
+	defer func() {
+		if err == nil && ctx.Err() == nil {
+			s.markProgramScanned(program.Attributes.Handle, scopes)
+		}
+	}()
+
+	// Scope entries are cleaned before discovery so "*.example.com" and
+	// "example.com" are discovered once. Entries not eligible for submission
+	// are out of scope and keep their hosts out of the scan.
+	scopeDomains := make([]string, 0, len(scopes))
+	bountyHosts := make(map[string]bool)
+	seenScope := make(map[string]bool)
+	wildcardHosts := make(map[string]bool)
+	excluded := newExclusions()
+	types := newAssetTypes()
+	for _, scope := range scopes {
+		// CIDR ranges, mobile apps and the like are only catalogued
+		if !scope.IsWeb() {
+			continue
+		}
+		host := cleanDomain(scope.Identifier)
+		if host == "" {
+			log.Printf("Skipping scope entry %q of %s: not a host", scope.Identifier, program.Attributes.Handle)
+			continue
+		}
+		if !scope.EligibleForSubmission && !s.config.ScopeIncludeIneligible {
+			excluded.exclude(scope, host)
+			continue
+		}
+		excluded.include(scope, host)
+		types.add(scope, host)
+		if strings.Contains(scope.Identifier, "*") {
+			wildcardHosts[host] = true
+		}
+		if scope.EligibleForBounty {
+			bountyHosts[host] = true
+		}
+		if !seenScope[host] {
+			seenScope[host] = true
+			scopeDomains = append(scopeDomains, host)
+		}
+	}
+
+	// Imported domains are in scope like explicit scope entries
+	manualHosts := make(map[string]bool)
+	for _, domain := range s.manualDomains(program.Attributes.Handle) {
+		host := cleanDomain(domain)
+		if host == "" {
+			continue
+		}
+		excluded.include(hackerone.Scope{Identifier: domain}, host)
+		manualHosts[host] = true
+		if strings.Contains(domain, "*") {
+			wildcardHosts[host] = true
+		}
+		if !seenScope[host] {
+			seenScope[host] = true
+			scopeDomains = append(scopeDomains, host)
+		}
 	}
 
-	// If no scopes found, try to use program domain
+	// If no scopes found, try to use program domain, unless the program's
+	// scope only lists out-of-scope assets
 	if len(scopeDomains) == 0 {
-		if program.Attributes.Domain != "" {
-			log.Printf("No structured scopes found for %s, using program domain: %s", program.Attributes.Handle, program.Attributes.Domain)
-			scopeDomains = []string{program.Attributes.Domain}
+		if domain := cleanDomain(program.Attributes.Domain); domain != "" && excluded.empty() {
+			log.Printf("No structured scopes found for %s, using program domain: %s", program.Attributes.Handle, domain)
+			scopeDomains = []string{domain}
+			if program.Attributes.OffersBounties {
+				bountyHosts[domain] = true
+			}
 		} else {
 			log.Printf("No domains found for program %s (no scopes and no domain attribute)", program.Attributes.Handle)
-			return nil // Skip this program but don't error
+			return scopeErr // Skip this program; only a failed scope fetch is an error
 		}
 	} else {
 		log.Printf("Found %d scope domains for program %s", len(scopeDomains), program.Attributes.Handle)
 	}
 
-		// Discover subdomains (non-blocking - will use base domains if subfinder fails)
-		log.Printf("Discovering subdomains for %d base domains in program %s...", len(scopeDomains), program.Attributes.Handle)
-		discoveredDomains, err := s.discoveryService.DiscoverDomains(ctx, scopeDomains)
-		if err != nil {
-			log.Printf("Subdomain discovery failed for %s (will use base domains only): %v", program.Attributes.Handle, err)
-			discoveredDomains = []string{} // Use empty, will fall back to base domains
-		}
+		var discoveredDomains []discovery.Subdomain
+		if s.config.ScanMode != config.ScanModePrograms {
+			// Discover subdomains (non-blocking - will use base domains if subfinder fails)
+			log.Printf("Discovering subdomains for %d base domains in program %s...", len(scopeDomains), program.Attributes.Handle)
+			discovered := s.discoveryService.DiscoverDomains(ctx, scopeDomains, wildcardHosts)
+			for _, err := range discovered.Errors {
+				run.summary.AddError(program.Attributes.Handle, CategoryDiscovery, err)
+			}
+			if len(discovered.Errors) > 0 {
+				log.Printf("Subdomain discovery had %d failures for %s (continuing with what was found): %v",
+					len(discovered.Errors), program.Attributes.Handle, discovered.Errors[0])
+			}
+			discoveredDomains = discovered.Subdomains
 
-		if len(discoveredDomains) > 0 {
-			log.Printf("Discovered %d subdomains for program %s", len(discoveredDomains), program.Attributes.Handle)
-		} else {
-			log.Printf("No subdomains discovered for %s, using %d base domain(s)", program.Attributes.Handle, len(scopeDomains))
+			if len(discoveredDomains) > 0 {
+				log.Printf("Discovered %d subdomains for program %s", len(discoveredDomains), program.Attributes.Handle)
+			} else {
+				log.Printf("No subdomains discovered for %s, using %d base domain(s)", program.Attributes.Handle, len(scopeDomains))
+			}
 		}
 
 		// Start with base domains, add discovered subdomains
-		allDomains := make([]string, len(scopeDomains))
-		copy(allDomains, scopeDomains)
+		allDomains := make([]discovery.Subdomain, 0, len(scopeDomains)+len(discoveredDomains))
+		for _, domain := range scopeDomains {
+			source := discovery.SourceScope
+			if manualHosts[domain] {
+				source = database.ProgramSourceManual
+			}
+			allDomains = append(allDomains, discovery.Subdomain{Host: domain, Source: source})
+		}
 		allDomains = append(allDomains, discoveredDomains...)
 
-		// Deduplicate
-		uniqueDomains := make(map[string]bool)
+		// Deduplicate, keeping the first source that found each domain
+		sources := make(map[string]string)
 		var finalDomains []string
+		outOfScope := 0
 		for _, domain := range allDomains {
 			// Clean domain (remove protocol, paths, etc.)
-			cleanDomain := cleanDomain(domain)
-			if cleanDomain != "" && !uniqueDomains[cleanDomain] {
-				uniqueDomains[cleanDomain] = true
+			cleanDomain := cleanDomain(domain.Host)
+			if _, seen := sources[cleanDomain]; cleanDomain != "" && !seen {
+				sources[cleanDomain] = domain.Source
+				if excluded.excluded(cleanDomain) {
+					outOfScope++
+					continue
+				}
 				finalDomains = append(finalDomains, cleanDomain)
 			}
 		}
+		if outOfScope > 0 {
+			log.Printf("Skipped %d out-of-scope domains in program %s", outOfScope, program.Attributes.Handle)
+		}
 
-		// Check health of domains
-		log.Printf("Checking health of %d domains for program %s...", len(finalDomains), program.Attributes.Handle)
-		healthResults := s.healthCheckService.CheckDomains(ctx, finalDomains)
+		meta := func(name string) domainMeta {
+			return domainMeta{
+				BountyEligible: isBountyEligible(name, bountyHosts),
+				AssetType:      types.lookup(name),
+				Source:         sources[name],
+			}
+		}
 
-		// Save domains to database
-		for _, result := range healthResults {
-			domain := &database.Domain{
-				Domain:       result.Domain,
-				Program:      program.Attributes.Handle,
-				Status:       result.Status,
-				DiscoveredAt: time.Now(),
-				LastChecked:  time.Now(),
+		// A fallback to the program domain says nothing about the real count
+		if scopeErr == nil {
+			s.checkDomainSurge(run, program.Attributes.Handle, len(finalDomains))
+		}
+
+		// Lightweight modes record the domains without checking them
+		if s.config.ScanMode != config.ScanModeFull {
+			var events []output.DomainEvent
+			for _, name := range finalDomains {
+				meta := meta(name)
+				domain := &database.Domain{
+					Domain:         name,
+					Program:        program.Attributes.Handle,
+					Status:         "unknown",
+					DiscoveredAt:   time.Now(),
+					BountyEligible: meta.BountyEligible,
+					AssetType:      meta.AssetType,
+					Source:         meta.Source,
+				}
+				if err := s.db.EnsureDomain(domain); err != nil {
+					log.Printf("Error saving domain %s: %v", name, err)
+					run.summary.AddError(program.Attributes.Handle, CategorySave,
+						fmt.Errorf("save %s: %w", name, err))
+					continue
+				}
+				events = append(events, output.DomainEvent{
+					Domain:         domain.Domain,
+					Program:        domain.Program,
+					Status:         domain.Status,
+					Source:         domain.Source,
+					BountyEligible: domain.BountyEligible,
+					New:            domain.IsNew,
+				})
 			}
-			if err := s.db.SaveDomain(domain); err != nil {
-				log.Printf("Error saving domain %s: %v", result.Domain, err)
+			if !run.silent {
+				s.outputs.PublishDomains(events)
 			}
+			run.progress.addDomains(len(finalDomains))
+			log.Printf("Completed processing program %s (%s mode, %d domains recorded)", program.Attributes.Handle, s.config.ScanMode, len(finalDomains))
+			return scopeErr
+		}
+
+		// Hosts without DNS records can't be up; record them as down without
+		// spending an HTTP check on them. Hosts that only resolve to private
+		// addresses are recorded as unreachable_internal.
+		// Results are saved every saveBatchSize domains, so an interrupted
+		// scan keeps its progress and no transaction grows with the program.
+		toCheck := finalDomains
+		var results []healthcheck.CheckResult
+		addResult := func(result healthcheck.CheckResult) {
+			results = append(results, result)
+			if len(results) >= saveBatchSize {
+				s.saveCheckResults(run, program.Attributes.Handle, results, meta)
+				results = nil
+			}
+		}
+		if s.resolver != nil {
+			resolved := s.resolver.ResolveDomains(ctx, finalDomains)
+			toCheck = make([]string, 0, len(finalDomains))
+			internal := 0
+			for _, name := range finalDomains {
+				result, ok := resolved[name]
+				if ok && result.NotFound() {
+					addResult(healthcheck.CheckResult{
+						Domain: name,
+						Status: "down",
+						Reason: healthcheck.ReasonDNS,
+						Error:  result.Err,
+					})
+					continue
+				}
+				// Public names pointing at private addresses are a finding of
+				// their own, but there is nothing to health check
+				if ok && s.config.SkipPrivateIPs && result.Internal() {
+					internal++
+					log.Printf("[INTERNAL IP] %s in program %s resolves to %s", name, program.Attributes.Handle, strings.Join(result.IPs, ", "))
+					addResult(healthcheck.CheckResult{
+						Domain:   name,
+						Status:   database.StatusUnreachableInternal,
+						Resolved: true,
+					})
+					continue
+				}
+				toCheck = append(toCheck, name)
+			}
+			run.progress.addDomains(len(finalDomains) - len(toCheck))
+			if unresolved := len(finalDomains) - len(toCheck) - internal; unresolved > 0 {
+				log.Printf("%d of %d domains in program %s do not resolve", unresolved, len(finalDomains), program.Attributes.Handle)
+			}
+		}
+
+		// Check health of domains
+		log.Printf("Checking health of %d domains for program %s...", len(toCheck), program.Attributes.Handle)
+		checked := 0
+		var up []string
+		for result := range s.healthCheckerFor(program.Attributes.Handle).CheckDomainsStream(ctx, toCheck) {
+			checked++
+			run.progress.addDomains(1)
+			addResult(result)
+			if result.Status == "up" {
+				up = append(up, result.Domain)
+			}
+		}
+		if checked < len(toCheck) {
+			run.summary.AddError(program.Attributes.Handle, CategoryHealth,
+				fmt.Errorf("health checks interrupted after %d of %d domains: %w", checked, len(toCheck), ctx.Err()))
+		}
+		s.saveCheckResults(run, program.Attributes.Handle, results, meta)
+
+		if s.config.EnableEnrichment && len(up) > 0 {
+			s.enrichProgramDomains(ctx, run, program.Attributes.Handle, up)
+		}
+		if s.nuclei != nil && len(up) > 0 {
+			s.scanProgramFindings(ctx, run, program.Attributes.Handle, up)
+		}
+		if s.screenshots != nil && len(up) > 0 {
+			s.captureScreenshots(ctx, run, program.Attributes.Handle, up)
 		}
 
 	log.Printf("Completed processing program %s", program.Attributes.Handle)
-	return nil
+	// The domains of the scope fallback are saved, but the program still
+	// counts as failed so a retry can fetch the real scope
+	return scopeErr
 }
 
-func cleanDomain(domain string) string {
-	// Remove protocol
-	domain = strings.TrimPrefix(domain, "https://")
-	domain = strings.TrimPrefix(domain, "http://")
+// programScope returns a program's scope, served from the scope cache while
+// it is younger than SCOPE_CACHE_TTL. Forced scans always fetch it and
+// refresh the cache. Empty scopes are not cached since the client also
+// returns them when HackerOne couldn't be queried.
+func (s *Scheduler) programScope(ctx context.Context, handle string, force bool) ([]hackerone.Scope, error) {
+	ttl := s.config.ScopeCacheTTL
+	if ttl > 0 && !force {
+		if cached, ok := s.db.GetCachedScope(handle, ttl); ok {
+			var scopes []hackerone.Scope
+			if err := json.Unmarshal(cached, &scopes); err == nil {
+				log.Printf("Using cached scope for %s (%d entries)", handle, len(scopes))
+				return scopes, nil
+			}
+		}
+	}
 
-	// Remove paths
-	if idx := strings.Index(domain, "/"); idx != -1 {
-		domain = domain[:idx]
+	scopes, err := s.hackeroneClient.GetProgramScopeDetailed(ctx, handle)
+	if err != nil || ttl <= 0 || len(scopes) == 0 {
+		return scopes, err
 	}
+	if data, err := json.Marshal(scopes); err == nil {
+		if err := s.db.SaveCachedScope(handle, data); err != nil {
+			log.Printf("Error caching scope for %s: %v", handle, err)
+		}
+	}
+	return scopes, nil
+}
 
-	// Remove ports
-	if idx := strings.Index(domain, ":"); idx != -1 {
-		domain = domain[:idx]
+// checkDomainSurge raises a program_surge alert when a program's domain count
+// grew by more than SURGE_FACTOR since its previous scan, which usually means
+// a new wildcard or a CDN enumeration artifact
+func (s *Scheduler) checkDomainSurge(run *scanRun, handle string, count int) {
+	previous, ok, err := s.db.GetLastProgramDomainCount(handle)
+	if err != nil {
+		log.Printf("Error loading previous domain count for %s: %v", handle, err)
+		return
+	}
+	if err := s.db.RecordProgramDomainCount(handle, count); err != nil {
+		log.Printf("Error recording domain count for %s: %v", handle, err)
 	}
 
-	// Remove wildcards
-	domain = strings.TrimPrefix(domain, "*.")
+	if !ok || previous == 0 || run.silent || s.config.SurgeFactor <= 1 {
+		return
+	}
+	if count-previous < s.config.SurgeMinDomains || float64(count) < float64(previous)*s.config.SurgeFactor {
+		return
+	}
 
-	return strings.TrimSpace(domain)
+	alert := &database.Alert{
+		Type:    database.AlertTypeSurge,
+		Program: handle,
+		Detail:  fmt.Sprintf("domain count grew from %d to %d", previous, count),
+	}
+	if _, err := s.db.SaveAlert(alert); err != nil {
+		log.Printf("Error saving surge alert for %s: %v", handle, err)
+		return
+	}
+	log.Printf("[PROGRAM SURGE] %s: %s", handle, alert.Detail)
+}
+
+// saveBatchSize is how many check results are saved per transaction
+const saveBatchSize = 500
+
+// saveCheckResults stores the current status of a batch of a program's
+// checked domains in one transaction, then appends the results to their
+// check history. Domains that fail to save are logged and skipped.
+func (s *Scheduler) saveCheckResults(run *scanRun, handle string, results []healthcheck.CheckResult, meta func(string) domainMeta) {
+	if len(results) == 0 {
+		return
+	}
+
+	now := time.Now()
+	domains := make([]database.Domain, len(results))
+	for i, result := range results {
+		meta := meta(result.Domain)
+		domains[i] = database.Domain{
+			Domain:         result.Domain,
+			Program:        handle,
+			Status:         result.Status,
+			StatusReason:   result.Reason,
+			StatusCode:     result.StatusCode,
+			FinalURL:       result.FinalURL,
+			OpenPorts:      result.OpenPorts,
+			DiscoveredAt:   now,
+			LastChecked:    now,
+			BountyEligible: meta.BountyEligible,
+			AssetType:      meta.AssetType,
+			Source:         meta.Source,
+			CertValid:      result.CertValid,
+			CertError:      result.CertError,
+		}
+	}
+	changes, skipped, err := s.db.SaveDomains(domains)
+	if err != nil {
+		log.Printf("Error saving %d domains of %s: %v", len(domains), handle, err)
+		run.summary.AddError(handle, CategorySave, err)
+		return
+	}
+
+	checks := make([]database.DomainCheck, 0, len(domains))
+	events := make([]output.DomainEvent, 0, len(domains))
+	for i, domain := range domains {
+		if err, ok := skipped[i]; ok {
+			log.Printf("Error saving domain of %s: %v", handle, err)
+			run.summary.AddError(handle, CategorySave, err)
+			continue
+		}
+		events = append(events, output.DomainEvent{
+			Domain:         domain.Domain,
+			Program:        handle,
+			Status:         domain.Status,
+			StatusCode:     domain.StatusCode,
+			Source:         domain.Source,
+			BountyEligible: domain.BountyEligible,
+			New:            domain.IsNew,
+			CheckedAt:      domain.LastChecked,
+		})
+		checks = append(checks, database.DomainCheck{
+			Domain:       domain.Domain,
+			Program:      handle,
+			Status:       domain.Status,
+			StatusReason: domain.StatusReason,
+			StatusCode:   domain.StatusCode,
+			CheckedAt:    domain.LastChecked,
+		})
+	}
+
+	metrics.AddStatusChanges(len(changes))
+	if run.silent {
+		// Only this scan's changes are cleared; watches running alongside
+		// the first scan still notify theirs
+		for _, change := range changes {
+			if err := s.db.MarkStatusChangeNotified(change.ID); err != nil {
+				log.Printf("Error clearing status change %d of silent scan: %v", change.ID, err)
+			}
+		}
+	} else {
+		s.outputs.PublishDomains(events)
+		for _, change := range changes {
+			s.outputs.PublishStatusChange(output.StatusChangeEvent{
+				ID:        change.ID,
+				Domain:    change.Domain,
+				Program:   change.Program,
+				OldStatus: change.OldStatus,
+				NewStatus: change.NewStatus,
+				ChangedAt: change.ChangedAt,
+			})
+		}
+	}
+
+	if err := s.db.SaveDomainChecks(checks); err != nil {
+		run.summary.AddError(handle, CategorySave, err)
+	}
+}
+
+// healthCheckerFor returns the health check service configured for a program
+func (s *Scheduler) healthCheckerFor(handle string) *healthcheck.Service {
+	checker := s.healthCheckService
+	if probe, ok := s.probes[handle]; ok {
+		checker = checker.WithProbe(probe)
+	}
+	if timeout, ok := s.timeouts[handle]; ok {
+		checker = checker.WithTimeout(timeout)
+	}
+	return checker
+}
+
+// isBountyEligible reports whether a domain is, or is a subdomain of, one of
+// the bounty eligible scope hosts
+func isBountyEligible(domain string, bountyHosts map[string]bool) bool {
+	for host := domain; host != ""; {
+		if bountyHosts[host] {
+			return true
+		}
+		idx := strings.Index(host, ".")
+		if idx == -1 {
+			break
+		}
+		host = host[idx+1:]
+	}
+	return false
+}
+
+// cleanDomain turns a scope entry or discovered name into the host that is
+// stored and checked, or "" if it doesn't name a host
+func cleanDomain(domain string) string {
+	// CIDR ranges are scope too, but not hosts
+	if _, _, err := net.ParseCIDR(strings.TrimSpace(domain)); err == nil {
+		return ""
+	}
+
+	// Remove protocol, paths and ports, and canonicalize case and IDN labels
+	domain = domainutil.Normalize(domain)
+
+	// Remove wildcards, including multi-level ones like *.*.example.com
+	domain = domainutil.StripWildcards(domain)
+
+	// Whatever is left must be a usable host, e.g. "*.example.*" is not
+	if !domainutil.IsValidHost(domain) {
+		return ""
+	}
+	return domain
 }
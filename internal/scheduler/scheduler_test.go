@@ -0,0 +1,262 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"watchtower/internal/config"
+	"watchtower/internal/database"
+	"watchtower/internal/enrichment"
+	"watchtower/internal/hackerone"
+	"watchtower/internal/healthcheck"
+	"watchtower/internal/output"
+)
+
+func TestCleanDomain(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"*.example.com", "example.com"},
+		{"*.*.example.com", "example.com"},
+		{"https://*.foo.com/path", "foo.com"},
+		{"https://*.foo.com/path?q=1#top", "foo.com"},
+		{"api.example.com:8443", "api.example.com"},
+		{"http://api.example.com:8080/v1", "api.example.com"},
+		{"API.Example.COM", "api.example.com"},
+		{"  *.Example.com.  ", "example.com"},
+		{"10.0.0.0/8", ""},
+		{"*.example.*", ""},
+		{"*", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := cleanDomain(tt.in); got != tt.want {
+			t.Errorf("cleanDomain(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestForEachProgramHonorsLimit(t *testing.T) {
+	programs := make([]hackerone.Program, 40)
+	for i := range programs {
+		programs[i].Attributes.Handle = fmt.Sprintf("program-%d", i)
+	}
+
+	for _, tt := range []struct {
+		limit int
+		ramp  time.Duration
+	}{
+		{limit: 1},
+		{limit: 3},
+		{limit: 8},
+		{limit: 4, ramp: 20 * time.Millisecond},
+	} {
+		t.Run(fmt.Sprintf("limit %d ramp %s", tt.limit, tt.ramp), func(t *testing.T) {
+			var mu sync.Mutex
+			inFlight, peak := 0, 0
+			done := make(map[string]bool)
+
+			forEachProgram(context.Background(), programs, tt.limit, tt.ramp, func(p hackerone.Program) {
+				mu.Lock()
+				inFlight++
+				if inFlight > peak {
+					peak = inFlight
+				}
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				mu.Lock()
+				inFlight--
+				done[p.Attributes.Handle] = true
+				mu.Unlock()
+			})
+
+			if peak > tt.limit {
+				t.Errorf("%d programs ran at once, limit is %d", peak, tt.limit)
+			}
+			if peak < tt.limit {
+				t.Errorf("at most %d programs ran at once, expected the limit of %d to be reached", peak, tt.limit)
+			}
+			if len(done) != len(programs) {
+				t.Errorf("%d of %d programs were processed", len(done), len(programs))
+			}
+		})
+	}
+}
+
+func TestForEachProgramSkipsAfterCancel(t *testing.T) {
+	programs := make([]hackerone.Program, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var mu sync.Mutex
+	ran := 0
+	forEachProgram(ctx, programs, 2, 0, func(hackerone.Program) {
+		mu.Lock()
+		ran++
+		mu.Unlock()
+	})
+	if ran > 0 {
+		t.Errorf("%d programs started after cancellation", ran)
+	}
+}
+
+func TestSaveCheckResultsSilent(t *testing.T) {
+	tests := []struct {
+		name   string
+		silent bool
+		want   []string
+	}{
+		{name: "silent scan clears only its own changes", silent: true, want: []string{"watched.example.com"}},
+		{name: "normal scan", silent: false, want: []string{"watched.example.com", "scanned.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			defer db.Close()
+
+			// A watch records a change while the first scan runs
+			for _, status := range []string{"up", "down"} {
+				if _, err := db.SaveDomain(&database.Domain{Domain: "watched.example.com", Program: "w", Status: status, DiscoveredAt: time.Now()}); err != nil {
+					t.Fatalf("SaveDomain: %v", err)
+				}
+			}
+			if _, err := db.SaveDomain(&database.Domain{Domain: "scanned.example.com", Program: "p", Status: "up", DiscoveredAt: time.Now()}); err != nil {
+				t.Fatalf("SaveDomain: %v", err)
+			}
+
+			s := &Scheduler{db: db, outputs: output.NewFanout()}
+			run := &scanRun{summary: newScanSummary(), silent: tt.silent}
+			results := []healthcheck.CheckResult{{Domain: "scanned.example.com", Status: "down"}}
+			s.saveCheckResults(run, "p", results, func(string) domainMeta { return domainMeta{} })
+
+			changes, err := db.GetUnnotifiedStatusChanges(10)
+			if err != nil {
+				t.Fatalf("GetUnnotifiedStatusChanges: %v", err)
+			}
+			var got []string
+			for _, change := range changes {
+				got = append(got, change.Domain)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("unnotified changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTechAlertsSilent(t *testing.T) {
+	tests := []struct {
+		name   string
+		silent bool
+		want   int
+	}{
+		{name: "silent scan", silent: true, want: 0},
+		{name: "normal scan", silent: false, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			defer db.Close()
+
+			s := &Scheduler{db: db, alertTechs: map[string]bool{"jenkins": true}}
+			s.checkTechAlerts("p", &enrichment.DomainDetails{Domain: "ci.example.com", Technologies: []string{"Jenkins:2.401"}}, tt.silent)
+
+			alerts, err := db.GetUnnotifiedAlerts(10)
+			if err != nil {
+				t.Fatalf("GetUnnotifiedAlerts: %v", err)
+			}
+			if len(alerts) != tt.want {
+				t.Errorf("%d unnotified alerts, want %d", len(alerts), tt.want)
+			}
+		})
+	}
+}
+
+func TestProgramScopeCache(t *testing.T) {
+	db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer db.Close()
+	if err := db.SaveCachedScope("p", []byte(`[{"identifier":"cached.example.com"}]`)); err != nil {
+		t.Fatalf("SaveCachedScope: %v", err)
+	}
+
+	s := &Scheduler{
+		db:              db,
+		config:          &config.Config{ScopeCacheTTL: time.Hour},
+		hackeroneClient: hackerone.NewClient(""),
+	}
+	// HackerOne can't be reached, so only the cache can return a scope
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		force      bool
+		wantCached bool
+	}{
+		{name: "regular scan uses the cache", force: false, wantCached: true},
+		{name: "forced scan fetches the scope", force: true, wantCached: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, _ := s.programScope(ctx, "p", tt.force)
+			cached := len(scopes) == 1 && scopes[0].Identifier == "cached.example.com"
+			if cached != tt.wantCached {
+				t.Errorf("scopes = %v, want cached %v", scopes, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestScanRefusedWhileRunning(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(s *Scheduler) error
+	}{
+		{"RunScan", func(s *Scheduler) error { return s.RunScan(context.Background()) }},
+		{"StartScan", func(s *Scheduler) error {
+			_, err := s.StartScan(false)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scheduler{scanning: 1}
+			if err := tt.start(s); !errors.Is(err, ErrScanRunning) {
+				t.Errorf("err = %v, want ErrScanRunning", err)
+			}
+			if s.scanning != 1 {
+				t.Errorf("scanning = %d, want 1", s.scanning)
+			}
+		})
+	}
+}
+
+func TestEnrichWithoutHTTPX(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	s := &Scheduler{enrichmentService: enrichment.NewService(1)}
+	run := &scanRun{summary: newScanSummary()}
+
+	s.enrichProgramDomains(context.Background(), run, "p", []string{"a.example.com", "b.example.com"})
+	if got := run.summary.Snapshot().ErrorCount; got != 0 {
+		t.Errorf("%d errors recorded, want none", got)
+	}
+}
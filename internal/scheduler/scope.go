@@ -0,0 +1,198 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"watchtower/internal/database"
+	"watchtower/internal/hackerone"
+)
+
+// exclusions holds the out-of-scope entries of a program, i.e. the assets
+// HackerOne marks as not eligible for submission. Hosts listed explicitly in
+// scope are never excluded, so "*.example.com" out of scope still allows an
+// in-scope "www.example.com".
+type exclusions struct {
+	hosts     map[string]bool // excluded hosts
+	wildcards map[string]bool // excluded hosts including their subdomains
+	explicit  map[string]bool // hosts listed in scope without a wildcard
+}
+
+func newExclusions() *exclusions {
+	return &exclusions{
+		hosts:     make(map[string]bool),
+		wildcards: make(map[string]bool),
+		explicit:  make(map[string]bool),
+	}
+}
+
+// exclude records an out-of-scope entry cleaned to host
+func (e *exclusions) exclude(scope hackerone.Scope, host string) {
+	if strings.Contains(scope.Identifier, "*") {
+		e.wildcards[host] = true
+	} else {
+		e.hosts[host] = true
+	}
+}
+
+// include records an in-scope entry cleaned to host
+func (e *exclusions) include(scope hackerone.Scope, host string) {
+	if !strings.Contains(scope.Identifier, "*") {
+		e.explicit[host] = true
+	}
+}
+
+func (e *exclusions) empty() bool {
+	return len(e.hosts) == 0 && len(e.wildcards) == 0
+}
+
+// excluded reports whether a host falls under an out-of-scope entry
+func (e *exclusions) excluded(host string) bool {
+	if e.explicit[host] {
+		return false
+	}
+	if e.hosts[host] {
+		return true
+	}
+	for parent := host; parent != ""; {
+		if e.wildcards[parent] {
+			return true
+		}
+		idx := strings.Index(parent, ".")
+		if idx == -1 {
+			break
+		}
+		parent = parent[idx+1:]
+	}
+	return false
+}
+
+// domainMeta is what a stored domain inherits from the scope and discovery
+type domainMeta struct {
+	BountyEligible bool
+	AssetType      string
+	Source         string
+}
+
+// assetTypes maps the hosts of in-scope entries to their HackerOne asset
+// type. Wildcard entries are kept apart so "example.com" listed as a URL and
+// "*.example.com" as a WILDCARD both keep their type.
+type assetTypes struct {
+	exact     map[string]string
+	wildcards map[string]string
+}
+
+func newAssetTypes() *assetTypes {
+	return &assetTypes{
+		exact:     make(map[string]string),
+		wildcards: make(map[string]string),
+	}
+}
+
+// add records an in-scope entry cleaned to host
+func (a *assetTypes) add(scope hackerone.Scope, host string) {
+	if strings.Contains(scope.Identifier, "*") {
+		a.wildcards[host] = scope.AssetType
+	} else if _, ok := a.exact[host]; !ok {
+		a.exact[host] = scope.AssetType
+	}
+}
+
+// lookup returns the asset type of the closest scope entry a domain falls
+// under, or "" if none does
+func (a *assetTypes) lookup(domain string) string {
+	if assetType, ok := a.exact[domain]; ok {
+		return assetType
+	}
+	for host := domain; host != ""; {
+		if assetType, ok := a.wildcards[host]; ok {
+			return assetType
+		}
+		if assetType, ok := a.exact[host]; ok {
+			return assetType
+		}
+		idx := strings.Index(host, ".")
+		if idx == -1 {
+			break
+		}
+		host = host[idx+1:]
+	}
+	return ""
+}
+
+// programFresh reports whether a program was completely scanned within
+// SKIP_FRESH_WITHIN and its scope didn't change since
+func (s *Scheduler) programFresh(handle string, scopes []hackerone.Scope) bool {
+	if s.config.SkipFreshWithin <= 0 || len(scopes) == 0 {
+		return false
+	}
+	lastScanned, ok, err := s.db.GetProgramLastScanned(handle)
+	if err != nil {
+		log.Printf("Error loading last scan of %s: %v", handle, err)
+		return false
+	}
+	if !ok || time.Since(lastScanned) > s.config.SkipFreshWithin {
+		return false
+	}
+	stored, err := s.db.GetScopeAssets(handle, "")
+	if err != nil {
+		log.Printf("Error loading stored scope of %s: %v", handle, err)
+		return false
+	}
+	return sameScope(scopes, stored)
+}
+
+// sameScope compares a fetched scope with the one stored at the last scan,
+// ignoring order and instructions
+func sameScope(scopes []hackerone.Scope, stored []database.ScopeAsset) bool {
+	if len(scopes) != len(stored) {
+		return false
+	}
+	key := func(identifier, assetType string, bounty, submission bool) string {
+		return fmt.Sprintf("%s|%s|%t|%t", assetType, identifier, bounty, submission)
+	}
+	seen := make(map[string]int, len(stored))
+	for _, asset := range stored {
+		seen[key(asset.Identifier, asset.AssetType, asset.EligibleForBounty, asset.EligibleForSubmission)]++
+	}
+	for _, scope := range scopes {
+		k := key(scope.Identifier, scope.AssetType, scope.EligibleForBounty, scope.EligibleForSubmission)
+		if seen[k] == 0 {
+			return false
+		}
+		seen[k]--
+	}
+	return true
+}
+
+// markProgramScanned records the end of a complete program scan together
+// with the scope it used, which the next scan compares against
+func (s *Scheduler) markProgramScanned(handle string, scopes []hackerone.Scope) {
+	if len(scopes) > 0 {
+		s.saveScopeAssets(handle, scopes)
+	}
+	if err := s.db.MarkProgramScanned(handle, time.Now()); err != nil {
+		log.Printf("Error recording scan time of %s: %v", handle, err)
+	}
+}
+
+// saveScopeAssets catalogues the full scope of a program, including the
+// asset types that never reach the domain pipeline
+func (s *Scheduler) saveScopeAssets(handle string, scopes []hackerone.Scope) {
+	assets := make([]database.ScopeAsset, 0, len(scopes))
+	for _, scope := range scopes {
+		assets = append(assets, database.ScopeAsset{
+			Identifier:            scope.Identifier,
+			AssetType:             scope.AssetType,
+			EligibleForBounty:     scope.EligibleForBounty,
+			EligibleForSubmission: scope.EligibleForSubmission,
+			Instruction:           scope.Instruction,
+			MaxSeverity:           scope.MaxSeverity,
+		})
+	}
+	if err := s.db.SaveScopeAssets(handle, assets); err != nil {
+		log.Printf("Error saving scope assets of %s: %v", handle, err)
+	}
+}
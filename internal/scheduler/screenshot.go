@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"watchtower/internal/database"
+)
+
+// captureScreenshots screenshots the live domains of a program and records
+// where the images are stored
+func (s *Scheduler) captureScreenshots(ctx context.Context, run *scanRun, handle string, domains []string) {
+	log.Printf("Taking screenshots of %d live domains for program %s...", len(domains), handle)
+	results := s.screenshots.CaptureDomains(ctx, domains)
+
+	captured := 0
+	for _, domain := range domains {
+		result, ok := results[domain]
+		if !ok {
+			continue
+		}
+		if result.Err != nil {
+			run.summary.AddError(handle, CategoryScreenshot, fmt.Errorf("screenshot %s: %w", domain, result.Err))
+			continue
+		}
+		shot := &database.Screenshot{Domain: domain, Program: handle, Path: result.Path, CapturedAt: time.Now()}
+		if err := s.db.SaveScreenshot(shot); err != nil {
+			run.summary.AddError(handle, CategorySave, fmt.Errorf("save screenshot %s: %w", domain, err))
+			continue
+		}
+		captured++
+	}
+	log.Printf("Took %d of %d screenshots for program %s", captured, len(domains), handle)
+}
@@ -0,0 +1,251 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"watchtower/internal/subprocess"
+)
+
+// Error categories recorded in a scan summary
+const (
+	CategoryScope      = "scope"
+	CategoryDiscovery  = "discovery"
+	CategoryHealth     = "health"
+	CategorySave       = "save"
+	CategoryEnrich     = "enrichment"
+	CategoryNuclei     = "nuclei"
+	CategoryScreenshot = "screenshot"
+)
+
+// maxScanErrors bounds how many individual errors a summary keeps; counts
+// keep growing past it so the totals stay accurate.
+const maxScanErrors = 200
+
+type ScanError struct {
+	Program  string    `json:"program"`
+	Category string    `json:"category"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+	// Tool is set when an external tool failed, e.g. subfinder
+	Tool *subprocess.Error `json:"tool,omitempty"`
+}
+
+// ProgramRetry is the outcome of retrying a program that failed in the main
+// pass of a scan
+type ProgramRetry struct {
+	Program   string `json:"program"`
+	Succeeded bool   `json:"succeeded"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ScanSummary aggregates the errors of a single scan. It is safe for
+// concurrent use by the program goroutines.
+type ScanSummary struct {
+	mu sync.Mutex
+
+	StartedAt          time.Time      `json:"started_at"`
+	FinishedAt         time.Time      `json:"finished_at"`
+	ProgramsTotal      int            `json:"programs_total"`
+	ErrorCount         int            `json:"error_count"`
+	ErrorsByCategory   map[string]int `json:"errors_by_category"`
+	ErrorsByTool       map[string]int `json:"errors_by_tool"`
+	ProgramsWithErrors int            `json:"programs_with_errors"`
+	Errors             []ScanError    `json:"errors"`
+	Truncated          bool           `json:"truncated"`
+	Retries            []ProgramRetry `json:"retries"`
+	RetriesSkipped     int            `json:"retries_skipped"`
+
+	failedPrograms map[string]*programErrors
+}
+
+// programErrors counts the errors of one program, so they can be dropped
+// when the program is retried
+type programErrors struct {
+	count      int
+	byCategory map[string]int
+	byTool     map[string]int
+}
+
+func newScanSummary() *ScanSummary {
+	return &ScanSummary{
+		StartedAt:        time.Now(),
+		ErrorsByCategory: make(map[string]int),
+		ErrorsByTool:     make(map[string]int),
+		Errors:           []ScanError{},
+		Retries:          []ProgramRetry{},
+		failedPrograms:   make(map[string]*programErrors),
+	}
+}
+
+// AddError records an error for a program under the given category
+func (s *ScanSummary) AddError(program, category string, err error) {
+	if err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := s.failedPrograms[program]
+	if counts == nil {
+		counts = &programErrors{byCategory: make(map[string]int), byTool: make(map[string]int)}
+		s.failedPrograms[program] = counts
+		s.ProgramsWithErrors++
+	}
+	s.ErrorCount++
+	counts.count++
+	s.ErrorsByCategory[category]++
+	counts.byCategory[category]++
+	var toolErr *subprocess.Error
+	if errors.As(err, &toolErr) {
+		s.ErrorsByTool[toolErr.Tool]++
+		counts.byTool[toolErr.Tool]++
+	}
+
+	if len(s.Errors) >= maxScanErrors {
+		s.Truncated = true
+		return
+	}
+	scanErr := ScanError{
+		Program:  program,
+		Category: category,
+		Message:  err.Error(),
+		Time:     time.Now(),
+		Tool:     toolErr,
+	}
+	s.Errors = append(s.Errors, scanErr)
+}
+
+// resetProgram drops the errors recorded for a program before it is
+// retried, so only its final attempt counts
+func (s *ScanSummary) resetProgram(program string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := s.failedPrograms[program]
+	if counts == nil {
+		return
+	}
+	s.ErrorCount -= counts.count
+	for category, n := range counts.byCategory {
+		if s.ErrorsByCategory[category] -= n; s.ErrorsByCategory[category] <= 0 {
+			delete(s.ErrorsByCategory, category)
+		}
+	}
+	for tool, n := range counts.byTool {
+		if s.ErrorsByTool[tool] -= n; s.ErrorsByTool[tool] <= 0 {
+			delete(s.ErrorsByTool, tool)
+		}
+	}
+	delete(s.failedPrograms, program)
+	s.ProgramsWithErrors--
+
+	kept := make([]ScanError, 0, len(s.Errors))
+	for _, scanErr := range s.Errors {
+		if scanErr.Program != program {
+			kept = append(kept, scanErr)
+		}
+	}
+	s.Errors = kept
+}
+
+// addRetry records the outcome of a program retry
+func (s *ScanSummary) addRetry(program string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	retry := ProgramRetry{Program: program, Succeeded: err == nil}
+	if err != nil {
+		retry.Error = err.Error()
+	}
+	s.Retries = append(s.Retries, retry)
+}
+
+// skipRetries counts failed programs that were not retried
+func (s *ScanSummary) skipRetries(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.RetriesSkipped += n
+}
+
+func (s *ScanSummary) finish(programsTotal int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ProgramsTotal = programsTotal
+	s.FinishedAt = time.Now()
+}
+
+// Snapshot returns a copy of the summary that can be read without locking
+func (s *ScanSummary) Snapshot() *ScanSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byCategory := make(map[string]int, len(s.ErrorsByCategory))
+	for k, v := range s.ErrorsByCategory {
+		byCategory[k] = v
+	}
+	byTool := make(map[string]int, len(s.ErrorsByTool))
+	for k, v := range s.ErrorsByTool {
+		byTool[k] = v
+	}
+	return &ScanSummary{
+		StartedAt:          s.StartedAt,
+		FinishedAt:         s.FinishedAt,
+		ProgramsTotal:      s.ProgramsTotal,
+		ErrorCount:         s.ErrorCount,
+		ErrorsByCategory:   byCategory,
+		ErrorsByTool:       byTool,
+		ProgramsWithErrors: s.ProgramsWithErrors,
+		Errors:             append([]ScanError(nil), s.Errors...),
+		Truncated:          s.Truncated,
+		Retries:            append([]ProgramRetry{}, s.Retries...),
+		RetriesSkipped:     s.RetriesSkipped,
+	}
+}
+
+// String renders a one-line summary suitable for logging
+func (s *ScanSummary) String() string {
+	snap := s.Snapshot()
+	if snap.ErrorCount == 0 {
+		return fmt.Sprintf("no errors across %d programs", snap.ProgramsTotal)
+	}
+
+	summary := fmt.Sprintf("%d errors across %d of %d programs (%s)",
+		snap.ErrorCount, snap.ProgramsWithErrors, snap.ProgramsTotal, formatCounts(snap.ErrorsByCategory))
+	if len(snap.ErrorsByTool) > 0 {
+		summary += fmt.Sprintf(", tool failures (%s)", formatCounts(snap.ErrorsByTool))
+	}
+	if len(snap.Retries) > 0 || snap.RetriesSkipped > 0 {
+		recovered := 0
+		for _, retry := range snap.Retries {
+			if retry.Succeeded {
+				recovered++
+			}
+		}
+		summary += fmt.Sprintf(", %d of %d retried programs recovered", recovered, len(snap.Retries))
+		if snap.RetriesSkipped > 0 {
+			summary += fmt.Sprintf(" (%d not retried)", snap.RetriesSkipped)
+		}
+	}
+	return summary
+}
+
+// formatCounts renders counts as "key=n" pairs in key order
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", key, counts[key]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"watchtower/internal/subprocess"
+)
+
+func TestScanSummaryResetProgram(t *testing.T) {
+	toolErr := &subprocess.Error{Tool: "subfinder", ExitCode: 1}
+
+	tests := []struct {
+		name         string
+		retryErr     error // nil when the retry succeeds
+		wantErrors   int
+		wantPrograms int
+		wantCategory string
+		wantTools    string
+	}{
+		{
+			name:         "retry succeeds",
+			wantErrors:   1,
+			wantPrograms: 1,
+			wantCategory: "map[health:1]",
+			wantTools:    "map[]",
+		},
+		{
+			name:         "retry fails again",
+			retryErr:     errors.New("scope unavailable"),
+			wantErrors:   2,
+			wantPrograms: 2,
+			wantCategory: "map[health:1 scope:1]",
+			wantTools:    "map[]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := newScanSummary()
+			summary.AddError("retried", CategoryScope, errors.New("timeout"))
+			summary.AddError("retried", CategoryDiscovery, fmt.Errorf("discover: %w", toolErr))
+			summary.AddError("other", CategoryHealth, errors.New("refused"))
+
+			summary.resetProgram("retried")
+			summary.AddError("retried", CategoryScope, tt.retryErr)
+
+			snap := summary.Snapshot()
+			if snap.ErrorCount != tt.wantErrors || len(snap.Errors) != tt.wantErrors {
+				t.Errorf("%d errors (%d listed), want %d", snap.ErrorCount, len(snap.Errors), tt.wantErrors)
+			}
+			if snap.ProgramsWithErrors != tt.wantPrograms {
+				t.Errorf("%d programs with errors, want %d", snap.ProgramsWithErrors, tt.wantPrograms)
+			}
+			if got := fmt.Sprint(snap.ErrorsByCategory); got != tt.wantCategory {
+				t.Errorf("by category %s, want %s", got, tt.wantCategory)
+			}
+			if got := fmt.Sprint(snap.ErrorsByTool); got != tt.wantTools {
+				t.Errorf("by tool %s, want %s", got, tt.wantTools)
+			}
+		})
+	}
+}
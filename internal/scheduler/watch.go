@@ -0,0 +1,229 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"watchtower/internal/hackerone"
+)
+
+// hardMinWatchInterval is the floor below which watch requests are rejected
+// outright; between it and WATCH_MIN_INTERVAL they are clamped. Both keep a
+// watch from hammering the HackerOne API and the program's hosts.
+const hardMinWatchInterval = 10 * time.Second
+
+// Watch errors returned to callers of Watch and Unwatch
+var (
+	ErrAlreadyWatching = fmt.Errorf("program is already watched")
+	ErrNotWatching     = fmt.Errorf("program is not watched")
+	ErrWatchLimit      = fmt.Errorf("too many watched programs")
+)
+
+// WatchState describes a program under high-frequency watch
+type WatchState struct {
+	Handle    string    `json:"handle"`
+	Interval  string    `json:"interval"`
+	StartedAt time.Time `json:"started_at"`
+	LastRun   time.Time `json:"last_run"`
+	Runs      int       `json:"runs"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// watch is a running watch; its fields are guarded by Scheduler.mu
+type watch struct {
+	state  WatchState
+	cancel context.CancelFunc
+}
+
+// ScanProgram runs a full scan pipeline for a single program, even if it is
+// fresh. The summary is returned along with an error if the program failed or
+// ctx was cancelled.
+func (s *Scheduler) ScanProgram(ctx context.Context, handle string) (*ScanSummary, error) {
+	program, err := s.fetchProgram(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := newScanSummary()
+	return summary, s.scanProgram(ctx, summary, *program)
+}
+
+// fetchProgram fetches a program from HackerOne, falling back to a manual
+// program for handles HackerOne doesn't know but that have imported domains
+func (s *Scheduler) fetchProgram(ctx context.Context, handle string) (*hackerone.Program, error) {
+	program, err := s.hackeroneClient.GetProgram(ctx, handle)
+	if errors.Is(err, hackerone.ErrProgramNotFound) && len(s.manualDomains(handle)) > 0 {
+		manual := manualProgram(handle)
+		program, err = &manual, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch program %s: %w", handle, err)
+	}
+	return program, nil
+}
+
+// scanProgram processes one program into summary. The errors of the program
+// are recorded in summary; the returned error also covers cancellation.
+func (s *Scheduler) scanProgram(ctx context.Context, summary *ScanSummary, program hackerone.Program) error {
+	run := &scanRun{summary: summary, force: true}
+	err := s.processProgram(ctx, run, program)
+	if err == nil {
+		err = ctx.Err()
+	}
+	summary.finish(1)
+	if err != nil {
+		return fmt.Errorf("scan of %s failed: %w", program.Attributes.Handle, err)
+	}
+	return nil
+}
+
+// Watch starts scanning a single program every interval, independent of the
+// periodic full scan. A zero interval uses WATCH_INTERVAL; intervals below
+// WATCH_MIN_INTERVAL are raised to it.
+func (s *Scheduler) Watch(handle string, interval time.Duration) (WatchState, error) {
+	if interval == 0 {
+		interval = s.config.WatchInterval
+	}
+	if interval < hardMinWatchInterval {
+		return WatchState{}, fmt.Errorf("watch interval %s is below the hard minimum of %s", interval, hardMinWatchInterval)
+	}
+
+	floor := s.config.WatchMinInterval
+	if floor < hardMinWatchInterval {
+		floor = hardMinWatchInterval
+	}
+	if interval < floor {
+		log.Printf("Watch interval %s for %s is below WATCH_MIN_INTERVAL, using %s", interval, handle, floor)
+		interval = floor
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.watches[handle]; ok {
+		return WatchState{}, ErrAlreadyWatching
+	}
+	if len(s.watches) >= s.config.WatchMaxPrograms {
+		return WatchState{}, fmt.Errorf("%w (max %d)", ErrWatchLimit, s.config.WatchMaxPrograms)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watch{
+		state: WatchState{
+			Handle:    handle,
+			Interval:  interval.String(),
+			StartedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+	s.watches[handle] = w
+
+	s.active.Add(1)
+	go s.runWatch(ctx, w, interval)
+
+	log.Printf("Watching program %s every %s (effective interval)", handle, interval)
+	return w.state, nil
+}
+
+// Unwatch stops watching a program
+func (s *Scheduler) Unwatch(handle string) error {
+	s.mu.Lock()
+	w, ok := s.watches[handle]
+	if ok {
+		delete(s.watches, handle)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrNotWatching
+	}
+	w.cancel()
+	log.Printf("Stopped watching program %s", handle)
+	return nil
+}
+
+// Watches returns the watched programs ordered by handle
+func (s *Scheduler) Watches() []WatchState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]WatchState, 0, len(s.watches))
+	for _, w := range s.watches {
+		states = append(states, w.state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Handle < states[j].Handle
+	})
+	return states
+}
+
+// runWatch scans the program right away and then on every tick until the
+// watch is cancelled. A tick that fires during a slow scan is dropped.
+func (s *Scheduler) runWatch(ctx context.Context, w *watch, interval time.Duration) {
+	defer s.active.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.watchScan(ctx, w)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) watchScan(ctx context.Context, w *watch) {
+	handle := w.state.Handle
+	started := time.Now()
+
+	scanCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+	defer cancel()
+
+	summary, err := s.ScanProgram(scanCtx, handle)
+	if err == nil && summary.ErrorCount > 0 {
+		err = fmt.Errorf("scan finished with %s", summary)
+	}
+	if err != nil {
+		log.Printf("Watch scan of %s: %v", handle, err)
+	}
+
+	s.mu.Lock()
+	w.state.LastRun = started
+	w.state.Runs++
+	w.state.LastError = ""
+	if err != nil {
+		w.state.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	s.reportWatchChanges(handle, started)
+	s.refreshDomainMetrics()
+	s.notifyStatusChanges()
+	s.notifyAlerts()
+	s.notifyNewDomains(started, false)
+}
+
+// reportWatchChanges surfaces the status changes of a watch scan right away
+// instead of waiting for the next full scan
+func (s *Scheduler) reportWatchChanges(handle string, since time.Time) {
+	changes, err := s.db.GetStatusChangesSince(since)
+	if err != nil {
+		log.Printf("Error loading status changes of watch scan %s: %v", handle, err)
+		return
+	}
+
+	for _, change := range changes {
+		if change.Program != handle {
+			continue
+		}
+		log.Printf("[WATCH] %s (%s) changed from %s to %s",
+			change.Domain, change.Program, change.OldStatus, change.NewStatus)
+	}
+}
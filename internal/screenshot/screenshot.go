@@ -0,0 +1,141 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"watchtower/internal/domainutil"
+	"watchtower/internal/subprocess"
+)
+
+// captureTimeout bounds a single gowitness run
+const captureTimeout = 60 * time.Second
+
+// Service takes screenshots of hosts with gowitness, which drives headless
+// Chrome. The concurrency limit is shared by all callers since every capture
+// starts a browser.
+type Service struct {
+	dir       string
+	semaphore chan struct{}
+}
+
+// NewService stores screenshots in dir, taking at most concurrency at once
+func NewService(dir string, concurrency int) *Service {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Service{dir: dir, semaphore: make(chan struct{}, concurrency)}
+}
+
+// Result is the outcome of capturing one domain: the image path or the error
+// that prevented it
+type Result struct {
+	Path string
+	Err  error
+}
+
+// Capture screenshots https://domain, falling back to http://, and returns
+// the path of the stored image. A new capture replaces the previous one.
+func (s *Service) Capture(ctx context.Context, domain string) (string, error) {
+	if _, err := exec.LookPath("gowitness"); err != nil {
+		return "", fmt.Errorf("gowitness not found in PATH: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", err
+	}
+
+	var lastErr error
+	for _, scheme := range []string{"https", "http"} {
+		path, err := s.capture(ctx, domain, scheme+"://"+domainutil.ToASCII(domain))
+		if err == nil {
+			return path, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// capture runs gowitness into a scratch directory, since the file name it
+// picks differs between versions, and moves the image next to the others
+func (s *Service) capture(ctx context.Context, domain, url string) (string, error) {
+	scratch, err := os.MkdirTemp(s.dir, ".capture-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(scratch)
+
+	cmdCtx, cancel := context.WithTimeout(ctx, captureTimeout)
+	defer cancel()
+
+	_, err = subprocess.Run(cmdCtx, domain, "gowitness", "scan", "single",
+		"--url", url,
+		"--screenshot-path", scratch,
+		"--timeout", "30",
+		"--quiet",
+	)
+	if err != nil {
+		return "", err
+	}
+
+	images, _ := filepath.Glob(filepath.Join(scratch, "*"))
+	for _, image := range images {
+		ext := strings.ToLower(filepath.Ext(image))
+		if ext != ".png" && ext != ".jpeg" && ext != ".jpg" {
+			continue
+		}
+		path := filepath.Join(s.dir, fileName(domain)+ext)
+		if err := os.Rename(image, path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("gowitness produced no screenshot for %s", url)
+}
+
+// fileName keeps only characters that are safe in a file name
+func fileName(domain string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(domain))
+}
+
+// CaptureDomains screenshots multiple domains in parallel within the
+// concurrency limit
+func (s *Service) CaptureDomains(ctx context.Context, domains []string) map[string]Result {
+	results := make(map[string]Result)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, domain := range domains {
+		wg.Add(1)
+		go func(d string) {
+			defer wg.Done()
+			select {
+			case s.semaphore <- struct{}{}:
+			case <-ctx.Done():
+				mu.Lock()
+				results[d] = Result{Err: ctx.Err()}
+				mu.Unlock()
+				return
+			}
+			defer func() { <-s.semaphore }()
+
+			path, err := s.Capture(ctx, d)
+			mu.Lock()
+			results[d] = Result{Path: path, Err: err}
+			mu.Unlock()
+		}(domain)
+	}
+
+	wg.Wait()
+	return results
+}
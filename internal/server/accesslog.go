@@ -0,0 +1,57 @@
+package server
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessLogger builds the access log middleware selected by WEB_ACCESS_LOG:
+// "off", "stdout", "slog" or "file:<path>". It returns nil when access
+// logging is off.
+func accessLogger(spec string) gin.HandlerFunc {
+	mode, path, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	switch strings.ToLower(mode) {
+	case "off", "none", "false":
+		return nil
+	case "", "stdout":
+		return gin.LoggerWithWriter(os.Stdout)
+	case "slog":
+		return slogLogger()
+	case "file":
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Printf("Cannot open access log %q, logging to stdout: %v", path, err)
+			return gin.LoggerWithWriter(os.Stdout)
+		}
+		// The file stays open for the lifetime of the server
+		return gin.LoggerWithWriter(file)
+	default:
+		log.Printf("Unknown WEB_ACCESS_LOG %q, logging to stdout", spec)
+		return gin.LoggerWithWriter(os.Stdout)
+	}
+}
+
+// slogLogger writes one structured record per request through the default
+// slog logger, which shares its output with the rest of the application
+func slogLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		slog.Info("http request",
+			"method", c.Request.Method,
+			"path", path,
+			"status", c.Writer.Status(),
+			"latency", time.Since(start),
+			"client_ip", c.ClientIP(),
+			"request_id", c.GetString("request_id"),
+		)
+	}
+}
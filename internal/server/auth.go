@@ -0,0 +1,62 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Auth holds the credentials accepted by the web server. A bearer token and
+// basic auth credentials may both be set; either one grants access.
+type Auth struct {
+	Token    string
+	User     string
+	Password string
+}
+
+func (a Auth) enabled() bool {
+	return a.Token != "" || a.User != ""
+}
+
+// allows reports whether the request carries valid credentials
+func (a Auth) allows(r *http.Request) bool {
+	if a.Token != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && equal(token, a.Token) {
+			return true
+		}
+	}
+	if a.User != "" {
+		if user, password, ok := r.BasicAuth(); ok && equal(user, a.User) && equal(password, a.Password) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares credentials in constant time
+func equal(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// authenticate rejects requests without valid credentials with 401. The
+// public paths, i.e. the probes, stay reachable without credentials.
+func authenticate(auth Auth, public ...string) gin.HandlerFunc {
+	open := make(map[string]bool, len(public))
+	for _, path := range public {
+		open[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if open[c.Request.URL.Path] || auth.allows(c.Request) {
+			c.Next()
+			return
+		}
+		// Let browsers prompt for the basic auth credentials
+		if auth.User != "" {
+			c.Header("WWW-Authenticate", `Basic realm="watchtower"`)
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"watchtower/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushEvery is how many rows a domain export writes between flushes
+const exportFlushEvery = 500
+
+var domainExportColumns = []string{"domain", "program", "status", "discovered_at", "last_checked"}
+
+// exportDomains streams every domain, optionally of one program, as CSV or
+// JSON. Rows go to the client as they are read, so the status is already
+// sent when a database error interrupts the export; it is only logged.
+func (s *Server) exportDomains(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+	program := c.Query("program")
+
+	name := "all"
+	if program != "" {
+		name = filenameSafe(program)
+	}
+	filename := fmt.Sprintf("watchtower-domains-%s-%s.%s", name, time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	var err error
+	if format == "csv" {
+		err = s.streamDomainsCSV(c, program)
+	} else {
+		err = s.streamDomainsJSON(c, program)
+	}
+	if err != nil {
+		log.Printf("Domain export interrupted: %v", err)
+	}
+}
+
+func (s *Server) streamDomainsCSV(c *gin.Context, program string) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(domainExportColumns); err != nil {
+		return err
+	}
+
+	rows := 0
+	err := s.db.EachDomain(program, func(d database.Domain) error {
+		if err := w.Write([]string{d.Domain, d.Program, d.Status, exportTime(d.DiscoveredAt), exportTime(d.LastChecked)}); err != nil {
+			return err
+		}
+		if rows++; rows%exportFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+	w.Flush()
+	if err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+// exportedDomain is one element of a JSON domain export
+type exportedDomain struct {
+	Domain       string `json:"domain"`
+	Program      string `json:"program"`
+	Status       string `json:"status"`
+	DiscoveredAt string `json:"discovered_at"`
+	LastChecked  string `json:"last_checked"`
+}
+
+func (s *Server) streamDomainsJSON(c *gin.Context, program string) error {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if _, err := c.Writer.WriteString("["); err != nil {
+		return err
+	}
+	rows := 0
+	err := s.db.EachDomain(program, func(d database.Domain) error {
+		data, err := json.Marshal(exportedDomain{
+			Domain:       d.Domain,
+			Program:      d.Program,
+			Status:       d.Status,
+			DiscoveredAt: exportTime(d.DiscoveredAt),
+			LastChecked:  exportTime(d.LastChecked),
+		})
+		if err != nil {
+			return err
+		}
+		if rows > 0 {
+			if _, err := c.Writer.WriteString(","); err != nil {
+				return err
+			}
+		}
+		if _, err := c.Writer.Write(data); err != nil {
+			return err
+		}
+		if rows++; rows%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.WriteString("]\n")
+	return err
+}
+
+// exportLiveDomains returns the hosts that are up as plain text, one per
+// line, for piping into other tools
+func (s *Server) exportLiveDomains(c *gin.Context) {
+	domains, err := s.db.GetLiveDomains(c.Query("program"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var body strings.Builder
+	for _, domain := range domains {
+		body.WriteString(domain)
+		body.WriteByte('\n')
+	}
+	c.String(http.StatusOK, body.String())
+}
+
+// filenameSafe replaces characters that don't belong in a download filename
+func filenameSafe(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// exportTime formats a timestamp as RFC 3339, empty for the zero time
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
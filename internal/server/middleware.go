@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestTiming assigns each request an id and, when the client passes
+// ?debug=true, wraps JSON responses as {data, meta} with how long the request
+// took. Requests are logged by the WEB_ACCESS_LOG logger only.
+// Normal responses, responses that aren't JSON and streamed responses are
+// left untouched.
+func requestTiming() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := newRequestID()
+		c.Set("request_id", requestID)
+		c.Header("X-Request-ID", requestID)
+
+		var buffered *bufferedWriter
+		if c.Query("debug") == "true" {
+			buffered = &bufferedWriter{ResponseWriter: c.Writer}
+			c.Writer = buffered
+		}
+
+		c.Next()
+
+		if buffered != nil {
+			c.Writer = buffered.ResponseWriter
+			buffered.flush(requestID, time.Since(start))
+		}
+	}
+}
+
+// bufferedWriter holds the response body back so it can be wrapped. It
+// passes the response through once it turns out not to be JSON or the
+// handler flushes, as the event stream and the exports do.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body        bytes.Buffer
+	passthrough bool
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	if w.buffering() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	if w.buffering() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// buffering reports whether the body is still held back
+func (w *bufferedWriter) buffering() bool {
+	if !w.passthrough && !strings.Contains(w.Header().Get("Content-Type"), "application/json") {
+		w.passthrough = true
+	}
+	return !w.passthrough
+}
+
+// Flush sends what was held back and stops buffering
+func (w *bufferedWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *bufferedWriter) flush(requestID string, took time.Duration) {
+	if w.passthrough {
+		return
+	}
+	raw := w.body.Bytes()
+	if !json.Valid(raw) {
+		w.ResponseWriter.Write(raw)
+		return
+	}
+
+	wrapped, err := json.Marshal(gin.H{
+		"data": json.RawMessage(raw),
+		"meta": gin.H{
+			"request_id": requestID,
+			"took_ms":    float64(took.Microseconds()) / 1000,
+		},
+	})
+	if err != nil {
+		w.ResponseWriter.Write(raw)
+		return
+	}
+	w.ResponseWriter.Write(wrapped)
+}
+
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strings.ReplaceAll(time.Now().Format("150405.000000"), ".", "")
+	}
+	return hex.EncodeToString(b[:])
+}
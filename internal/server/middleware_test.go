@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestTimingDebugEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		handler     func(c *gin.Context, rec *httptest.ResponseRecorder)
+		wantWrapped bool
+		wantBody    string
+	}{
+		{
+			name: "json is wrapped",
+			handler: func(c *gin.Context, rec *httptest.ResponseRecorder) {
+				c.JSON(http.StatusOK, gin.H{"ok": true})
+			},
+			wantWrapped: true,
+		},
+		{
+			name: "csv is passed through",
+			handler: func(c *gin.Context, rec *httptest.ResponseRecorder) {
+				c.Data(http.StatusOK, "text/csv", []byte("domain\nexample.com\n"))
+			},
+			wantBody: "domain\nexample.com\n",
+		},
+		{
+			name: "event stream is flushed right away",
+			handler: func(c *gin.Context, rec *httptest.ResponseRecorder) {
+				c.Header("Content-Type", "text/event-stream")
+				c.Writer.WriteString("data: 1\n\n")
+				c.Writer.Flush()
+				if rec.Body.String() != "data: 1\n\n" {
+					t.Errorf("event not flushed, body %q", rec.Body.String())
+				}
+			},
+			wantBody: "data: 1\n\n",
+		},
+		{
+			name: "streamed json is passed through",
+			handler: func(c *gin.Context, rec *httptest.ResponseRecorder) {
+				c.Header("Content-Type", "application/json")
+				c.Status(http.StatusOK)
+				c.Writer.WriteString("[1")
+				c.Writer.Flush()
+				if rec.Body.String() != "[1" {
+					t.Errorf("export not flushed, body %q", rec.Body.String())
+				}
+				c.Writer.WriteString(",2]")
+			},
+			wantBody: "[1,2]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router := gin.New()
+			router.Use(requestTiming())
+			router.GET("/", func(c *gin.Context) { tt.handler(c, rec) })
+
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?debug=true", nil))
+
+			if !tt.wantWrapped {
+				if rec.Body.String() != tt.wantBody {
+					t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+				}
+				return
+			}
+			var envelope struct {
+				Data map[string]bool        `json:"data"`
+				Meta map[string]interface{} `json:"meta"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("decode %q: %v", rec.Body.String(), err)
+			}
+			if !envelope.Data["ok"] || envelope.Meta["request_id"] == "" {
+				t.Errorf("envelope = %+v", envelope)
+			}
+		})
+	}
+}
+
+func TestRequestTimingLeavesLoggingToAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"plain", "/ping"},
+		{"debug", "/ping?debug=true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged.Reset()
+			router := gin.New()
+			router.Use(requestTiming())
+			router.GET("/ping", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Header().Get("X-Request-ID") == "" {
+				t.Error("missing X-Request-ID header")
+			}
+			if logged.Len() > 0 {
+				t.Errorf("request logged outside the access log: %q", logged.String())
+			}
+		})
+	}
+}
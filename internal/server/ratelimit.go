@@ -0,0 +1,33 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimit allows one request per interval to the wrapped route, shared
+// across all clients. It protects upstream APIs rather than the server.
+func rateLimit(interval time.Duration) gin.HandlerFunc {
+	var mu sync.Mutex
+	var last time.Time
+
+	return func(c *gin.Context) {
+		mu.Lock()
+		wait := interval - time.Since(last)
+		if wait > 0 {
+			mu.Unlock()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limited, retry later"})
+			return
+		}
+		last = time.Now()
+		mu.Unlock()
+
+		c.Next()
+	}
+}
@@ -1,56 +1,200 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"watchtower/internal/database"
+	"watchtower/internal/enrichment"
+	"watchtower/internal/hackerone"
+	"watchtower/internal/scheduler"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type Server struct {
-	db   *database.DB
-	port string
+	db              *database.DB
+	scheduler       *scheduler.Scheduler
+	hackeroneClient *hackerone.Client
+	port            string
+	accessLog       string
+	basePath        string
+	auth            Auth
+
+	mu           sync.Mutex
+	httpServer   *http.Server
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
-func NewServer(db *database.DB, port string) *Server {
+func NewServer(db *database.DB, scanScheduler *scheduler.Scheduler, hackeroneClient *hackerone.Client, port, accessLog, basePath string) *Server {
 	return &Server{
-		db:   db,
-		port: port,
+		db:              db,
+		scheduler:       scanScheduler,
+		hackeroneClient: hackeroneClient,
+		port:            port,
+		accessLog:       accessLog,
+		basePath:        basePath,
+		shutdown:        make(chan struct{}),
 	}
 }
 
+// WithAuth protects every route except the probes with the given credentials
+func (s *Server) WithAuth(auth Auth) *Server {
+	s.auth = auth
+	return s
+}
+
 func (s *Server) Start() error {
-	router := gin.Default()
+	router := gin.New()
+
+	// Recovery is always on so a panicking handler never takes the server down
+	router.Use(gin.Recovery())
+	if logger := accessLogger(s.accessLog); logger != nil {
+		router.Use(logger)
+	}
+	if s.auth.enabled() {
+		router.Use(authenticate(s.auth, s.basePath+"/healthz", s.basePath+"/readyz", "/healthz", "/readyz"))
+	}
+
+	// Every route and asset URL lives under BASE_PATH so the app can be
+	// mounted below a reverse proxy prefix
+	root := router.Group(s.basePath + "/")
+	router.SetFuncMap(template.FuncMap{
+		"base": func(path string) string { return s.basePath + path },
+	})
+
+	// Probes answer with JSON only, so they work without templates. They are
+	// also served at the root, where container healthchecks look for them.
+	root.GET("/healthz", s.healthz)
+	root.GET("/readyz", s.readyz)
+	if s.basePath != "" {
+		router.GET("/healthz", s.healthz)
+		router.GET("/readyz", s.readyz)
+	}
 
 	// Serve static files and HTML
-	router.Static("/static", "./web/static")
+	root.Static("/static", "./web/static")
 	router.LoadHTMLGlob("web/templates/*")
 
 	// API routes
-	api := router.Group("/api/v1")
+	api := root.Group("/api/v1")
+	api.Use(requestTiming())
 	{
+		api.GET("/events", s.streamEvents)
 		api.GET("/stats", s.getStats)
+		api.GET("/stats/sources", s.getSourceStats)
 		api.GET("/domains/new", s.getNewDomains)
+		api.GET("/domains/stale", s.getStaleDomains)
+		api.GET("/domains/search", s.searchDomains)
+		api.GET("/domains/favicon/:hash", s.getDomainsByFavicon)
+		api.GET("/domains/technology/:tech", s.getDomainsByTechnology)
 		api.GET("/domains", s.getDomains)
 		api.GET("/domains/program/:program", s.getDomainsByProgram)
+		api.GET("/domains/:domain/history", s.getDomainHistory)
+		api.GET("/domains/:domain/checks", s.getDomainChecks)
+		api.GET("/domains/:domain/timeline", s.getDomainTimeline)
+		api.GET("/domains/:domain/info", s.getDomainInfo)
 		api.GET("/programs", s.getPrograms)
 		api.GET("/programs/rdp", s.getRDPPrograms)
 		api.GET("/programs/vdp", s.getVDPPrograms)
 		api.GET("/programs/bounties", s.getBountyPrograms)
+		api.GET("/programs/source/:source", s.getProgramsBySource)
+		api.POST("/programs/:handle/scan", s.scanProgram)
+		api.GET("/programs/:handle/scan/:id", s.getProgramScan)
+		api.GET("/programs/:handle/scope", s.getProgramScope)
+		api.GET("/programs/:handle/scope/live", rateLimit(5*time.Second), s.getLiveScope)
+		api.GET("/programs/:handle/status-codes", s.getStatusCodeBreakdown)
 		api.GET("/status-changes", s.getStatusChanges)
 		api.GET("/status-changes/unnotified", s.getUnnotifiedStatusChanges)
+		api.POST("/status-changes/notified-all", s.markAllStatusChangesNotified)
+		api.POST("/status-changes/:id/notified", s.markStatusChangeNotified)
+		api.GET("/alerts", s.getAlerts)
+		api.GET("/tech-alerts", s.getTechAlerts)
+		api.GET("/findings", s.getFindings)
+		api.GET("/scan/errors", s.getScanErrors)
+		api.GET("/scan/progress", s.getScanProgress)
+		api.POST("/scan", s.startScan)
+		api.POST("/scan/cancel", s.cancelScan)
+		api.GET("/scans", s.getScanRuns)
+		api.GET("/schedule", s.getSchedule)
+		api.POST("/schedule/pause", s.pauseSchedule)
+		api.POST("/schedule/resume", s.resumeSchedule)
+		api.POST("/admin/reenrich-missing", s.reenrichMissing)
+		api.GET("/watch", s.getWatches)
+		api.POST("/watch/:handle", s.watchProgram)
+		api.DELETE("/watch/:handle", s.unwatchProgram)
+		api.GET("/export", s.exportDataset)
+		api.GET("/export/domains", s.exportDomains)
+		api.GET("/export/live", s.exportLiveDomains)
+		api.POST("/import", s.importDataset)
+		api.POST("/maintenance/prune", s.prune)
 	}
 
 	// Web routes
-	router.GET("/", s.index)
-	router.GET("/domains", s.domainsPage)
-	router.GET("/programs", s.programsPage)
-	router.GET("/status-changes", s.statusChangesPage)
-	router.GET("/filters", s.filtersPage)
+	root.GET("/", s.index)
+	root.GET("/domains", s.domainsPage)
+	root.GET("/domains/:domain", s.domainDetailPage)
+	root.GET("/screenshots/:domain", s.serveScreenshot)
+	root.GET("/programs", s.programsPage)
+	root.GET("/status-changes", s.statusChangesPage)
+	root.GET("/filters", s.filtersPage)
+	root.GET("/scheduler", s.schedulerPage)
 
-	return router.Run(":" + s.port)
+	// Prometheus metrics
+	root.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	httpServer := &http.Server{
+		Addr:    ":" + s.port,
+		Handler: router,
+	}
+	// Open event streams would otherwise hold up a graceful shutdown
+	httpServer.RegisterOnShutdown(func() {
+		s.shutdownOnce.Do(func() { close(s.shutdown) })
+	})
+	s.mu.Lock()
+	s.httpServer = httpServer
+	s.mu.Unlock()
+	return httpServer.ListenAndServe()
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	httpServer := s.httpServer
+	s.mu.Unlock()
+	if httpServer == nil {
+		return nil
+	}
+	return httpServer.Shutdown(ctx)
+}
+
+// healthz is the liveness probe: the process is up and serving requests
+func (s *Server) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyz is the readiness probe: the database can be reached
+func (s *Server) readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+	if err := s.db.PingContext(ctx); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
 func (s *Server) getStats(c *gin.Context) {
@@ -62,14 +206,97 @@ func (s *Server) getStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+func (s *Server) getSourceStats(c *gin.Context) {
+	stats, err := s.db.GetSourceStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// Page sizes of the paginated domain endpoints
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// pageParams reads the limit and offset query parameters. The limit falls
+// back to the default when missing or invalid and is capped at
+// maxPageLimit; negative offsets start at zero.
+func pageParams(c *gin.Context) (limit, offset int) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	offset, err = strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// domainPage is the response body of the paginated domain endpoints
+func domainPage(domains []database.Domain, total, limit, offset int) gin.H {
+	if domains == nil {
+		domains = []database.Domain{}
+	}
+	return gin.H{"data": domains, "total": total, "limit": limit, "offset": offset}
+}
+
+// domainListParams reads the status filter and sort order shared by the
+// domain list endpoints into filter. It answers 400 and returns false when
+// they are invalid.
+func domainListParams(c *gin.Context, filter *database.DomainFilter) bool {
+	filter.Status = strings.ToLower(c.Query("status"))
+	switch filter.Status {
+	case "", "up", "down", "unknown", database.StatusUnreachableInternal:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of up, down, unknown, " + database.StatusUnreachableInternal})
+		return false
+	}
+
+	filter.Sort = c.Query("sort")
+	filter.Order = strings.ToLower(c.Query("order"))
+	if err := database.ValidateDomainSort(filter.Sort, filter.Order); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
 func (s *Server) getNewDomains(c *gin.Context) {
+	limit, offset := pageParams(c)
+
+	filter := database.DomainFilter{OnlyNew: true, Limit: limit, Offset: offset}
+	if !domainListParams(c, &filter) {
+		return
+	}
+	domains, total, err := s.db.ListDomainsPaged(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, domainPage(domains, total, limit, offset))
+}
+
+func (s *Server) getStaleDomains(c *gin.Context) {
+	olderThan, err := time.ParseDuration(c.DefaultQuery("older_than", "48h"))
+	if err != nil || olderThan <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "older_than must be a positive duration like 48h"})
+		return
+	}
+
 	limitStr := c.DefaultQuery("limit", "100")
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil {
 		limit = 100
 	}
 
-	domains, err := s.db.GetNewDomains(limit)
+	domains, err := s.db.GetStaleDomains(olderThan, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -77,47 +304,136 @@ func (s *Server) getNewDomains(c *gin.Context) {
 	c.JSON(http.StatusOK, domains)
 }
 
-func (s *Server) getDomains(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "100")
-	limit, err := strconv.Atoi(limitStr)
+func (s *Server) searchDomains(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit, _ := pageParams(c)
+
+	domains, err := s.db.SearchDomains(query, limit)
 	if err != nil {
-		limit = 100
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if domains == nil {
+		domains = []database.Domain{}
 	}
+	c.JSON(http.StatusOK, domains)
+}
+
+func (s *Server) getDomains(c *gin.Context) {
+	limit, offset := pageParams(c)
 
 	program := c.Query("program")
-	if program != "" {
-		domains, err := s.db.GetDomainsByProgram(program, limit)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, domains)
-		return
+	bountyEligible := c.Query("bounty") == "true" || c.Query("bounty_eligible") == "true"
+	source := c.Query("source")
+	assetType := strings.ToUpper(c.Query("asset_type"))
+	var certValid *bool
+	if value, err := strconv.ParseBool(c.Query("cert_valid")); err == nil {
+		certValid = &value
 	}
 
-	// Get new domains by default
-	domains, err := s.db.GetNewDomains(limit)
+	filter := database.DomainFilter{
+		Program:        program,
+		BountyEligible: bountyEligible,
+		AssetType:      assetType,
+		Source:         source,
+		Platform:       c.Query("platform"),
+		CertValid:      certValid,
+		Limit:          limit,
+		Offset:         offset,
+	}
+	if !domainListParams(c, &filter) {
+		return
+	}
+	// Without any filter only new domains are listed
+	filter.OnlyNew = program == "" && !bountyEligible && assetType == "" && source == "" &&
+		filter.Platform == "" && certValid == nil && filter.Status == ""
+	domains, total, err := s.db.ListDomainsPaged(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, domains)
+	c.JSON(http.StatusOK, domainPage(domains, total, limit, offset))
 }
 
 func (s *Server) getDomainsByProgram(c *gin.Context) {
 	program := c.Param("program")
+	limit, offset := pageParams(c)
+
+	filter := database.DomainFilter{Program: program, Limit: limit, Offset: offset}
+	if !domainListParams(c, &filter) {
+		return
+	}
+	domains, total, err := s.db.ListDomainsPaged(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, domainPage(domains, total, limit, offset))
+}
+
+func (s *Server) getDomainInfo(c *gin.Context) {
+	info, err := s.db.GetDomainInfo(c.Param("domain"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no enrichment data for this domain"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if info.Technologies == nil {
+		info.Technologies = []string{}
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+func (s *Server) getDomainHistory(c *gin.Context) {
+	events, err := s.db.GetDomainHistory(c.Param("domain"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "domain not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+func (s *Server) getDomainChecks(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "100")
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil {
 		limit = 100
 	}
 
-	domains, err := s.db.GetDomainsByProgram(program, limit)
+	checks, err := s.db.GetDomainChecks(c.Param("domain"), limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "domain not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, domains)
+	c.JSON(http.StatusOK, checks)
+}
+
+func (s *Server) getDomainTimeline(c *gin.Context) {
+	timeline, err := s.db.GetDomainTimeline(c.Param("domain"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "domain not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, timeline)
 }
 
 func (s *Server) getPrograms(c *gin.Context) {
@@ -126,7 +442,114 @@ func (s *Server) getPrograms(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, programs)
+
+	minResolved, err := optionalFloat(c, "min_resolved_reports")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	minBounty, err := optionalFloat(c, "min_bounty")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	state := c.Query("submission_state")
+	programType := c.Query("type")
+	filtered := []database.Program{}
+	for _, program := range programs {
+		if state != "" && !strings.EqualFold(program.SubmissionState, state) {
+			continue
+		}
+		if programType != "" && !strings.EqualFold(program.ProgramType, programType) {
+			continue
+		}
+		if minResolved != nil && (program.ResolvedReports == nil || float64(*program.ResolvedReports) < *minResolved) {
+			continue
+		}
+		if minBounty != nil && (program.BountyMax == nil || *program.BountyMax < *minBounty) {
+			continue
+		}
+		filtered = append(filtered, program)
+	}
+
+	if sortBy := c.Query("sort"); sortBy != "" {
+		key, ok := programSortKeys[sortBy]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of resolved_reports, bounty_min, bounty_max"})
+			return
+		}
+		ascending := c.Query("order") == "asc"
+		// Programs without the value sort last in either order
+		sort.SliceStable(filtered, func(i, j int) bool {
+			a, b := key(filtered[i]), key(filtered[j])
+			if a == nil || b == nil {
+				return a != nil
+			}
+			if ascending {
+				return *a < *b
+			}
+			return *a > *b
+		})
+	}
+	c.JSON(http.StatusOK, filtered)
+}
+
+// programSortKeys maps the sort parameter of /programs to the sorted value
+var programSortKeys = map[string]func(database.Program) *float64{
+	"resolved_reports": func(p database.Program) *float64 {
+		if p.ResolvedReports == nil {
+			return nil
+		}
+		v := float64(*p.ResolvedReports)
+		return &v
+	},
+	"bounty_min": func(p database.Program) *float64 { return p.BountyMin },
+	"bounty_max": func(p database.Program) *float64 { return p.BountyMax },
+}
+
+// optionalFloat parses a numeric query parameter, returning nil when absent
+func optionalFloat(c *gin.Context, name string) (*float64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return &f, nil
+}
+
+// getProgramScope returns the scope stored at the last scan of a program,
+// including assets that are not probed such as CIDR ranges and mobile apps
+func (s *Server) getProgramScope(c *gin.Context) {
+	handle := c.Param("handle")
+	assetType := strings.ToUpper(strings.TrimSpace(c.Query("asset_type")))
+	assets, err := s.db.GetScopeAssets(handle, assetType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"handle": handle,
+		"assets": assets,
+	})
+}
+
+// getLiveScope fetches a program's scope straight from HackerOne without
+// touching the database
+func (s *Server) getLiveScope(c *gin.Context) {
+	handle := c.Param("handle")
+	scopes, err := s.hackeroneClient.GetProgramScopeDetailed(c.Request.Context(), handle)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"handle": handle,
+		"scopes": scopes,
+	})
 }
 
 func (s *Server) index(c *gin.Context) {
@@ -141,18 +564,37 @@ func (s *Server) index(c *gin.Context) {
 
 func (s *Server) domainsPage(c *gin.Context) {
 	program := c.Query("program")
+	search := strings.TrimSpace(c.Query("q"))
+	bountyOnly := c.Query("bounty") == "true"
 	limitStr := c.DefaultQuery("limit", "100")
 	limit, _ := strconv.Atoi(limitStr)
 
 	var domains []database.Domain
 	var err error
 
-	if program != "" {
+	if search != "" {
+		domains, err = s.db.SearchDomains(search, limit)
+	} else if program != "" && bountyOnly {
+		domains, err = s.db.ListDomains(database.DomainFilter{Program: program, BountyEligible: true, Limit: limit})
+	} else if program != "" {
 		domains, err = s.db.GetDomainsByProgram(program, limit)
+	} else if bountyOnly {
+		domains, err = s.db.GetBountyEligibleDomains(limit)
 	} else {
 		domains, err = s.db.GetNewDomains(limit)
 	}
 
+	// Search covers all programs; the toggle narrows its results
+	if err == nil && search != "" && bountyOnly {
+		eligible := []database.Domain{}
+		for _, domain := range domains {
+			if domain.BountyEligible {
+				eligible = append(eligible, domain)
+			}
+		}
+		domains = eligible
+	}
+
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
 			"Error": err.Error(),
@@ -166,12 +608,77 @@ func (s *Server) domainsPage(c *gin.Context) {
 		"Domains":         domains,
 		"Programs":        programs,
 		"SelectedProgram": program,
+		"Search":          search,
+		"BountyOnly":      bountyOnly,
 	})
 }
 
+func (s *Server) domainDetailPage(c *gin.Context) {
+	domain := c.Param("domain")
+
+	info, err := s.db.GetDomainInfo(domain)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"Error": err.Error(),
+		})
+		return
+	}
+	history, _ := s.db.GetDomainChecks(domain, 20)
+	timeline, _ := s.db.GetDomainTimeline(domain)
+	screenshot, _ := s.db.GetScreenshot(domain)
+
+	c.HTML(http.StatusOK, "domain-detail.html", gin.H{
+		"Domain":     domain,
+		"Info":       info,
+		"History":    history,
+		"Timeline":   timeline,
+		"Screenshot": screenshot,
+	})
+}
+
+func (s *Server) getDomainsByFavicon(c *gin.Context) {
+	hash, err := strconv.ParseInt(c.Param("hash"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hash must be a 32-bit integer"})
+		return
+	}
+
+	domains, err := s.db.GetDomainsByFaviconHash(int32(hash))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, domains)
+}
+
+// getDomainsByTechnology lists the enriched domains running a technology
+func (s *Server) getDomainsByTechnology(c *gin.Context) {
+	domains, err := s.db.GetDomainsByTechnology(c.Param("tech"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, domains)
+}
+
+// serveScreenshot sends the latest screenshot of a domain
+func (s *Server) serveScreenshot(c *gin.Context) {
+	shot, err := s.db.GetScreenshot(c.Param("domain"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no screenshot for this domain"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.File(shot.Path)
+}
+
 func (s *Server) programsPage(c *gin.Context) {
 	programType := c.Query("type")
 	bountiesOnly := c.Query("bounties") == "true"
+	source := c.Query("source")
 
 	var programs []database.Program
 	var err error
@@ -182,6 +689,8 @@ func (s *Server) programsPage(c *gin.Context) {
 		programs, err = s.db.GetProgramsByType("VDP")
 	} else if bountiesOnly {
 		programs, err = s.db.GetProgramsWithBounties()
+	} else if source != "" {
+		programs, err = s.db.GetProgramsBySource(source)
 	} else {
 		programs, err = s.db.GetPrograms()
 	}
@@ -193,10 +702,25 @@ func (s *Server) programsPage(c *gin.Context) {
 		return
 	}
 
+	// The platform filter also narrows the type and bounty views
+	if source != "" && (programType == "RDP" || programType == "VDP" || bountiesOnly) {
+		filtered := []database.Program{}
+		for _, program := range programs {
+			if program.Source == source {
+				filtered = append(filtered, program)
+			}
+		}
+		programs = filtered
+	}
+
+	sources, _ := s.db.GetProgramSources()
+
 	c.HTML(http.StatusOK, "programs.html", gin.H{
 		"Programs":    programs,
 		"ProgramType": programType,
 		"BountiesOnly": bountiesOnly,
+		"Sources":        sources,
+		"SelectedSource": source,
 	})
 }
 
@@ -227,6 +751,28 @@ func (s *Server) getBountyPrograms(c *gin.Context) {
 	c.JSON(http.StatusOK, programs)
 }
 
+func (s *Server) getProgramsBySource(c *gin.Context) {
+	programs, err := s.db.GetProgramsBySource(c.Param("source"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, programs)
+}
+
+func (s *Server) getStatusCodeBreakdown(c *gin.Context) {
+	handle := c.Param("handle")
+	breakdown, err := s.db.GetStatusCodeBreakdown(handle)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"program":      handle,
+		"status_codes": breakdown,
+	})
+}
+
 func (s *Server) getStatusChanges(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "50")
 	limit, err := strconv.Atoi(limitStr)
@@ -257,6 +803,303 @@ func (s *Server) getUnnotifiedStatusChanges(c *gin.Context) {
 	c.JSON(http.StatusOK, changes)
 }
 
+func (s *Server) markStatusChangeNotified(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status change id"})
+		return
+	}
+
+	if err := s.db.MarkStatusChangeNotified(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "status change not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "notified": true})
+}
+
+func (s *Server) markAllStatusChangesNotified(c *gin.Context) {
+	cleared, err := s.db.MarkAllStatusChangesNotified()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cleared": cleared})
+}
+
+func (s *Server) getAlerts(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "100")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 100
+	}
+
+	alerts, err := s.db.GetAlerts(c.Query("type"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
+func (s *Server) getTechAlerts(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "100")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 100
+	}
+
+	alerts, err := s.db.GetAlerts(database.AlertTypeTech, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
+func (s *Server) getFindings(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "100")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 100
+	}
+
+	findings, err := s.db.GetFindings(database.FindingFilter{
+		Domain:   c.Query("domain"),
+		Program:  c.Query("program"),
+		Severity: c.Query("severity"),
+		Limit:    limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, findings)
+}
+
+func (s *Server) getScanProgress(c *gin.Context) {
+	c.JSON(http.StatusOK, s.scheduler.Progress())
+}
+
+func (s *Server) getScanErrors(c *gin.Context) {
+	summary := s.scheduler.LastScanSummary()
+	if summary == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no scan has finished yet"})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+func (s *Server) startScan(c *gin.Context) {
+	force, _ := strconv.ParseBool(c.Query("force"))
+	id, err := s.scheduler.StartScan(force)
+	if errors.Is(err, scheduler.ErrScanRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"scan_id": id, "status": "started"})
+}
+
+func (s *Server) cancelScan(c *gin.Context) {
+	if err := s.scheduler.CancelScan(); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "cancelling"})
+}
+
+// scanProgram fetches one program from HackerOne and starts scanning it in
+// the background
+func (s *Server) scanProgram(c *gin.Context) {
+	id, err := s.scheduler.StartProgramScan(c.Request.Context(), c.Param("handle"))
+	if errors.Is(err, hackerone.ErrProgramNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"scan_id": id, "status": scheduler.ProgramScanRunning})
+}
+
+func (s *Server) getProgramScan(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scan id"})
+		return
+	}
+
+	scan, ok := s.scheduler.ProgramScanState(id)
+	if !ok || scan.Program != c.Param("handle") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scan not found"})
+		return
+	}
+	c.JSON(http.StatusOK, scan)
+}
+
+func (s *Server) getScanRuns(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "50")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 50
+	}
+
+	runs, err := s.db.GetScanRuns(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func (s *Server) getSchedule(c *gin.Context) {
+	c.JSON(http.StatusOK, s.scheduler.Schedule())
+}
+
+func (s *Server) pauseSchedule(c *gin.Context) {
+	s.scheduler.Pause()
+	c.JSON(http.StatusOK, s.scheduler.Schedule())
+}
+
+func (s *Server) resumeSchedule(c *gin.Context) {
+	s.scheduler.Resume()
+	c.JSON(http.StatusOK, s.scheduler.Schedule())
+}
+
+func (s *Server) reenrichMissing(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "500")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 500
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Hour)
+	defer cancel()
+
+	result, err := s.scheduler.ReenrichMissing(ctx, limit)
+	if errors.Is(err, scheduler.ErrReenrichRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, enrichment.ErrHTTPXMissing) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// prune applies the retention policy right away
+func (s *Server) prune(c *gin.Context) {
+	result, err := s.scheduler.Prune()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) getWatches(c *gin.Context) {
+	c.JSON(http.StatusOK, s.scheduler.Watches())
+}
+
+func (s *Server) watchProgram(c *gin.Context) {
+	var interval time.Duration
+	if value := c.Query("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval: " + err.Error()})
+			return
+		}
+		interval = parsed
+	}
+
+	state, err := s.scheduler.Watch(c.Param("handle"), interval)
+	if errors.Is(err, scheduler.ErrAlreadyWatching) || errors.Is(err, scheduler.ErrWatchLimit) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, state)
+}
+
+func (s *Server) unwatchProgram(c *gin.Context) {
+	if err := s.scheduler.Unwatch(c.Param("handle")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// exportDataset downloads all programs, domains, domain info and status
+// changes in the format accepted by importDataset
+func (s *Server) exportDataset(c *gin.Context) {
+	data, err := s.db.ExportDataset()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	filename := fmt.Sprintf("watchtower-export-%s.json", data.ExportedAt.UTC().Format("20060102T150405Z"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.JSON(http.StatusOK, data)
+}
+
+// importDataset loads a JSON dataset, or a text or CSV body of
+// "program,domain" lines that are added as manual domains
+func (s *Server) importDataset(c *gin.Context) {
+	switch c.ContentType() {
+	case "text/plain", "text/csv":
+		s.importManualDomains(c)
+		return
+	}
+
+	var data database.Dataset
+	if err := json.NewDecoder(c.Request.Body).Decode(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dataset: " + err.Error()})
+		return
+	}
+
+	stats, err := s.db.ImportDataset(&data)
+	if errors.Is(err, database.ErrUnsupportedDataset) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func (s *Server) importManualDomains(c *gin.Context) {
+	entries, err := database.ParseManualDomains(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain list: " + err.Error()})
+		return
+	}
+
+	stats, err := s.db.AddManualDomains(entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
 func (s *Server) statusChangesPage(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "100")
 	limit, _ := strconv.Atoi(limitStr)
@@ -274,6 +1117,16 @@ func (s *Server) statusChangesPage(c *gin.Context) {
 	})
 }
 
+func (s *Server) schedulerPage(c *gin.Context) {
+	scanRuns, _ := s.db.GetScanRuns(20)
+
+	c.HTML(http.StatusOK, "scheduler.html", gin.H{
+		"Schedule":    s.scheduler.Schedule(),
+		"LastSummary": s.scheduler.LastScanSummary(),
+		"ScanRuns":    scanRuns,
+	})
+}
+
 func (s *Server) filtersPage(c *gin.Context) {
 	stats, _ := s.db.GetStats()
 	rdpPrograms, _ := s.db.GetProgramsByType("RDP")
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"watchtower/internal/database"
+)
+
+func TestGetDomainsOnlyNewWithoutFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer db.Close()
+
+	invalid, valid := false, true
+	old := []database.Domain{
+		{Domain: "old-bad-cert.example.com", Program: "p", Status: "up", CertValid: &invalid},
+		{Domain: "old-down.example.com", Program: "p", Status: "down"},
+	}
+	fresh := []database.Domain{
+		{Domain: "new.example.com", Program: "p", Status: "up", CertValid: &valid},
+	}
+	if err := db.SaveProgram(&database.Program{Name: "P", Handle: "p", Source: database.ProgramSourceHackerOne}); err != nil {
+		t.Fatalf("SaveProgram: %v", err)
+	}
+	save := func(domains []database.Domain) {
+		for i := range domains {
+			domains[i].DiscoveredAt = time.Now()
+		}
+		if _, _, err := db.SaveDomains(domains); err != nil {
+			t.Fatalf("SaveDomains: %v", err)
+		}
+	}
+	save(old)
+	if err := db.MarkDomainsAsOld(); err != nil {
+		t.Fatalf("MarkDomainsAsOld: %v", err)
+	}
+	save(fresh)
+
+	s := &Server{db: db}
+	router := gin.New()
+	router.GET("/domains", s.getDomains)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"new.example.com"}},
+		{"cert_valid=false", []string{"old-bad-cert.example.com"}},
+		{"status=down", []string{"old-down.example.com"}},
+		{"platform=hackerone", []string{"new.example.com", "old-bad-cert.example.com", "old-down.example.com"}},
+		{"program=p", []string{"new.example.com", "old-bad-cert.example.com", "old-down.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/domains?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			var page struct {
+				Data []database.Domain `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			var got []string
+			for _, d := range page.Data {
+				got = append(got, d.Domain)
+			}
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
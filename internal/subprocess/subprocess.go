@@ -0,0 +1,89 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// maxStderr bounds how much of a tool's stderr is kept; the tail holds the
+// actual error in practice
+const maxStderr = 1024
+
+// Error describes a failed external tool run
+type Error struct {
+	Tool     string `json:"tool"`
+	Input    string `json:"input,omitempty"`
+	ExitCode int    `json:"exit_code"` // -1 if the tool never exited, e.g. on timeout
+	Stderr   string `json:"stderr,omitempty"`
+	Err      error  `json:"-"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Tool)
+	if e.Input != "" {
+		fmt.Fprintf(&b, " (%s)", e.Input)
+	}
+	if e.ExitCode >= 0 {
+		fmt.Fprintf(&b, ": exit status %d", e.ExitCode)
+	} else if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	if line := lastLine(e.Stderr); line != "" {
+		fmt.Fprintf(&b, ": %s", line)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Run executes a tool and returns its stdout. A failure is returned as an
+// *Error carrying the exit code and stderr; stdout is returned even then
+// because tools like subfinder exit non-zero after printing partial results.
+func Run(ctx context.Context, input, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err == nil {
+		return output, nil
+	}
+
+	runErr := &Error{
+		Tool:     name,
+		Input:    input,
+		ExitCode: -1,
+		Stderr:   tail(stderr.String(), maxStderr),
+		Err:      err,
+	}
+	var exitErr *exec.ExitError
+	if ctx.Err() != nil {
+		runErr.Err = ctx.Err()
+	} else if errors.As(err, &exitErr) {
+		runErr.ExitCode = exitErr.ExitCode()
+	}
+	return output, runErr
+}
+
+func tail(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		s = s[len(s)-n:]
+	}
+	return s
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if idx := strings.LastIndex(s, "\n"); idx != -1 {
+		s = s[idx+1:]
+	}
+	return strings.TrimSpace(s)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,6 +13,7 @@ import (
 	"watchtower/internal/config"
 	"watchtower/internal/database"
 	"watchtower/internal/discovery"
+	"watchtower/internal/enrichment"
 	"watchtower/internal/hackerone"
 	"watchtower/internal/healthcheck"
 	"watchtower/internal/scheduler"
@@ -23,6 +27,13 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		return
+	}
+
 	// Validate HackerOne token
 	if cfg.HackerOneToken == "" {
 		log.Fatalf("HACKERONE_TOKEN is required. Set it via environment variable or .hackerone_token file")
@@ -35,20 +46,54 @@ func main() {
 	}
 	defer db.Close()
 
+	if cfg.ImportFile != "" {
+		if err := importManualDomains(db, cfg.ImportFile); err != nil {
+			log.Fatalf("Failed to import %s: %v", cfg.ImportFile, err)
+		}
+	}
+
 	// Initialize services
 	hackeroneClient := hackerone.NewClient(cfg.HackerOneToken)
-	discoveryService := discovery.NewService()
-	healthCheckService := healthcheck.NewService(cfg.HealthCheckTimeout, cfg.HealthCheckWorkers)
+	if cfg.ProgramCursorTTL > 0 {
+		hackeroneClient.EnableResume(db, cfg.ProgramCursorTTL)
+	}
+	var discoveryProviders []discovery.Provider
+	if cfg.DiscoveryCT {
+		discoveryProviders = append(discoveryProviders, discovery.NewCTProvider())
+	}
+	discoveryTools := discovery.NewTools(cfg.DiscoveryTools, cfg.SubfinderConfigPath)
+	if cfg.EnableBruteforce {
+		bruteforce, err := discovery.NewBruteforceTool(cfg.BruteforceWordlist, cfg.ResolveConcurrency, cfg.ResolveTimeout)
+		if err != nil {
+			log.Fatalf("Failed to load BRUTEFORCE_WORDLIST: %v", err)
+		}
+		discoveryTools = append(discoveryTools, bruteforce)
+	}
+	discoveryService := discovery.NewService(cfg.DiscoveryBatch, discovery.Limits{
+		DomainTimeout:  cfg.DiscoveryTimeout,
+		OverallTimeout: cfg.DiscoveryOverallTimeout,
+		Concurrency:    cfg.DiscoveryConcurrency,
+	}, discoveryTools, discoveryProviders...)
+	healthCheckService := healthcheck.NewService(cfg.HealthCheckTimeout, cfg.HealthCheckWorkers, cfg.HealthCheckInsecure, cfg.HealthCheckRedirects,
+		cfg.HealthCheckUserAgent, cfg.HealthCheckHeaders).
+		WithPorts(cfg.HealthCheckPorts).
+		WithRetries(cfg.HealthCheckRetries)
+	enrichmentService := enrichment.NewService(cfg.EnrichmentConcurrency)
+
+	// Scans stop when ctx is cancelled on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Initialize scheduler
-	scanScheduler := scheduler.NewScheduler(db, hackeroneClient, discoveryService, healthCheckService, cfg)
+	scanScheduler := scheduler.NewScheduler(db, hackeroneClient, discoveryService, healthCheckService, enrichmentService, cfg)
 
 	// Start web server FIRST so users can see live results
-	webServer := server.NewServer(db, cfg.WebPort)
+	webServer := server.NewServer(db, scanScheduler, hackeroneClient, cfg.WebPort, cfg.WebAccessLog, cfg.BasePath).
+		WithAuth(server.Auth{Token: cfg.WebAuthToken, User: cfg.WebUser, Password: cfg.WebPass})
 	go func() {
 		log.Printf("Starting web server on port %s...", cfg.WebPort)
-		log.Printf("🌐 Web interface available at: http://localhost:%s", cfg.WebPort)
-		if err := webServer.Start(); err != nil {
+		log.Printf("Web interface available at: http://localhost:%s%s/", cfg.WebPort, cfg.BasePath)
+		if err := webServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Failed to start web server: %v", err)
 		}
 	}()
@@ -58,30 +103,36 @@ func main() {
 
 	// Run initial scan in background so web server is immediately available
 	go func() {
-		log.Println("🔍 Starting initial scan in background...")
-		if err := scanScheduler.RunScan(); err != nil {
+		log.Println("Starting initial scan in background...")
+		if err := scanScheduler.RunScan(ctx); err != nil {
 			log.Printf("Initial scan error: %v", err)
 		} else {
-			log.Println("✅ Initial scan completed!")
+			log.Println("Initial scan completed")
 		}
 	}()
 
-	// Schedule daily scans
-	go func() {
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
-		for range ticker.C {
-			log.Println("Running scheduled daily scan...")
-			if err := scanScheduler.RunScan(); err != nil {
-				log.Printf("Scheduled scan error: %v", err)
-			}
-		}
-	}()
+	// Schedule periodic scans
+	log.Printf("Scans scheduled every %s (SCAN_INTERVAL)", cfg.ScanInterval)
+	go scanScheduler.RunSchedule(ctx, cfg.ScanInterval)
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
-	log.Println("Shutting down...")
+	log.Printf("Shutting down, waiting up to %s for running scans and requests...", cfg.ShutdownGracePeriod)
+	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownGracePeriod)
+	defer cancelShutdown()
+
+	if err := webServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Web server shutdown: %v", err)
+	}
+	if err := scanScheduler.Shutdown(shutdownCtx); err != nil {
+		// Exit without closing the database under scans that are still writing
+		log.Printf("Grace period elapsed before scans and outputs finished, forcing exit: %v", err)
+		os.Exit(1)
+	}
+	log.Println("Shutdown complete")
 }